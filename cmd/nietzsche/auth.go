@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alex60217101990/nietzsche/external/servers"
+)
+
+func runAuth(args []string) error {
+	return subcommand("auth", args, map[string]command{
+		"token": runAuthToken,
+		"user": func(args []string) error {
+			return subcommand("auth user", args, map[string]command{
+				"list":   runAuthUserList,
+				"set":    runAuthUserSet,
+				"delete": runAuthUserDelete,
+			})
+		},
+		"role": func(args []string) error {
+			return subcommand("auth role", args, map[string]command{
+				"list":   runAuthRoleList,
+				"set":    runAuthRoleSet,
+				"delete": runAuthRoleDelete,
+			})
+		},
+	})
+}
+
+func runAuthToken(args []string) error {
+	var (
+		opts globalOptions
+		fs   = newFlagSet("auth token", "")
+	)
+	opts.register(fs)
+	if _, err := parse(fs, &opts, args, 0); err != nil {
+		return err
+	}
+
+	var token servers.Token
+	if err := newAPIClient(&opts).do(http.MethodPost, "/v1/auth/token", nil, &token); err != nil {
+		return err
+	}
+
+	return render(&opts, token, func() *table {
+		t := newTable("TOKEN", "EXPIRES AT")
+		t.add(token.Token, token.ExpiresAt)
+		return t
+	})
+}
+
+func runAuthUserList(args []string) error {
+	var (
+		opts globalOptions
+		fs   = newFlagSet("auth user list", "")
+	)
+	opts.register(fs)
+	if _, err := parse(fs, &opts, args, 0); err != nil {
+		return err
+	}
+
+	var users []servers.User
+	if err := newAPIClient(&opts).do(http.MethodGet, "/v1/auth/users", nil, &users); err != nil {
+		return err
+	}
+
+	return render(&opts, users, func() *table {
+		t := newTable("NAME", "ROLES")
+		for _, user := range users {
+			t.add(user.Name, strings.Join(user.Roles, ","))
+		}
+		return t
+	})
+}
+
+// putUserRequest is the body of PUT /v1/auth/users/{name}.
+type putUserRequest struct {
+	Password string   `json:"password,omitempty"`
+	Roles    []string `json:"roles"`
+}
+
+func runAuthUserSet(args []string) error {
+	var (
+		opts  globalOptions
+		req   putUserRequest
+		roles string
+		fs    = newFlagSet("auth user set", "<name>")
+	)
+	opts.register(fs)
+	fs.StringVar(&req.Password, "new-password", "", "password of the user, an existing user keeps its password when empty")
+	fs.StringVar(&roles, "roles", "", "comma separated roles of the user")
+	args, err := parse(fs, &opts, args, 1)
+	if err != nil {
+		return err
+	}
+
+	req.Roles = []string{}
+	for _, role := range strings.Split(roles, ",") {
+		if role = strings.TrimSpace(role); len(role) > 0 {
+			req.Roles = append(req.Roles, role)
+		}
+	}
+
+	return newAPIClient(&opts).do(http.MethodPut, "/v1/auth/users/"+url.PathEscape(args[0]), req, nil)
+}
+
+func runAuthUserDelete(args []string) error {
+	var (
+		opts globalOptions
+		fs   = newFlagSet("auth user delete", "<name>")
+	)
+	opts.register(fs)
+	args, err := parse(fs, &opts, args, 1)
+	if err != nil {
+		return err
+	}
+
+	return newAPIClient(&opts).do(http.MethodDelete, "/v1/auth/users/"+url.PathEscape(args[0]), nil, nil)
+}
+
+func runAuthRoleList(args []string) error {
+	var (
+		opts globalOptions
+		fs   = newFlagSet("auth role list", "")
+	)
+	opts.register(fs)
+	if _, err := parse(fs, &opts, args, 0); err != nil {
+		return err
+	}
+
+	var roles []servers.Role
+	if err := newAPIClient(&opts).do(http.MethodGet, "/v1/auth/roles", nil, &roles); err != nil {
+		return err
+	}
+
+	return render(&opts, roles, func() *table {
+		t := newTable("NAME", "PREFIX", "ACCESS")
+		for _, role := range roles {
+			if len(role.Permissions) == 0 {
+				t.add(role.Name, "", "")
+			}
+			for _, p := range role.Permissions {
+				t.add(role.Name, fmt.Sprintf("%q", p.Prefix), p.Access)
+			}
+		}
+		return t
+	})
+}
+
+// permissionsFlag collects the repeated "<prefix>=<access>" grants.
+type permissionsFlag []servers.Permission
+
+func (f *permissionsFlag) String() string {
+	grants := make([]string, 0, len(*f))
+	for _, p := range *f {
+		grants = append(grants, p.Prefix+"="+p.Access)
+	}
+	return strings.Join(grants, " ")
+}
+
+func (f *permissionsFlag) Set(value string) error {
+	eq := strings.LastIndexByte(value, '=')
+	if eq < 0 {
+		return fmt.Errorf("grant %q is not <prefix>=<access>", value)
+	}
+
+	*f = append(*f, servers.Permission{Prefix: value[:eq], Access: value[eq+1:]})
+	return nil
+}
+
+// putRoleRequest is the body of PUT /v1/auth/roles/{name}.
+type putRoleRequest struct {
+	Permissions []servers.Permission `json:"permissions"`
+}
+
+func runAuthRoleSet(args []string) error {
+	var (
+		opts   globalOptions
+		grants permissionsFlag
+		fs     = newFlagSet("auth role set", "<name>")
+	)
+	opts.register(fs)
+	fs.Var(&grants, "grant", "<prefix>=<read|write|readwrite> permission of the role, repeated for each prefix")
+	args, err := parse(fs, &opts, args, 1)
+	if err != nil {
+		return err
+	}
+
+	req := putRoleRequest{Permissions: append([]servers.Permission{}, grants...)}
+	return newAPIClient(&opts).do(http.MethodPut, "/v1/auth/roles/"+url.PathEscape(args[0]), req, nil)
+}
+
+func runAuthRoleDelete(args []string) error {
+	var (
+		opts globalOptions
+		fs   = newFlagSet("auth role delete", "<name>")
+	)
+	opts.register(fs)
+	args, err := parse(fs, &opts, args, 1)
+	if err != nil {
+		return err
+	}
+
+	return newAPIClient(&opts).do(http.MethodDelete, "/v1/auth/roles/"+url.PathEscape(args[0]), nil, nil)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const requestTimeout = 30 * time.Second
+
+// apiError is the error body returned by the HTTP API.
+type apiError struct {
+	Status int
+	Err    string `json:"error"`
+	Leader string `json:"leader"`
+}
+
+func (e *apiError) Error() string {
+	if len(e.Leader) > 0 {
+		return fmt.Sprintf("%s (status %d, leader %s)", e.Err, e.Status, e.Leader)
+	}
+	return fmt.Sprintf("%s (status %d)", e.Err, e.Status)
+}
+
+// apiClient sends requests to the HTTP API of a single node,
+// the node forwards them to the leader when needed.
+type apiClient struct {
+	addr string
+	http *http.Client
+
+	user     string
+	password string
+	token    string
+}
+
+func newAPIClient(opts *globalOptions) *apiClient {
+	addr := opts.addr
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+
+	return &apiClient{
+		addr:     strings.TrimRight(addr, "/"),
+		http:     &http.Client{Timeout: requestTimeout},
+		user:     opts.user,
+		password: opts.password,
+		token:    opts.token,
+	}
+}
+
+// stream sends the request and returns the response body on success.
+func (c *apiClient) stream(method, path, contentType string, body io.Reader) (io.ReadCloser, error) {
+	req, err := http.NewRequest(method, c.addr+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	switch {
+	case len(c.token) > 0:
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	case len(c.user) > 0:
+		req.SetBasicAuth(c.user, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+
+		apiErr := &apiError{Status: resp.StatusCode}
+		if err = json.NewDecoder(resp.Body).Decode(apiErr); err != nil || len(apiErr.Err) == 0 {
+			apiErr.Err = http.StatusText(resp.StatusCode)
+		}
+		return nil, apiErr
+	}
+
+	return resp.Body, nil
+}
+
+// do sends the body encoded as JSON and decodes the response into out.
+func (c *apiClient) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	resp, err := c.stream(method, path, "application/json", body)
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp).Decode(out)
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+
+	"github.com/alex60217101990/nietzsche/external/configs"
+)
+
+func runConfig(args []string) error {
+	return subcommand("config", args, map[string]command{
+		"show":   runConfigShow,
+		"schema": runConfigSchema,
+	})
+}
+
+// runConfigShow shows the configuration the node runs with,
+// after the defaults, the environment and the flags are applied.
+func runConfigShow(args []string) error {
+	var (
+		opts globalOptions
+		fs   = newFlagSet("config show", "")
+	)
+	opts.register(fs)
+	if _, err := parse(fs, &opts, args, 0); err != nil {
+		return err
+	}
+
+	var conf map[string]interface{}
+	if err := newAPIClient(&opts).do(http.MethodGet, "/v1/config", nil, &conf); err != nil {
+		return err
+	}
+
+	return render(&opts, conf, func() *table {
+		t := newTable("SETTING", "VALUE")
+		flattenConfig(t, "", conf)
+		return t
+	})
+}
+
+// flattenConfig adds a row per setting, named after its path in the sections.
+func flattenConfig(t *table, prefix string, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+	case string:
+		t.add(prefix, v)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			path := key
+			if len(prefix) > 0 {
+				path = prefix + "." + key
+			}
+			flattenConfig(t, path, v[key])
+		}
+	default:
+		// numbers are written without exponents, lists as JSON
+		data, _ := json.Marshal(v)
+		t.add(prefix, string(data))
+	}
+}
+
+// runConfigSchema prints the JSON Schema of the config files,
+// editors and CI jobs validate the files with it.
+func runConfigSchema(args []string) error {
+	var (
+		format string
+		fs     = newFlagSet("config schema", "")
+	)
+	fs.StringVar(&format, "format", "yaml", "format of the config files: yaml, toml or json")
+	if _, err := parse(fs, nil, args, 0); err != nil {
+		return err
+	}
+
+	schema, err := configs.Schema(format)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(os.Stdout, "%s\n", schema)
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/alex60217101990/nietzsche/external/store"
+)
+
+func runEncryption(args []string) error {
+	return subcommand("encryption", args, map[string]command{
+		"status": runEncryptionStatus,
+		"rotate": runEncryptionRotate,
+	})
+}
+
+func renderEncryption(opts *globalOptions, status store.EncryptionStatus) error {
+	return render(opts, status, func() *table {
+		t := newTable("FIELD", "VALUE")
+		t.add("enabled", status.Enabled)
+		t.add("active key", status.ActiveKey)
+		t.add("keys", strings.Join(status.Keys, ","))
+		t.add("rotating", status.Rotating)
+		t.add("rewrapped", status.Rewrapped)
+		t.add("started at", status.StartedAt)
+		t.add("finished at", status.FinishedAt)
+		if len(status.Error) > 0 {
+			t.add("error", status.Error)
+		}
+		return t
+	})
+}
+
+func runEncryptionStatus(args []string) error {
+	var (
+		opts globalOptions
+		fs   = newFlagSet("encryption status", "")
+	)
+	opts.register(fs)
+	if _, err := parse(fs, &opts, args, 0); err != nil {
+		return err
+	}
+
+	var status store.EncryptionStatus
+	if err := newAPIClient(&opts).do(http.MethodGet, "/v1/encryption", nil, &status); err != nil {
+		return err
+	}
+	return renderEncryption(&opts, status)
+}
+
+// runEncryptionRotate starts the rotation on the node of --addr only,
+// it has to be run against every node once the keyfiles are updated.
+func runEncryptionRotate(args []string) error {
+	var (
+		opts globalOptions
+		fs   = newFlagSet("encryption rotate", "")
+	)
+	opts.register(fs)
+	if _, err := parse(fs, &opts, args, 0); err != nil {
+		return err
+	}
+
+	var status store.EncryptionStatus
+	if err := newAPIClient(&opts).do(http.MethodPost, "/v1/encryption/rotate", nil, &status); err != nil {
+		return err
+	}
+	return renderEncryption(&opts, status)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+const defaultAddr = "127.0.0.1:8080"
+
+var errUsage = errors.New("invalid usage")
+
+// globalOptions are the flags shared by the commands talking to the API.
+type globalOptions struct {
+	addr   string
+	output string
+
+	// credentials of the user when the cluster has auth enabled
+	user     string
+	password string
+	token    string
+}
+
+func newFlagSet(name, args string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: nietzsche %s [flags] %s\n\nFlags:\n", name, args)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func (o *globalOptions) register(fs *flag.FlagSet) {
+	addr := os.Getenv("NIETZSCHE_ADDR")
+	if len(addr) == 0 {
+		addr = defaultAddr
+	}
+
+	fs.StringVar(&o.addr, "addr", addr, "HTTP API address of a node, NIETZSCHE_ADDR by default")
+	fs.StringVar(&o.output, "output", "table", "output format: table or json")
+	fs.StringVar(&o.user, "user", os.Getenv("NIETZSCHE_USER"), "user name, NIETZSCHE_USER by default")
+	fs.StringVar(&o.password, "password", os.Getenv("NIETZSCHE_PASSWORD"), "password of the user, NIETZSCHE_PASSWORD by default")
+	fs.StringVar(&o.token, "token", os.Getenv("NIETZSCHE_TOKEN"), "token issued by 'auth token', NIETZSCHE_TOKEN by default")
+}
+
+// parse reads the flags, which may follow the positional arguments,
+// and checks the number of the positional arguments.
+func parse(fs *flag.FlagSet, opts *globalOptions, args []string, nargs int) (positional []string, err error) {
+	for {
+		// the flag set reports parse errors itself
+		if err = fs.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+
+		if i := len(args) - fs.NArg() - 1; i >= 0 && args[i] == "--" {
+			positional = append(positional, fs.Args()...)
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	if opts != nil {
+		switch opts.output {
+		case "table", "json":
+		default:
+			fmt.Fprintf(fs.Output(), "invalid output %q\n", opts.output)
+			fs.Usage()
+			return nil, errUsage
+		}
+	}
+
+	if len(positional) != nargs {
+		fs.Usage()
+		return nil, errUsage
+	}
+
+	return positional, nil
+}
+
+// subcommand dispatches the first argument to one of the subcommands.
+func subcommand(name string, args []string, subs map[string]command) error {
+	if len(args) == 0 || subs[args[0]] == nil {
+		names := make([]string, 0, len(subs))
+		for sub := range subs {
+			names = append(names, sub)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(os.Stderr, "Usage: nietzsche %s <%s> [flags] [args]\n", name, strings.Join(names, "|"))
+		return errUsage
+	}
+
+	return subs[args[0]](args[1:])
+}
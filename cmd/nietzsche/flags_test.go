@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		args       []string
+		nargs      int
+		addr       string
+		positional []string
+		err        error
+	}{
+		{
+			name:       "flags before the positionals",
+			args:       []string{"-addr", "127.0.0.1:1", "mykey"},
+			nargs:      1,
+			addr:       "127.0.0.1:1",
+			positional: []string{"mykey"},
+		},
+		{
+			name:       "flags between the positionals",
+			args:       []string{"mykey", "-addr", "127.0.0.1:1", "value"},
+			nargs:      2,
+			addr:       "127.0.0.1:1",
+			positional: []string{"mykey", "value"},
+		},
+		{
+			name:       "flags after the positionals",
+			args:       []string{"mykey", "value", "-addr", "127.0.0.1:1", "-output", "json"},
+			nargs:      2,
+			addr:       "127.0.0.1:1",
+			positional: []string{"mykey", "value"},
+		},
+		{
+			name:       "flags after --",
+			args:       []string{"-addr", "127.0.0.1:1", "--", "-mykey", "-addr"},
+			nargs:      2,
+			addr:       "127.0.0.1:1",
+			positional: []string{"-mykey", "-addr"},
+		},
+		{
+			name:       "positional before --",
+			args:       []string{"mykey", "--", "-value"},
+			nargs:      2,
+			positional: []string{"mykey", "-value"},
+		},
+		{
+			name:  "missing positional",
+			args:  []string{"-addr", "127.0.0.1:1"},
+			nargs: 1,
+			addr:  "127.0.0.1:1",
+			err:   errUsage,
+		},
+		{
+			name:  "unknown flag",
+			args:  []string{"mykey", "-unknown"},
+			nargs: 1,
+			err:   errUsage,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var opts globalOptions
+			fs := newFlagSet("test", "")
+			fs.SetOutput(ioutil.Discard)
+			opts.register(fs)
+
+			positional, err := parse(fs, &opts, tt.args, tt.nargs)
+			if err != tt.err {
+				t.Fatalf("parse(%q) error = %v, want %v", tt.args, err, tt.err)
+			}
+			if !reflect.DeepEqual(positional, tt.positional) {
+				t.Errorf("parse(%q) = %q, want %q", tt.args, positional, tt.positional)
+			}
+			if len(tt.addr) > 0 && opts.addr != tt.addr {
+				t.Errorf("parse(%q) addr = %q, want %q", tt.args, opts.addr, tt.addr)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/alex60217101990/nietzsche/external/store"
+)
+
+func runKV(args []string) error {
+	return subcommand("kv", args, map[string]command{
+		"get":  runKVGet,
+		"put":  runKVPut,
+		"del":  runKVDel,
+		"scan": runKVScan,
+	})
+}
+
+func consistencyQuery(stale bool) string {
+	if stale {
+		return "?consistency=stale"
+	}
+	return ""
+}
+
+func runKVGet(args []string) error {
+	var (
+		opts  globalOptions
+		stale bool
+		fs    = newFlagSet("kv get", "<key>")
+	)
+	opts.register(fs)
+	fs.BoolVar(&stale, "stale", false, "read the local copy of the node instead of the leader")
+	args, err := parse(fs, &opts, args, 1)
+	if err != nil {
+		return err
+	}
+
+	var kv store.KeyValue
+	err = newAPIClient(&opts).do(http.MethodGet,
+		"/v1/kv/"+url.PathEscape(args[0])+consistencyQuery(stale), nil, &kv)
+	if err != nil {
+		return err
+	}
+
+	return render(&opts, kv, func() *table {
+		t := newTable("KEY", "VALUE")
+		t.add(kv.Key, kv.Value)
+		return t
+	})
+}
+
+func runKVPut(args []string) error {
+	var (
+		opts globalOptions
+		raw  bool
+		fs   = newFlagSet("kv put", "<key> <value>")
+	)
+	opts.register(fs)
+	fs.BoolVar(&raw, "raw", false, "store the value as a string even if it's valid JSON")
+	args, err := parse(fs, &opts, args, 2)
+	if err != nil {
+		return err
+	}
+
+	var value interface{} = args[1]
+	if !raw {
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(args[1]), &decoded); err == nil {
+			value = decoded
+		}
+	}
+
+	return newAPIClient(&opts).do(http.MethodPut, "/v1/kv/"+url.PathEscape(args[0]), value, nil)
+}
+
+func runKVDel(args []string) error {
+	var (
+		opts globalOptions
+		fs   = newFlagSet("kv del", "<key>")
+	)
+	opts.register(fs)
+	args, err := parse(fs, &opts, args, 1)
+	if err != nil {
+		return err
+	}
+
+	return newAPIClient(&opts).do(http.MethodDelete, "/v1/kv/"+url.PathEscape(args[0]), nil, nil)
+}
+
+func runKVScan(args []string) error {
+	var (
+		opts   globalOptions
+		prefix string
+		limit  int
+		stale  bool
+		fs     = newFlagSet("kv scan", "")
+	)
+	opts.register(fs)
+	fs.StringVar(&prefix, "prefix", "", "list only the keys starting with the prefix")
+	fs.IntVar(&limit, "limit", 0, "maximum number of keys, 0 lists all of them")
+	fs.BoolVar(&stale, "stale", false, "read the local copy of the node instead of the leader")
+	if _, err := parse(fs, &opts, args, 0); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("prefix", prefix)
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if stale {
+		query.Set("consistency", "stale")
+	}
+
+	var entries []store.KeyValue
+	if err := newAPIClient(&opts).do(http.MethodGet, "/v1/kv?"+query.Encode(), nil, &entries); err != nil {
+		return err
+	}
+
+	return render(&opts, entries, func() *table {
+		t := newTable("KEY", "VALUE")
+		for _, kv := range entries {
+			t.add(kv.Key, kv.Value)
+		}
+		return t
+	})
+}
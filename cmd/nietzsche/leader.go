@@ -0,0 +1,31 @@
+package main
+
+import (
+	"net/http"
+)
+
+func runLeader(args []string) error {
+	return subcommand("leader", args, map[string]command{
+		"transfer": runLeaderTransfer,
+	})
+}
+
+// leaderTransferRequest is the body of POST /v1/leader/transfer.
+type leaderTransferRequest struct {
+	ID string `json:"id,omitempty"`
+}
+
+func runLeaderTransfer(args []string) error {
+	var (
+		opts globalOptions
+		req  leaderTransferRequest
+		fs   = newFlagSet("leader transfer", "")
+	)
+	opts.register(fs)
+	fs.StringVar(&req.ID, "id", "", "voter to hand the leadership to, raft picks one by default")
+	if _, err := parse(fs, &opts, args, 0); err != nil {
+		return err
+	}
+
+	return newAPIClient(&opts).do(http.MethodPost, "/v1/leader/transfer", req, nil)
+}
@@ -0,0 +1,65 @@
+// Command nietzsche runs a node of the cluster and operates
+// a running cluster through its HTTP API.
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `Usage: nietzsche <command> [flags] [args]
+
+Commands:
+  serve      run a node with the given configuration file
+  kv         get, put, del and scan keys
+  members    list, add and remove members of the cluster
+  leader     transfer the leadership
+  snapshot   save, restore and inspect backups of the store
+  status     show the raft status of a node
+  auth       issue tokens, manage users and roles
+  encryption show the keys of a node and rotate them
+  config     show the effective configuration of a node and the config schema
+
+Run 'nietzsche <command> -h' for the flags of the command.
+`
+
+type command func(args []string) error
+
+var commands = map[string]command{
+	"serve":      runServe,
+	"kv":         runKV,
+	"members":    runMembers,
+	"leader":     runLeader,
+	"snapshot":   runSnapshot,
+	"status":     runStatus,
+	"auth":       runAuth,
+	"encryption": runEncryption,
+	"config":     runConfig,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "nietzsche: unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+
+	if err := cmd(os.Args[2:]); err != nil {
+		if err == errUsage {
+			os.Exit(2)
+		}
+		fmt.Fprintf(os.Stderr, "nietzsche: %v\n", err)
+		os.Exit(1)
+	}
+}
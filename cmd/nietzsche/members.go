@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/alex60217101990/nietzsche/external/servers"
+)
+
+func runMembers(args []string) error {
+	return subcommand("members", args, map[string]command{
+		"list":   runMembersList,
+		"add":    runMembersAdd,
+		"remove": runMembersRemove,
+	})
+}
+
+func runMembersList(args []string) error {
+	var (
+		opts globalOptions
+		fs   = newFlagSet("members list", "")
+	)
+	opts.register(fs)
+	if _, err := parse(fs, &opts, args, 0); err != nil {
+		return err
+	}
+
+	var membership servers.Membership
+	if err := newAPIClient(&opts).do(http.MethodGet, "/v1/members", nil, &membership); err != nil {
+		return err
+	}
+
+	return render(&opts, membership, func() *table {
+		t := newTable("ID", "ADDRESS", "SUFFRAGE", "LEADER", "LAST CONTACT", "MATCH INDEX")
+		for _, server := range membership.Servers {
+			t.add(server.ID, server.Address, server.Suffrage, server.Leader, server.LastContact, server.MatchIndex)
+		}
+		return t
+	})
+}
+
+// addMemberRequest is the body of POST /v1/members.
+type addMemberRequest struct {
+	ID         string `json:"id"`
+	Address    string `json:"address"`
+	APIAddress string `json:"api_address,omitempty"`
+	Suffrage   string `json:"suffrage,omitempty"`
+}
+
+func runMembersAdd(args []string) error {
+	var (
+		opts globalOptions
+		req  addMemberRequest
+		fs   = newFlagSet("members add", "<id> <raft-address>")
+	)
+	opts.register(fs)
+	fs.StringVar(&req.APIAddress, "api-address", "", "HTTP API address of the new server")
+	fs.StringVar(&req.Suffrage, "suffrage", "voter", "suffrage of the new server: voter or nonvoter")
+	args, err := parse(fs, &opts, args, 2)
+	if err != nil {
+		return err
+	}
+	req.ID, req.Address = args[0], args[1]
+
+	return newAPIClient(&opts).do(http.MethodPost, "/v1/members", req, nil)
+}
+
+func runMembersRemove(args []string) error {
+	var (
+		opts  globalOptions
+		force bool
+		fs    = newFlagSet("members remove", "<id>")
+	)
+	opts.register(fs)
+	fs.BoolVar(&force, "force", false, "remove the server even if the cluster loses its healthy quorum")
+	args, err := parse(fs, &opts, args, 1)
+	if err != nil {
+		return err
+	}
+
+	path := "/v1/members/" + url.PathEscape(args[0])
+	if force {
+		path += "?force=true"
+	}
+
+	return newAPIClient(&opts).do(http.MethodDelete, path, nil, nil)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/alex60217101990/nietzsche/external/configs"
+	"github.com/alex60217101990/nietzsche/external/consts"
+	"github.com/alex60217101990/nietzsche/external/logger"
+	"github.com/alex60217101990/nietzsche/external/servers"
+	"github.com/alex60217101990/nietzsche/external/store"
+)
+
+// frontend is an API serving the node to clients.
+type frontend interface {
+	Start() error
+	Close() error
+}
+
+func closeFrontends(frontends []frontend, log logger.Logger) {
+	for i := len(frontends) - 1; i >= 0; i-- {
+		if err := frontends[i].Close(); err != nil {
+			log.Error(err)
+		}
+	}
+}
+
+func runServe(args []string) (err error) {
+	var (
+		config    string
+		overrides = make(configs.Overrides)
+		fs        = newFlagSet("serve", "")
+	)
+	fs.StringVar(&config, "config", "config.yaml", "path to the configuration file, the settings come from the environment and the flags only when empty")
+	// the flags override the environment variables, which override the file
+	overrides.RegisterFlags(fs)
+	if _, err = parse(fs, nil, args, 0); err != nil {
+		return err
+	}
+
+	conf, err := configs.Load(config, overrides)
+	if err != nil {
+		return err
+	}
+
+	log, err := logger.New(conf.Logger.Options())
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	// the package variables are kept for the code not taking them explicitly yet
+	configs.Conf = conf
+	logger.AppLogger = log
+
+	// the running configuration, it's replaced on reload
+	live := configs.NewLive(conf)
+
+	fsm, err := store.NewBoldDBStore(live, log)
+	if err != nil {
+		return err
+	}
+
+	node := servers.NewRaftNode(live, fsm, log)
+	if err = node.Start(); err != nil {
+		fsm.Close()
+		return err
+	}
+
+	// the APIs of the node, they are closed in the reverse order
+	frontends := []frontend{servers.NewServer(node)}
+	if conf.GRPC != nil {
+		frontends = append(frontends, servers.NewGRPCServer(node))
+	}
+	if conf.Redis != nil {
+		frontends = append(frontends, servers.NewRedisServer(node))
+	}
+	if conf.Memcached != nil {
+		frontends = append(frontends, servers.NewMemcachedServer(node))
+	}
+
+	for i, f := range frontends {
+		if err = f.Start(); err != nil {
+			closeFrontends(frontends[:i], log)
+			node.Close()
+			return err
+		}
+	}
+
+	log.Infof("node started",
+		map[string]interface{}{
+			"node-id": conf.Raft.NodeID,
+		})
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	stop := make(chan struct{})
+	defer close(stop)
+
+	var changed <-chan struct{}
+	if len(config) > 0 {
+		changed = configs.Watch(config, consts.ConfigWatchInterval, stop)
+	}
+
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				reloadConfig(live, node, log, config, overrides)
+				continue
+			}
+
+			closeFrontends(frontends, log)
+			return node.Close()
+		case <-changed:
+			reloadConfig(live, node, log, config, overrides)
+		}
+	}
+}
+
+// reloadConfig applies the changed settings of the config file, the file
+// is rejected when it's invalid or changes settings needing a restart.
+func reloadConfig(live *configs.Live, node *servers.RaftNode, log logger.Logger, config string, overrides configs.Overrides) {
+	changes, err := live.Reload(config, overrides)
+
+	diff := make([]string, 0, len(changes))
+	for _, change := range changes {
+		diff = append(diff, change.String())
+	}
+
+	if err != nil {
+		log.Errorf("config reload rejected",
+			map[string]interface{}{
+				"error":   err.Error(),
+				"changes": diff,
+			})
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	conf := live.Load()
+	for _, change := range changes {
+		switch change.Path {
+		case "consensus.log-level":
+			node.SetRaftLogLevel(conf.Raft.LogLevel)
+		case "logger.level":
+			// the level has been validated with the config
+			_ = log.SetLevel(conf.Logger.Level)
+		}
+	}
+
+	log.Infof("config reloaded",
+		map[string]interface{}{
+			"changes": diff,
+		})
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/valyala/gozstd"
+)
+
+// zstdMagic starts every zstd frame, backups of stores
+// with compression enabled are zstd streams.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+func runSnapshot(args []string) error {
+	return subcommand("snapshot", args, map[string]command{
+		"save":    runSnapshotSave,
+		"restore": runSnapshotRestore,
+		"inspect": runSnapshotInspect,
+	})
+}
+
+func runSnapshotSave(args []string) (err error) {
+	var (
+		opts  globalOptions
+		stale bool
+		fs    = newFlagSet("snapshot save", "<file>")
+	)
+	opts.register(fs)
+	fs.BoolVar(&stale, "stale", false, "back up the local copy of the node instead of the leader")
+	if args, err = parse(fs, &opts, args, 1); err != nil {
+		return err
+	}
+
+	client := newAPIClient(&opts)
+	client.http.Timeout = 0
+
+	body, err := client.stream(http.MethodGet, "/v1/snapshot"+consistencyQuery(stale), "", nil)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	file, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+
+	size, err := io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(args[0])
+		return err
+	}
+
+	fmt.Printf("saved %d bytes to %s\n", size, args[0])
+	return nil
+}
+
+func runSnapshotRestore(args []string) error {
+	var (
+		opts globalOptions
+		fs   = newFlagSet("snapshot restore", "<file>")
+	)
+	opts.register(fs)
+	args, err := parse(fs, &opts, args, 1)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	client := newAPIClient(&opts)
+	client.http.Timeout = 0
+
+	body, err := client.stream(http.MethodPut, "/v1/snapshot", "application/octet-stream", file)
+	if err != nil {
+		return err
+	}
+	return body.Close()
+}
+
+type bucketInfo struct {
+	Name string `json:"name"`
+	Keys int    `json:"keys"`
+}
+
+type snapshotInfo struct {
+	File       string       `json:"file"`
+	Size       int64        `json:"size"`
+	Compressed bool         `json:"compressed"`
+	DBSize     int64        `json:"db_size"`
+	TxID       int          `json:"tx_id"`
+	Buckets    []bucketInfo `json:"buckets"`
+}
+
+// runSnapshotInspect opens a backup offline and reports its contents.
+func runSnapshotInspect(args []string) error {
+	var (
+		opts globalOptions
+		fs   = newFlagSet("snapshot inspect", "<file>")
+	)
+	opts.register(fs)
+	args, err := parse(fs, &opts, args, 1)
+	if err != nil {
+		return err
+	}
+
+	info, err := inspectSnapshot(args[0])
+	if err != nil {
+		return err
+	}
+
+	return render(&opts, info, func() *table {
+		t := newTable("FIELD", "VALUE")
+		t.add("file", info.File)
+		t.add("size", info.Size)
+		t.add("compressed", info.Compressed)
+		t.add("db size", info.DBSize)
+		t.add("tx id", info.TxID)
+		for _, bucket := range info.Buckets {
+			t.add("bucket "+bucket.Name, fmt.Sprintf("%d keys", bucket.Keys))
+		}
+		return t
+	})
+}
+
+func inspectSnapshot(path string) (info *snapshotInfo, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	stat, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(file)
+	magic, _ := reader.Peek(len(zstdMagic))
+
+	info = &snapshotInfo{
+		File:       path,
+		Size:       stat.Size(),
+		Compressed: bytes.Equal(magic, zstdMagic),
+		Buckets:    make([]bucketInfo, 0),
+	}
+
+	// bolt needs a file, the backup is copied
+	// so inspecting never modifies it
+	tmp, err := ioutil.TempFile("", "nietzsche-inspect-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if info.Compressed {
+		err = gozstd.StreamDecompress(tmp, reader)
+	} else {
+		_, err = io.Copy(tmp, reader)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(tmp.Name(), 0600, &bolt.Options{
+		ReadOnly: true,
+		Timeout:  time.Second,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid snapshot: %v", path, err)
+	}
+	defer db.Close()
+
+	err = db.View(func(tx *bolt.Tx) error {
+		info.DBSize = tx.Size()
+		info.TxID = tx.ID()
+		return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			info.Buckets = append(info.Buckets, bucketInfo{
+				Name: string(name),
+				Keys: bucket.Stats().KeyN,
+			})
+			return nil
+		})
+	})
+
+	return info, err
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/alex60217101990/nietzsche/external/servers"
+)
+
+func runStatus(args []string) error {
+	var (
+		opts globalOptions
+		fs   = newFlagSet("status", "")
+	)
+	opts.register(fs)
+	if _, err := parse(fs, &opts, args, 0); err != nil {
+		return err
+	}
+
+	var status servers.Status
+	if err := newAPIClient(&opts).do(http.MethodGet, "/v1/status", nil, &status); err != nil {
+		return err
+	}
+
+	return render(&opts, status, func() *table {
+		t := newTable("FIELD", "VALUE")
+		t.add("node id", status.NodeID)
+		t.add("state", status.State)
+		t.add("leader id", status.LeaderID)
+		t.add("leader address", status.LeaderAddress)
+		t.add("leader api address", status.LeaderAPIAddress)
+		t.add("term", status.Term)
+		t.add("last log index", status.LastLogIndex)
+		t.add("last log term", status.LastLogTerm)
+		t.add("commit index", status.CommitIndex)
+		t.add("applied index", status.AppliedIndex)
+		t.add("fsm pending", status.FSMPending)
+		t.add("last contact", status.LastContact)
+		t.add("last snapshot index", status.LastSnapshotIndex)
+		t.add("last snapshot term", status.LastSnapshotTerm)
+		for _, peer := range status.Peers {
+			t.add("peer "+peer.ID, peer.Address+" ("+peer.Suffrage+")")
+		}
+		return t
+	})
+}
@@ -9,14 +9,16 @@ import (
 
 type LimitPool struct {
 	pool chan []byte
+	log  logger.Logger
 }
 
-func (lp *LimitPool) InitPool(poolCap uint16) Pool {
+func (lp *LimitPool) InitPool(poolCap uint16, log logger.Logger) Pool {
 	if poolCap == 0 {
 		poolCap = consts.PoolCap
 	}
 	return &LimitPool{
 		pool: make(chan []byte, poolCap),
+		log:  log,
 	}
 }
 
@@ -24,12 +26,14 @@ func (lp *LimitPool) GetBytes() (b []byte) {
 	select {
 	case bt, ok := <-lp.pool:
 		if ok {
+			poolGets.Inc("limit_bytes", "hit")
 			return bt
 		}
 		// non-normal behaivor, need fix!
-		logger.AppLogger.Fatal(fmt.Errorf("closed the cahnnel of the LimitPool"))
+		lp.log.Fatal(fmt.Errorf("closed the cahnnel of the LimitPool"))
 	default:
 	}
+	poolGets.Inc("limit_bytes", "miss")
 	return // nil<[]byte>
 }
 
@@ -6,6 +6,12 @@ import (
 	"sync"
 
 	"github.com/alex60217101990/nietzsche/external/consts"
+	"github.com/alex60217101990/nietzsche/external/metrics"
+)
+
+var (
+	poolGets = metrics.AppMetrics.Counter("pool_gets_total",
+		"Objects taken from the allocation pools, a miss allocates a new object.", "pool", "result")
 )
 
 type UnlimitPoolBuffer struct {
@@ -13,19 +19,18 @@ type UnlimitPoolBuffer struct {
 }
 
 func (up *UnlimitPoolBuffer) InitPool() BufferPool {
-	return &UnlimitPoolBuffer{
-		pool: sync.Pool{
-			New: func() interface{} { return new(bytes.Buffer) },
-		},
-	}
+	return &UnlimitPoolBuffer{}
 }
 
 func (up *UnlimitPoolBuffer) GetBuffer() (b *bytes.Buffer) {
 	ifc := up.pool.Get()
-	if ifc != nil {
-		b = ifc.(*bytes.Buffer)
+	if ifc == nil {
+		poolGets.Inc("unlimit_buffer", "miss")
+		return new(bytes.Buffer)
 	}
-	return
+
+	poolGets.Inc("unlimit_buffer", "hit")
+	return ifc.(*bytes.Buffer)
 }
 
 func (up *UnlimitPoolBuffer) PutBuffer(b *bytes.Buffer) {
@@ -44,20 +49,19 @@ type UnlimitPool struct {
 }
 
 func (up *UnlimitPool) InitPool() Pool {
-	return &UnlimitPool{
-		pool: sync.Pool{
-			New: func() interface{} { return []byte{} },
-		},
-	}
+	return &UnlimitPool{}
 }
 
 // get bytes
 func (up *UnlimitPool) GetBytes() (b []byte) {
 	ifc := up.pool.Get()
-	if ifc != nil {
-		b = ifc.([]byte)
+	if ifc == nil {
+		poolGets.Inc("unlimit_bytes", "miss")
+		return []byte{}
 	}
-	return
+
+	poolGets.Inc("unlimit_bytes", "hit")
+	return ifc.([]byte)
 }
 
 // put bytes
@@ -0,0 +1,288 @@
+// Package client is a Go client of the nietzsche HTTP API. It finds
+// the leader through the seed endpoints, sends writes and consistent
+// reads straight to it and retries idempotent requests on failover.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+)
+
+// Client is safe for concurrent use.
+type Client struct {
+	cfg  Config
+	http *http.Client
+
+	mu        sync.RWMutex
+	endpoints []string
+	current   int
+	leader    string
+}
+
+// request describes a call of the API.
+type request struct {
+	method string
+	path   string
+	query  url.Values
+	body   interface{}
+	// the request is sent to the leader when it's known
+	leader bool
+	// the request can be repeated without changing the outcome
+	idempotent bool
+}
+
+func New(cfg Config) (*Client, error) {
+	if len(cfg.Endpoints) == 0 {
+		return nil, ErrNoEndpoints
+	}
+
+	if cfg.RequestTimeout == 0 {
+		cfg.RequestTimeout = consts.ClientRequestTimeout
+	}
+	if cfg.MaxRetries == 0 {
+		cfg.MaxRetries = consts.ClientMaxRetries
+	}
+	if cfg.BackoffBase == 0 {
+		cfg.BackoffBase = consts.ClientBackoffBase
+	}
+	if cfg.BackoffMax == 0 {
+		cfg.BackoffMax = consts.ClientBackoffMax
+	}
+
+	c := &Client{
+		cfg: cfg,
+		// no client timeout, it would cut the watch streams,
+		// the attempts are limited through their contexts
+		http: &http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+		},
+	}
+	for _, endpoint := range cfg.Endpoints {
+		c.endpoints = append(c.endpoints, normalizeEndpoint(endpoint))
+	}
+
+	return c, nil
+}
+
+// Close releases the idle connections.
+func (c *Client) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+func normalizeEndpoint(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "http://" + endpoint
+	}
+	return strings.TrimRight(endpoint, "/")
+}
+
+// endpoint picks the leader for the requests it has to serve,
+// otherwise the current seed endpoint.
+func (c *Client) endpoint(leader bool) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if leader && len(c.leader) > 0 {
+		return c.leader
+	}
+	return c.endpoints[c.current]
+}
+
+// failed forgets the leader if it's the endpoint which
+// failed and moves on to the next seed endpoint.
+func (c *Client) failed(endpoint string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if endpoint == c.leader {
+		c.leader = ""
+	}
+	if endpoint == c.endpoints[c.current] {
+		c.current = (c.current + 1) % len(c.endpoints)
+	}
+}
+
+type statusResponse struct {
+	LeaderAPIAddress string `json:"leader_api_address"`
+}
+
+// discover asks the seed endpoints for the API address of the leader.
+func (c *Client) discover(ctx context.Context) {
+	c.mu.RLock()
+	endpoints := append([]string(nil), c.endpoints...)
+	c.mu.RUnlock()
+
+	for _, endpoint := range endpoints {
+		var status statusResponse
+		err := c.send(ctx, endpoint, &request{
+			method: http.MethodGet,
+			path:   "/v1/status",
+		}, &status)
+		if err != nil || len(status.LeaderAPIAddress) == 0 {
+			continue
+		}
+
+		c.mu.Lock()
+		c.leader = normalizeEndpoint(status.LeaderAPIAddress)
+		c.mu.Unlock()
+		return
+	}
+}
+
+// do sends the request, failing over to the other endpoints. Requests
+// which are not idempotent are repeated only when the failed attempt
+// is known not to have reached the cluster.
+func (c *Client) do(ctx context.Context, req *request, out interface{}) (err error) {
+	for attempt := 0; ; attempt++ {
+		c.mu.RLock()
+		unknownLeader := req.leader && len(c.leader) == 0
+		c.mu.RUnlock()
+		if unknownLeader {
+			c.discover(ctx)
+		}
+
+		endpoint := c.endpoint(req.leader)
+		if err = c.send(ctx, endpoint, req, out); err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil || !retryable(err, req.idempotent) {
+			return err
+		}
+		c.failed(endpoint)
+
+		if attempt >= c.cfg.MaxRetries {
+			return err
+		}
+		if err = c.backoff(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// retryable reports whether the failed attempt can be repeated.
+func retryable(err error, idempotent bool) bool {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusMisdirectedRequest:
+			// refused by a server which is not the leader
+			return true
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return idempotent
+		}
+		return false
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		// the request never left the client
+		return true
+	}
+
+	return idempotent
+}
+
+func (c *Client) backoff(ctx context.Context, attempt int) error {
+	delay := c.cfg.BackoffBase << uint(attempt)
+	if delay > c.cfg.BackoffMax || delay <= 0 {
+		delay = c.cfg.BackoffMax
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// send makes a single attempt of the request against the endpoint.
+func (c *Client) send(ctx context.Context, endpoint string, req *request, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.cfg.RequestTimeout)
+	defer cancel()
+
+	resp, err := c.open(ctx, endpoint, req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// open sends the request and returns the successful response,
+// the body must be closed by the caller.
+func (c *Client) open(ctx context.Context, endpoint string, req *request) (*http.Response, error) {
+	var body io.Reader
+	if req.body != nil {
+		data, err := json.Marshal(req.body)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	address := endpoint + req.path
+	if len(req.query) > 0 {
+		address += "?" + req.query.Encode()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, address, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	switch {
+	case len(c.cfg.Token) > 0:
+		httpReq.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	case len(c.cfg.Username) > 0:
+		httpReq.SetBasicAuth(c.cfg.Username, c.cfg.Password)
+	}
+
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if err = json.NewDecoder(resp.Body).Decode(apiErr); err != nil || len(apiErr.Message) == 0 {
+			apiErr.Message = http.StatusText(resp.StatusCode)
+		}
+		return nil, apiErr
+	}
+
+	return resp, nil
+}
+
+// notFound replaces 404 errors of the cluster with the given error.
+func notFound(err, replacement error) error {
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+		return replacement
+	}
+	return err
+}
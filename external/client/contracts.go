@@ -0,0 +1,90 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNoEndpoints      = errors.New("at least one endpoint is required")
+	ErrKeyNotFound      = errors.New("key not found")
+	ErrLeaseNotFound    = errors.New("lease not found")
+	ErrWatchInterrupted = errors.New("watch interrupted, changes may have been missed")
+)
+
+// Error is a request rejected by the cluster.
+type Error struct {
+	StatusCode int    `json:"-"`
+	Message    string `json:"error"`
+	// Leader is the raft address of the leader, set when
+	// the server refused a request only the leader can serve.
+	Leader string `json:"leader,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s (status %d)", e.Message, e.StatusCode)
+}
+
+// Config of the client, only Endpoints are required.
+type Config struct {
+	// HTTP API addresses of some servers of the cluster,
+	// the leader is discovered through them.
+	Endpoints []string
+	// Time limit of a single attempt, the context passed
+	// to a call bounds all of its attempts. Watches ignore it.
+	RequestTimeout time.Duration
+	// How many times a failed idempotent request is retried.
+	MaxRetries int
+	// Delay before the first retry, doubled on each next one up to BackoffMax.
+	BackoffBase time.Duration
+	BackoffMax  time.Duration
+	// Credentials of the user when the cluster has auth enabled,
+	// a Token takes precedence over the Username and Password.
+	Username string
+	Password string
+	Token    string
+}
+
+// Consistency selects which servers are allowed to answer a read.
+type Consistency uint8
+
+const (
+	// Consistent reads are served by the leader.
+	Consistent Consistency = iota
+	// Stale reads are answered by any server from its local copy.
+	Stale
+)
+
+// KeyValue is a stored key.
+type KeyValue struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// Lease keeps the attached keys until it is revoked or expires.
+type Lease struct {
+	ID  uint64 `json:"id"`
+	TTL int64  `json:"ttl"`
+}
+
+// Event types sent by Watch.
+const (
+	EventPut    = "PUT"
+	EventDelete = "DELETE"
+)
+
+// Event is a change of a key, Index is the raft log index which applied it.
+type Event struct {
+	Type  string      `json:"type"`
+	Key   string      `json:"key"`
+	Value interface{} `json:"value,omitempty"`
+	Index uint64      `json:"index"`
+}
+
+// WatchResponse carries either the events or an error. ErrWatchInterrupted
+// is informational, the watch reconnects and goes on after it.
+type WatchResponse struct {
+	Events []Event
+	Err    error
+}
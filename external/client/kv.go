@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// Get reads the key, ErrKeyNotFound is returned for missing keys.
+func (c *Client) Get(ctx context.Context, key string, opts ...OpOption) (*KeyValue, error) {
+	o := newOp(opts)
+
+	var kv KeyValue
+	err := c.do(ctx, &request{
+		method:     http.MethodGet,
+		path:       "/v1/kv/" + url.PathEscape(key),
+		query:      o.query(),
+		leader:     o.consistency == Consistent,
+		idempotent: true,
+	}, &kv)
+	if err != nil {
+		return nil, notFound(err, ErrKeyNotFound)
+	}
+
+	return &kv, nil
+}
+
+// Put stores the value, which must be encodable as JSON, under the key.
+func (c *Client) Put(ctx context.Context, key string, value interface{}, opts ...OpOption) error {
+	o := newOp(opts)
+
+	err := c.do(ctx, &request{
+		method:     http.MethodPut,
+		path:       "/v1/kv/" + url.PathEscape(key),
+		query:      o.query(),
+		body:       value,
+		leader:     true,
+		idempotent: true,
+	}, nil)
+	if o.lease != 0 {
+		return notFound(err, ErrLeaseNotFound)
+	}
+	return err
+}
+
+// Delete removes the key, deleting a missing key is not an error.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	return c.do(ctx, &request{
+		method:     http.MethodDelete,
+		path:       "/v1/kv/" + url.PathEscape(key),
+		leader:     true,
+		idempotent: true,
+	}, nil)
+}
+
+// Scan lists the keys starting with the prefix in key order.
+func (c *Client) Scan(ctx context.Context, prefix string, opts ...OpOption) ([]KeyValue, error) {
+	o := newOp(opts)
+
+	query := o.query()
+	query.Set("prefix", prefix)
+
+	var entries []KeyValue
+	err := c.do(ctx, &request{
+		method:     http.MethodGet,
+		path:       "/v1/kv",
+		query:      query,
+		leader:     o.consistency == Consistent,
+		idempotent: true,
+	}, &entries)
+
+	return entries, err
+}
@@ -0,0 +1,55 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+)
+
+type grantRequest struct {
+	TTL int64 `json:"ttl"`
+}
+
+// Grant creates a lease which expires unless it's kept alive within the ttl.
+// The ttl restarts when the leadership changes.
+func (c *Client) Grant(ctx context.Context, ttlSeconds int64) (*Lease, error) {
+	var lease Lease
+	err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v1/lease",
+		body:   grantRequest{TTL: ttlSeconds},
+		leader: true,
+	}, &lease)
+	if err != nil {
+		return nil, err
+	}
+
+	return &lease, nil
+}
+
+// Revoke removes the lease and deletes the keys attached to it.
+func (c *Client) Revoke(ctx context.Context, id uint64) error {
+	err := c.do(ctx, &request{
+		method:     http.MethodDelete,
+		path:       "/v1/lease/" + strconv.FormatUint(id, 10),
+		leader:     true,
+		idempotent: true,
+	}, nil)
+	return notFound(err, ErrLeaseNotFound)
+}
+
+// KeepAlive restarts the ttl of the lease.
+func (c *Client) KeepAlive(ctx context.Context, id uint64) (*Lease, error) {
+	var lease Lease
+	err := c.do(ctx, &request{
+		method:     http.MethodPost,
+		path:       "/v1/lease/" + strconv.FormatUint(id, 10) + "/keepalive",
+		leader:     true,
+		idempotent: true,
+	}, &lease)
+	if err != nil {
+		return nil, notFound(err, ErrLeaseNotFound)
+	}
+
+	return &lease, nil
+}
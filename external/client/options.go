@@ -0,0 +1,58 @@
+package client
+
+import (
+	"net/url"
+	"strconv"
+)
+
+type op struct {
+	consistency Consistency
+	limit       int
+	lease       uint64
+}
+
+// OpOption changes a single request.
+type OpOption func(*op)
+
+// WithConsistency sets the consistency of Get and Scan, Consistent by default.
+func WithConsistency(consistency Consistency) OpOption {
+	return func(o *op) {
+		o.consistency = consistency
+	}
+}
+
+// WithLimit limits the number of keys returned by Scan.
+func WithLimit(limit int) OpOption {
+	return func(o *op) {
+		o.limit = limit
+	}
+}
+
+// WithLease attaches the key written by Put to the lease.
+func WithLease(id uint64) OpOption {
+	return func(o *op) {
+		o.lease = id
+	}
+}
+
+func newOp(opts []OpOption) *op {
+	o := &op{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (o *op) query() url.Values {
+	query := url.Values{}
+	if o.consistency == Stale {
+		query.Set("consistency", "stale")
+	}
+	if o.limit > 0 {
+		query.Set("limit", strconv.Itoa(o.limit))
+	}
+	if o.lease != 0 {
+		query.Set("lease", strconv.FormatUint(o.lease, 10))
+	}
+	return query
+}
@@ -0,0 +1,93 @@
+package client
+
+import (
+	"context"
+	"net/http"
+)
+
+// Compare is a condition on the current value of a key.
+type Compare struct {
+	Key    string      `json:"key"`
+	Result string      `json:"result"`
+	Value  interface{} `json:"value,omitempty"`
+}
+
+// Equal holds when the key exists and its value equals to the given one.
+func Equal(key string, value interface{}) Compare {
+	return Compare{Key: key, Result: "equal", Value: value}
+}
+
+// NotEqual holds when the key is missing or has a different value.
+func NotEqual(key string, value interface{}) Compare {
+	return Compare{Key: key, Result: "not_equal", Value: value}
+}
+
+// Exists holds when the key exists.
+func Exists(key string) Compare {
+	return Compare{Key: key, Result: "exists"}
+}
+
+// Missing holds when the key doesn't exist.
+func Missing(key string) Compare {
+	return Compare{Key: key, Result: "missing"}
+}
+
+// Op is an operation run by a transaction.
+type Op struct {
+	Operation string      `json:"operation"`
+	Key       string      `json:"key"`
+	Value     interface{} `json:"value,omitempty"`
+	Lease     uint64      `json:"lease,omitempty"`
+}
+
+func OpGet(key string) Op {
+	return Op{Operation: "GET", Key: key}
+}
+
+// OpPut stores the value, only the WithLease option is used.
+func OpPut(key string, value interface{}, opts ...OpOption) Op {
+	return Op{Operation: "SET", Key: key, Value: value, Lease: newOp(opts).lease}
+}
+
+func OpDelete(key string) Op {
+	return Op{Operation: "DELETE", Key: key}
+}
+
+// Txn runs the Success operations when all the comparisons
+// hold and the Failure operations otherwise, atomically.
+type Txn struct {
+	Compare []Compare `json:"compare"`
+	Success []Op      `json:"success"`
+	Failure []Op      `json:"failure"`
+}
+
+// OpResult is the outcome of a single transaction operation,
+// Found reports whether the key existed for GET and DELETE.
+type OpResult struct {
+	Operation string      `json:"operation"`
+	Key       string      `json:"key"`
+	Value     interface{} `json:"value,omitempty"`
+	Found     bool        `json:"found"`
+}
+
+type TxnResponse struct {
+	Succeeded bool       `json:"succeeded"`
+	Results   []OpResult `json:"results"`
+}
+
+// Txn runs the transaction on the leader. It's not idempotent,
+// so it's repeated only when the attempt didn't reach the cluster.
+func (c *Client) Txn(ctx context.Context, txn Txn) (*TxnResponse, error) {
+	var resp TxnResponse
+	err := c.do(ctx, &request{
+		method: http.MethodPost,
+		path:   "/v1/txn",
+		body:   txn,
+		leader: true,
+	}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
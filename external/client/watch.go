@@ -0,0 +1,75 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+)
+
+// Watch streams the changes of the keys starting with the prefix until the
+// context is done, then the channel is closed. When the stream breaks the
+// watch reconnects to the next endpoint with backoff, reporting the gap
+// with ErrWatchInterrupted.
+func (c *Client) Watch(ctx context.Context, prefix string) <-chan WatchResponse {
+	ch := make(chan WatchResponse)
+
+	go func() {
+		defer close(ch)
+
+		for attempt := 0; ; attempt++ {
+			endpoint := c.endpoint(false)
+			received, err := c.watch(ctx, endpoint, prefix, ch)
+			if ctx.Err() != nil {
+				return
+			}
+			if received {
+				attempt = 0
+			}
+
+			if err == nil {
+				err = ErrWatchInterrupted
+			}
+			select {
+			case ch <- WatchResponse{Err: err}:
+			case <-ctx.Done():
+				return
+			}
+
+			c.failed(endpoint)
+			if c.backoff(ctx, attempt) != nil {
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// watch follows a single stream, it reports whether any event was received.
+func (c *Client) watch(ctx context.Context, endpoint, prefix string, ch chan<- WatchResponse) (received bool, err error) {
+	resp, err := c.open(ctx, endpoint, &request{
+		method: http.MethodGet,
+		path:   "/v1/watch",
+		query:  url.Values{"prefix": []string{prefix}},
+	})
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	dec := json.NewDecoder(resp.Body)
+	for {
+		var event Event
+		if err = dec.Decode(&event); err != nil {
+			return received, nil
+		}
+		received = true
+
+		select {
+		case ch <- WatchResponse{Events: []Event{event}}:
+		case <-ctx.Done():
+			return received, ctx.Err()
+		}
+	}
+}
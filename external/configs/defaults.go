@@ -0,0 +1,125 @@
+package configs
+
+import (
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+
+	"github.com/hashicorp/raft"
+)
+
+// SetDefaults fills the settings left unset, it runs once the config file,
+// the environment and the flags are applied, so the running components
+// never fall back to defaults themselves. Optional sections stay disabled.
+func (c *Configs) SetDefaults() {
+	if c.Timeouts == nil {
+		c.Timeouts = &Timeouts{}
+	}
+	if c.Timeouts.DefaultTimeout == 0 {
+		c.Timeouts.DefaultTimeout = consts.DefaultTimeout
+	}
+	if c.Timeouts.DefaultStoreTimeout == 0 {
+		c.Timeouts.DefaultStoreTimeout = consts.DefaultStoreTimeout
+	}
+
+	if c.Logger == nil {
+		c.Logger = &Logger{}
+	}
+	c.Logger.setDefaults()
+
+	if c.Server != nil && c.Server.ReadyMaxLag == 0 {
+		c.Server.ReadyMaxLag = consts.ReadyMaxAppliedLag
+	}
+	if c.Raft != nil {
+		c.Raft.setDefaults()
+	}
+	if c.Autopilot != nil {
+		c.Autopilot.setDefaults()
+	}
+	if c.Auth != nil && c.Auth.TokenTTL == 0 {
+		c.Auth.TokenTTL = Duration(consts.AuthTokenTTL)
+	}
+}
+
+func (l *Logger) setDefaults() {
+	if len(l.Level) == 0 {
+		l.Level = consts.LogLevel
+	}
+	if len(l.Encoding) == 0 {
+		l.Encoding = consts.LogEncoding
+	}
+	if len(l.Outputs) == 0 {
+		l.Outputs = []string{consts.LogOutput}
+	}
+	if l.Rotation != nil && l.Rotation.MaxSize == 0 {
+		l.Rotation.MaxSize = consts.LogRotationMaxSize
+	}
+	if l.Async != nil {
+		if l.Async.QueueSize == 0 {
+			l.Async.QueueSize = consts.LogQueueSize
+		}
+		setDuration(&l.Async.FlushInterval, consts.LogFlushInterval)
+		if len(l.Async.Policy) == 0 {
+			l.Async.Policy = consts.LogQueuePolicy
+		}
+	}
+	if l.Sampling != nil {
+		if l.Sampling.Initial == 0 {
+			l.Sampling.Initial = consts.LogSamplingInitial
+		}
+		if l.Sampling.Thereafter == 0 {
+			l.Sampling.Thereafter = consts.LogSamplingThereafter
+		}
+	}
+}
+
+func (r *Raft) setDefaults() {
+	def := raft.DefaultConfig()
+
+	setUint16(&r.MaxPool, consts.RaftMaxPool)
+	setUint16(&r.LogCacheSize, consts.RaftLogCacheSize)
+	setUint16(&r.MaxAppendEntries, uint16(def.MaxAppendEntries))
+	if r.SnapShotRetain == 0 {
+		r.SnapShotRetain = consts.RaftSnapShotRetain
+	}
+	if r.SnapshotThreshold == 0 {
+		r.SnapshotThreshold = consts.RaftSnapshotThreshold
+	}
+	if r.TrailingLogs == 0 {
+		r.TrailingLogs = def.TrailingLogs
+	}
+	if len(r.LogLevel) == 0 {
+		r.LogLevel = "info"
+	}
+
+	setDuration(&r.HeartbeatTimeout, def.HeartbeatTimeout)
+	setDuration(&r.ElectionTimeout, def.ElectionTimeout)
+	setDuration(&r.LeaderLeaseTimeout, def.LeaderLeaseTimeout)
+	setDuration(&r.CommitTimeout, def.CommitTimeout)
+	setDuration(&r.SnapshotInterval, def.SnapshotInterval)
+}
+
+// the autopilot settings are in seconds
+func (a *Autopilot) setDefaults() {
+	setUint16(&a.Interval, uint16(consts.AutopilotInterval/time.Second))
+	setUint16(&a.LastContactThreshold, uint16(consts.AutopilotLastContactThreshold/time.Second))
+	setUint16(&a.StableServerThreshold, uint16(consts.AutopilotStableServerThreshold/time.Second))
+	if a.DeadServerThreshold == 0 {
+		a.DeadServerThreshold = uint32(consts.AutopilotDeadServerThreshold / time.Second)
+	}
+	if a.MaxTrailingLogs == 0 {
+		a.MaxTrailingLogs = consts.AutopilotMaxTrailingLogs
+	}
+}
+
+func setUint16(v *uint16, def uint16) {
+	if *v == 0 {
+		*v = def
+	}
+}
+
+func setDuration(d *Duration, def time.Duration) {
+	if *d == 0 {
+		*d = Duration(def)
+	}
+}
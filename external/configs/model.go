@@ -1,31 +1,154 @@
 package configs
 
 import (
-	"encoding/json"
+	"time"
 
 	"github.com/alex60217101990/nietzsche/external/logger"
-
-	"github.com/pkg/errors"
 )
 
+// Conf is the configuration loaded on start, the reloaded
+// ones are published through the Live of the node only.
 var Conf *Configs
 
 type Configs struct {
-	Ver         *string       `yaml:"ver"`
-	ClusterName string        `yaml:"service-name" json:"service_name"`
-	IsDebug     bool          `yaml:"-" json:"-"`
-	Logger      logger.Logger `yaml:"logger" json:"logger"`
-	Server      *Server       `yaml:"http-server" json:"http_server"`
-	DB          *DB           `yaml:"db"`
-	Timeouts    *Timeouts     `yaml:"timeouts"`
-
-	Raft  *Raft  `yaml:"consensus"`
-	Store *Store `yaml:"store" json:"store"`
+	Ver         *string          `yaml:"ver" json:"ver"`
+	ClusterName string           `yaml:"service-name" json:"service_name"`
+	IsDebug     bool             `yaml:"-" json:"-"`
+	Logger      *Logger          `yaml:"logger" json:"logger"`
+	Server      *Server          `yaml:"http-server" json:"http_server"`
+	GRPC        *GRPCServer      `yaml:"grpc-server" json:"grpc_server"`
+	Redis       *RedisServer     `yaml:"redis-server" json:"redis_server"`
+	Memcached   *MemcachedServer `yaml:"memcached-server" json:"memcached_server"`
+	DB          *DB              `yaml:"db" json:"db"`
+	Timeouts    *Timeouts        `yaml:"timeouts" json:"timeouts"`
+
+	Raft       *Raft       `yaml:"consensus" json:"consensus"`
+	Autopilot  *Autopilot  `yaml:"autopilot" json:"autopilot"`
+	Store      *Store      `yaml:"store" json:"store"`
+	Auth       *Auth       `yaml:"auth" json:"auth"`
+	Encryption *Encryption `yaml:"encryption" json:"encryption"`
+}
+
+// Logger configures the log of the node, see logger.Options.
+type Logger struct {
+	Level    string   `yaml:"level" json:"level"`
+	Encoding string   `yaml:"encoding" json:"encoding"`
+	Outputs  []string `yaml:"outputs" json:"outputs"`
+	// Rotation applies to the outputs which are files.
+	Rotation *LogRotation `yaml:"rotation" json:"rotation"`
+	Sampling *LogSampling `yaml:"sampling" json:"sampling"`
+	Async    *LogAsync    `yaml:"async" json:"async"`
+}
+
+// LogRotation sizes are set in megabytes and ages in days.
+type LogRotation struct {
+	MaxSize    uint32 `yaml:"max-size" json:"max_size"`
+	MaxAge     uint16 `yaml:"max-age" json:"max_age"`
+	MaxBackups uint16 `yaml:"max-backups" json:"max_backups"`
+	Compress   bool   `yaml:"compress" json:"compress"`
+}
+
+// LogSampling counts are per second.
+type LogSampling struct {
+	Initial    uint32 `yaml:"initial" json:"initial"`
+	Thereafter uint32 `yaml:"thereafter" json:"thereafter"`
+}
+
+// LogAsync queue policy is block or drop.
+type LogAsync struct {
+	QueueSize     uint32   `yaml:"queue-size" json:"queue_size"`
+	FlushInterval Duration `yaml:"flush-interval" json:"flush_interval"`
+	Policy        string   `yaml:"policy" json:"policy"`
+}
+
+// Options returns the options of the logger built by logger.New.
+func (l *Logger) Options() logger.Options {
+	opts := logger.Options{
+		Level:    l.Level,
+		Encoding: l.Encoding,
+		Outputs:  l.Outputs,
+	}
+	if l.Rotation != nil {
+		opts.Rotation = &logger.Rotation{
+			MaxSize:    int(l.Rotation.MaxSize),
+			MaxAge:     int(l.Rotation.MaxAge),
+			MaxBackups: int(l.Rotation.MaxBackups),
+			Compress:   l.Rotation.Compress,
+		}
+	}
+	if l.Sampling != nil {
+		opts.Sampling = &logger.Sampling{
+			Initial:    int(l.Sampling.Initial),
+			Thereafter: int(l.Sampling.Thereafter),
+		}
+	}
+	if l.Async != nil {
+		opts.Async = &logger.Async{
+			QueueSize:     int(l.Async.QueueSize),
+			FlushInterval: l.Async.FlushInterval.Duration(),
+			Policy:        l.Async.Policy,
+		}
+	}
+	return opts
 }
 
 type Server struct {
-	Host string `yaml:"server-host" json:"server_host"`
-	Port uint16 `yaml:"server-port" json:"server_port"`
+	Host      string `yaml:"server-host" json:"server_host"`
+	Port      uint16 `yaml:"server-port" json:"server_port"`
+	Advertise string `yaml:"advertise-addr" json:"advertise_addr"`
+	// ReadyMaxLag is how many committed entries may wait to be
+	// applied to the store while the node still reports ready.
+	ReadyMaxLag uint64 `yaml:"ready-max-lag" json:"ready_max_lag"`
+}
+
+// GRPCServer serves the gRPC API, it's disabled when the section is missing.
+type GRPCServer struct {
+	Host      string `yaml:"server-host" json:"server_host"`
+	Port      uint16 `yaml:"server-port" json:"server_port"`
+	Advertise string `yaml:"advertise-addr" json:"advertise_addr"`
+}
+
+// RedisServer serves the RESP protocol, it's disabled when the section is missing.
+type RedisServer struct {
+	Host      string `yaml:"server-host" json:"server_host"`
+	Port      uint16 `yaml:"server-port" json:"server_port"`
+	Advertise string `yaml:"advertise-addr" json:"advertise_addr"`
+	// Redirect answers the commands a follower can't serve with MOVED
+	// errors pointing to the leader instead of proxying them to it.
+	Redirect bool `yaml:"redirect" json:"redirect"`
+	// StaleReads lets followers answer reads from their local copy.
+	StaleReads bool `yaml:"stale-reads" json:"stale_reads"`
+}
+
+// MemcachedServer serves the memcached text protocol, it's disabled
+// when the section is missing. Followers proxy the commands to the leader.
+type MemcachedServer struct {
+	Host      string `yaml:"server-host" json:"server_host"`
+	Port      uint16 `yaml:"server-port" json:"server_port"`
+	Advertise string `yaml:"advertise-addr" json:"advertise_addr"`
+}
+
+// Auth enables authentication and role-based access control,
+// everyone can use every API while the section is missing.
+type Auth struct {
+	// RootPassword is set for the root user when the cluster has none
+	// yet. Nodes joining the cluster without a join token authenticate
+	// with it, it's sent to https join addresses only.
+	RootPassword Secret `yaml:"root-password" json:"root_password"`
+	// JoinToken authenticates the nodes joining the cluster, it lets them
+	// add themselves and nothing else. Every server needs the same one.
+	JoinToken Secret `yaml:"join-token" json:"join_token"`
+	// TokenTTL is how long the issued tokens are valid.
+	TokenTTL Duration `yaml:"token-ttl" json:"token_ttl"`
+}
+
+// Encryption encrypts the stored values and the snapshots with the keys of
+// the keyfile, the data is kept in clear while the section is missing.
+type Encryption struct {
+	// KeyFile holds a "<key id> <base64 AES-256 key>" line per key, the last
+	// one encrypts the new data. Snapshots are restored on other servers,
+	// so every server of the cluster needs the same keys.
+	KeyFile string `yaml:"key-file" json:"key_file"`
 }
 
 type Store struct {
@@ -35,210 +158,38 @@ type Store struct {
 	UseStreamDataCompression bool      `yaml:"use-compression" json:"use_compression"`
 }
 
-func (s *Store) MarshalJSON() ([]byte, error) {
-	type alias struct {
-		StoreType  string `json:"store_type"`
-		DbName     string `json:"db_name"`
-		BucketName string `json:"bucket_name"`
-	}
-	if s == nil {
-		s = &Store{}
-	}
-	return json.Marshal(alias{
-		StoreType:  s.StoreType.String(),
-		DbName:     s.DbName,
-		BucketName: s.BucketName,
-	})
-}
-
-func (s *Store) UnmarshalJSON(data []byte) (err error) {
-	type alias struct {
-		StoreType  string `json:"store_type"`
-		DbName     string `json:"db_name"`
-		BucketName string `json:"bucket_name"`
-	}
-	var tmp alias
-	if err = json.Unmarshal(data, &tmp); err != nil {
-		return err
-	}
-
-	if s == nil {
-		s = &Store{}
-	}
-
-	err = s.StoreType.Set(tmp.StoreType)
-	if err != nil {
-		return errors.WithMessagef(err, "failed to parse '%s'", tmp.StoreType)
-	}
-
-	s.BucketName = tmp.BucketName
-	s.DbName = tmp.DbName
-
-	return nil
-}
-
-func (s *Store) MarshalYAML() (interface{}, error) {
-	type alias struct {
-		StoreType  string `json:"store-type"`
-		DbName     string `json:"db-name"`
-		BucketName string `json:"bucket-name"`
-	}
-	if s == nil {
-		s = &Store{}
-	}
-	return alias{
-		StoreType:  s.StoreType.String(),
-		BucketName: s.BucketName,
-		DbName:     s.DbName,
-	}, nil
-}
-
-func (s *Store) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	type alias struct {
-		StoreType  string `json:"store-type"`
-		DbName     string `json:"db-name"`
-		BucketName string `json:"bucket-name"`
-	}
-	var tmp alias
-	if err := unmarshal(&tmp); err != nil {
-		return err
-	}
-
-	if s == nil {
-		s = &Store{}
-	}
-
-	err := s.StoreType.Set(tmp.StoreType)
-	if err != nil {
-		return errors.WithMessagef(err, "failed to parse '%s'", tmp.StoreType)
-	}
-
-	s.BucketName = tmp.BucketName
-	s.DbName = tmp.DbName
-
-	return nil
-}
-
 type DB struct {
 	RepoType RepoType `yaml:"db-type" json:"db_type"`
 	Host     string   `yaml:"db-host" json:"db_host"`
 	UserName string   `yaml:"db-user" json:"db_user"`
-	Password string   `yaml:"db-password" json:"db_password"`
+	Password Secret   `yaml:"db-password" json:"db_password"`
 	Port     uint16   `yaml:"db-port" json:"db_port"`
 	DbName   string   `yaml:"db-name" json:"db_name"`
 }
 
-func (db *DB) MarshalJSON() ([]byte, error) {
-	type alias struct {
-		RepoType string `json:"db_type"`
-		Host     string `json:"db_host"`
-		UserName string `json:"db_user"`
-		Password string `json:"db_password"`
-		Port     uint16 `json:"db_port"`
-		DbName   string `json:"db_name"`
-	}
-	if db == nil {
-		db = &DB{}
-	}
-	return json.Marshal(alias{
-		RepoType: db.RepoType.String(),
-		Host:     db.Host,
-		UserName: db.UserName,
-		Password: db.Password,
-		Port:     db.Port,
-		DbName:   db.DbName,
-	})
-}
-
-func (db *DB) UnmarshalJSON(data []byte) (err error) {
-	type alias struct {
-		RepoType string `json:"db_type"`
-		Host     string `json:"db_host"`
-		UserName string `json:"db_user"`
-		Password string `json:"db_password"`
-		Port     uint16 `json:"db_port"`
-		DbName   string `json:"db_name"`
-	}
-	var tmp alias
-	if err = json.Unmarshal(data, &tmp); err != nil {
-		return err
-	}
-
-	if db == nil {
-		db = &DB{}
-	}
-
-	err = db.RepoType.Set(tmp.RepoType)
-	if err != nil {
-		return errors.WithMessagef(err, "failed to parse '%s'", tmp.RepoType)
-	}
-
-	db.Host = tmp.Host
-	db.UserName = tmp.UserName
-	db.Password = tmp.Password
-	db.Port = tmp.Port
-	db.DbName = tmp.DbName
-
-	return nil
+type Timeouts struct {
+	DefaultTimeout      uint8 `yaml:"default-timeout" json:"default_timeout"`
+	DefaultStoreTimeout uint8 `yaml:"default-store-timeout" json:"default_store_timeout"`
 }
 
-func (db *DB) MarshalYAML() (interface{}, error) {
-	type alias struct {
-		RepoType string `yaml:"db-type"`
-		Host     string `yaml:"db-host"`
-		UserName string `yaml:"db-user"`
-		Password string `yaml:"db-password"`
-		Port     uint16 `yaml:"db-port"`
-		DbName   string `yaml:"db-name"`
-	}
-	if db == nil {
-		db = &DB{}
-	}
-	return alias{
-		RepoType: db.RepoType.String(),
-		Host:     db.Host,
-		UserName: db.UserName,
-		Password: db.Password,
-		Port:     db.Port,
-		DbName:   db.DbName,
-	}, nil
+// Timeout is the time limit of the requests to the cluster.
+func (t *Timeouts) Timeout() time.Duration {
+	return time.Duration(t.DefaultTimeout) * time.Second
 }
 
-func (db *DB) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	type alias struct {
-		RepoType string `yaml:"db-type"`
-		Host     string `yaml:"db-host"`
-		UserName string `yaml:"db-user"`
-		Password string `yaml:"db-password"`
-		Port     uint16 `yaml:"db-port"`
-		DbName   string `yaml:"db-name"`
-	}
-	var tmp alias
-	if err := unmarshal(&tmp); err != nil {
-		return err
-	}
-
-	if db == nil {
-		db = &DB{}
-	}
-
-	err := db.RepoType.Set(tmp.RepoType)
-	if err != nil {
-		return errors.WithMessagef(err, "failed to parse '%s'", tmp.RepoType)
-	}
-
-	db.Host = tmp.Host
-	db.UserName = tmp.UserName
-	db.Password = tmp.Password
-	db.Port = tmp.Port
-	db.DbName = tmp.DbName
-
-	return nil
+// StoreTimeout is the time limit of opening the data file.
+func (t *Timeouts) StoreTimeout() time.Duration {
+	return time.Duration(t.DefaultStoreTimeout) * time.Second
 }
 
-type Timeouts struct {
-	DefaultTimeout      uint8 `yaml:"default-timeout" json:"default_timeout"`
-	DefaultStoreTimeout uint8 `yaml:"default-store-timeout" json:"default_store_timeout"`
+// Autopilot thresholds are set in seconds.
+type Autopilot struct {
+	CleanupDeadServers    bool   `yaml:"cleanup-dead-servers" json:"cleanup_dead_servers"`
+	DeadServerThreshold   uint32 `yaml:"dead-server-threshold" json:"dead_server_threshold"`
+	LastContactThreshold  uint16 `yaml:"last-contact-threshold" json:"last_contact_threshold"`
+	MaxTrailingLogs       uint64 `yaml:"max-trailing-logs" json:"max_trailing_logs"`
+	StableServerThreshold uint16 `yaml:"stable-server-threshold" json:"stable_server_threshold"`
+	Interval              uint16 `yaml:"interval" json:"interval"`
 }
 
 type Raft struct {
@@ -249,120 +200,18 @@ type Raft struct {
 	MaxPool        uint16            `yaml:"max-pool"  json:"max_pool"`
 	Transport      RaftTransportType `yaml:"transport-type"  json:"transport_type"`
 	SnapShotRetain uint8             `yaml:"snap-shot-retain" json:"snap_shot_retain"`
-}
-
-func (r *Raft) MarshalJSON() ([]byte, error) {
-	type alias struct {
-		LogCacheSize   uint16 `json:"log_cache_size"`
-		VolumeDir      string `json:"volume_dir"`
-		NodeID         string `json:"node_id"`
-		Port           uint16 `json:"port"`
-		MaxPool        uint16 `json:"max_pool"`
-		Transport      string `json:"transport_type"`
-		SnapShotRetain uint8  `json:"snap_shot_retain"`
-	}
-	if r == nil {
-		r = &Raft{}
-	}
-	return json.Marshal(alias{
-		Transport:      r.Transport.String(),
-		LogCacheSize:   r.LogCacheSize,
-		VolumeDir:      r.VolumeDir,
-		NodeID:         r.NodeID,
-		Port:           r.Port,
-		MaxPool:        r.MaxPool,
-		SnapShotRetain: r.SnapShotRetain,
-	})
-}
-
-func (r *Raft) UnmarshalJSON(data []byte) (err error) {
-	type alias struct {
-		LogCacheSize   uint16 `json:"log_cache_size"`
-		VolumeDir      string `json:"volume_dir"`
-		NodeID         string `json:"node_id"`
-		Port           uint16 `json:"port"`
-		MaxPool        uint16 `json:"max_pool"`
-		Transport      string `json:"transport_type"`
-		SnapShotRetain uint8  `json:"snap_shot_retain"`
-	}
-	var tmp alias
-	if err = json.Unmarshal(data, &tmp); err != nil {
-		return err
-	}
-
-	if r == nil {
-		r = &Raft{}
-	}
-
-	err = r.Transport.Set(tmp.Transport)
-	if err != nil {
-		return errors.WithMessagef(err, "failed to parse '%s'", tmp.Transport)
-	}
-
-	r.LogCacheSize = tmp.LogCacheSize
-	r.VolumeDir = tmp.VolumeDir
-	r.NodeID = tmp.NodeID
-	r.Port = tmp.Port
-	r.MaxPool = tmp.MaxPool
-	r.SnapShotRetain = tmp.SnapShotRetain
-
-	return nil
-}
-
-func (r *Raft) MarshalYAML() (interface{}, error) {
-	type alias struct {
-		LogCacheSize   uint16 `yaml:"log-cache-size"`
-		VolumeDir      string `yaml:"volume-dir"`
-		NodeID         string `yaml:"node-id"`
-		Port           uint16 `yaml:"port"`
-		MaxPool        uint16 `yaml:"max-pool"`
-		Transport      string `yaml:"transport-type"`
-		SnapShotRetain uint8  `yaml:"snap-shot-retain"`
-	}
-	if r == nil {
-		r = &Raft{}
-	}
-	return alias{
-		Transport:      r.Transport.String(),
-		LogCacheSize:   r.LogCacheSize,
-		VolumeDir:      r.VolumeDir,
-		NodeID:         r.NodeID,
-		Port:           r.Port,
-		MaxPool:        r.MaxPool,
-		SnapShotRetain: r.SnapShotRetain,
-	}, nil
-}
-
-func (r *Raft) UnmarshalYAML(unmarshal func(interface{}) error) error {
-	type alias struct {
-		LogCacheSize   uint16 `yaml:"log-cache-size"`
-		VolumeDir      string `yaml:"volume-dir"`
-		NodeID         string `yaml:"node-id"`
-		Port           uint16 `yaml:"port"`
-		MaxPool        uint16 `yaml:"max-pool"`
-		Transport      string `yaml:"transport-type"`
-		SnapShotRetain uint8  `yaml:"snap-shot-retain"`
-	}
-	var tmp alias
-	if err := unmarshal(&tmp); err != nil {
-		return err
-	}
-
-	if r == nil {
-		r = &Raft{}
-	}
-
-	err := r.Transport.Set(tmp.Transport)
-	if err != nil {
-		return errors.WithMessagef(err, "failed to parse '%s'", tmp.Transport)
-	}
-
-	r.LogCacheSize = tmp.LogCacheSize
-	r.VolumeDir = tmp.VolumeDir
-	r.NodeID = tmp.NodeID
-	r.Port = tmp.Port
-	r.MaxPool = tmp.MaxPool
-	r.SnapShotRetain = tmp.SnapShotRetain
-
-	return nil
+	Advertise      string            `yaml:"advertise-addr" json:"advertise_addr"`
+	Bootstrap      bool              `yaml:"bootstrap" json:"bootstrap"`
+	Suffrage       Suffrage          `yaml:"suffrage" json:"suffrage"`
+	Join           []string          `yaml:"join" json:"join"`
+
+	HeartbeatTimeout   Duration `yaml:"heartbeat-timeout" json:"heartbeat_timeout"`
+	ElectionTimeout    Duration `yaml:"election-timeout" json:"election_timeout"`
+	LeaderLeaseTimeout Duration `yaml:"leader-lease-timeout" json:"leader_lease_timeout"`
+	CommitTimeout      Duration `yaml:"commit-timeout" json:"commit_timeout"`
+	SnapshotInterval   Duration `yaml:"snapshot-interval" json:"snapshot_interval"`
+	SnapshotThreshold  uint64   `yaml:"snapshot-threshold" json:"snapshot_threshold"`
+	TrailingLogs       uint64   `yaml:"trailing-logs" json:"trailing_logs"`
+	MaxAppendEntries   uint16   `yaml:"max-append-entries" json:"max_append_entries"`
+	LogLevel           string   `yaml:"log-level" json:"log_level"`
 }
@@ -0,0 +1,201 @@
+package configs
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix starts the names of the environment variables overriding the config.
+const EnvPrefix = "NIETZSCHE_"
+
+// Overrides are values of the config fields keyed by their path
+// in the config file, like "consensus.node-id".
+//
+// The settings are taken, from the lowest precedence to the highest,
+// from the defaults, the config file, the environment variables and
+// the flags of the command line.
+type Overrides map[string]string
+
+// configField is a leaf of the config, its path is made of the yaml keys.
+type configField struct {
+	path  string
+	index []int
+	typ   reflect.Type
+}
+
+var configFields = fieldsOf(reflect.TypeOf(Configs{}), "", nil)
+
+// settable is implemented by the enums and the durations.
+type settable interface {
+	Set(val string) error
+}
+
+var settableType = reflect.TypeOf((*settable)(nil)).Elem()
+
+func fieldsOf(t reflect.Type, prefix string, index []int) (fields []configField) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+		if len(name) == 0 || name == "-" || f.PkgPath != "" {
+			continue
+		}
+
+		path := prefix + name
+		idx := append(append([]int{}, index...), i)
+
+		typ := f.Type
+		if typ.Kind() == reflect.Ptr {
+			typ = typ.Elem()
+		}
+		switch {
+		case reflect.PtrTo(typ).Implements(settableType):
+			fields = append(fields, configField{path: path, index: idx, typ: typ})
+		case typ.Kind() == reflect.Struct:
+			fields = append(fields, fieldsOf(typ, path+".", idx)...)
+		default:
+			fields = append(fields, configField{path: path, index: idx, typ: typ})
+		}
+	}
+	return fields
+}
+
+// EnvName returns the environment variable overriding the field at the path.
+func EnvName(path string) string {
+	return EnvPrefix + strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(path))
+}
+
+// EnvOverrides returns the overrides set by the NIETZSCHE_
+// environment variables, environ is like os.Environ.
+func EnvOverrides(environ []string) Overrides {
+	env := make(map[string]string, len(environ))
+	for _, kv := range environ {
+		if eq := strings.IndexByte(kv, '='); eq > 0 {
+			env[kv[:eq]] = kv[eq+1:]
+		}
+	}
+
+	o := make(Overrides)
+	for _, f := range configFields {
+		if value, ok := env[EnvName(f.path)]; ok {
+			o[f.path] = value
+		}
+	}
+	return o
+}
+
+// overrideFlag keeps the value of the flag in the overrides.
+type overrideFlag struct {
+	o       Overrides
+	path    string
+	boolean bool
+}
+
+// IsBoolFlag lets the boolean fields be set by the flag name alone.
+func (f overrideFlag) IsBoolFlag() bool {
+	return f.boolean
+}
+
+func (f overrideFlag) String() string {
+	if f.o == nil {
+		return ""
+	}
+	return f.o[f.path]
+}
+
+func (f overrideFlag) Set(val string) error {
+	f.o[f.path] = val
+	return nil
+}
+
+// RegisterFlags adds a flag named after its path for every field
+// of the config, the values set on the command line are put into o.
+func (o Overrides) RegisterFlags(fs *flag.FlagSet) {
+	for _, f := range configFields {
+		fs.Var(overrideFlag{o: o, path: f.path, boolean: f.typ.Kind() == reflect.Bool}, f.path,
+			fmt.Sprintf("overrides %s of the config file and %s", f.path, EnvName(f.path)))
+	}
+}
+
+// Apply sets the fields of the overrides, the sections missing
+// from the config file are created.
+func (c *Configs) Apply(o Overrides) error {
+	var errs ValidationErrors
+	for _, f := range configFields {
+		val, ok := o[f.path]
+		if !ok {
+			continue
+		}
+
+		if err := setField(reflect.ValueOf(c).Elem(), f, val); err != nil {
+			errs = append(errs, FieldError{Path: f.path, Message: fmt.Sprintf("invalid value %q, %v", val, err)})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func setField(v reflect.Value, f configField, val string) error {
+	for _, i := range f.index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+
+	if s, ok := v.Addr().Interface().(settable); ok {
+		return s.Set(val)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return fmt.Errorf("expected true or false")
+		}
+		v.SetBool(b)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(val, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected an integer between 0 and %d", uint64(1)<<uint(v.Type().Bits())-1)
+		}
+		v.SetUint(n)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(val, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("expected an integer")
+		}
+		v.SetInt(n)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		// the lists are comma separated
+		items := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, item := range strings.Split(val, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				items = reflect.Append(items, reflect.ValueOf(item))
+			}
+		}
+		v.Set(items)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package configs
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	"gopkg.in/yaml.v3"
 )
@@ -83,3 +84,13 @@ func (rt *RaftTransportType) Set(val string) error {
 func (rt RaftTransportType) String() string {
 	return _RaftTransportTypeValueToName[rt]
 }
+
+// names lists the accepted values, for the config schema.
+func (rt RaftTransportType) names() []string {
+	names := make([]string, 0, len(_RaftTransportTypeNameToValue))
+	for name := range _RaftTransportTypeNameToValue {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
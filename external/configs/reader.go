@@ -1,33 +1,121 @@
 package configs
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"gopkg.in/yaml.v2"
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
 )
 
+// ReadConfigFile loads the config file into Conf and validates it.
+// The format of the file is told by its extension, see decodeConfig.
 func ReadConfigFile(file string) (err error) {
+	if Conf, err = readConfigFile(file); err != nil {
+		return err
+	}
+	if Conf == nil {
+		Conf = &Configs{}
+	}
+	if err = Conf.ResolveSecrets(); err != nil {
+		return err
+	}
+
+	Conf.SetDefaults()
+	return Conf.Validate()
+}
+
+// LoadConfig loads the config file into Conf, overrides it with the
+// NIETZSCHE_ environment variables and then with the flags, fills the
+// settings left unset with the defaults and validates the result.
+// The file is optional when its path is empty.
+func LoadConfig(file string, flags Overrides) (err error) {
+	conf, err := Load(file, flags)
+	if err != nil {
+		return err
+	}
+
+	Conf = conf
+	return nil
+}
+
+// Load reads the configuration like LoadConfig, leaving Conf untouched.
+func Load(file string, flags Overrides) (conf *Configs, err error) {
+	if len(file) > 0 {
+		if conf, err = readConfigFile(file); err != nil {
+			return nil, err
+		}
+	}
+	if conf == nil {
+		conf = &Configs{}
+	}
+
+	// the problems of both sources are reported at once
+	var errs ValidationErrors
+	for _, o := range []Overrides{EnvOverrides(os.Environ()), flags} {
+		if err, ok := conf.Apply(o).(ValidationErrors); ok {
+			errs = append(errs, err...)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if err = conf.ResolveSecrets(); err != nil {
+		return nil, err
+	}
+
+	conf.SetDefaults()
+	if err = conf.Validate(); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+func readConfigFile(file string) (conf *Configs, err error) {
 	var yamlFile []byte
 	_, err = os.Stat(file)
 	if os.IsNotExist(err) && err != nil {
 		file, err = filepath.EvalSymlinks(file)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		yamlFile, err = ioutil.ReadFile(file)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		err = yaml.Unmarshal(yamlFile, &Conf)
-		return err
+		return decodeConfig(file, yamlFile)
 	}
 
 	yamlFile, err = ioutil.ReadFile(file)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	return decodeConfig(file, yamlFile)
+}
+
+// decodeConfig reads the config in the format told by the extension of the
+// file: ".json" files use the JSON keys of the fields, ".toml" files use the
+// YAML keys like the other files, which are read as YAML.
+func decodeConfig(file string, data []byte) (conf *Configs, err error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".json":
+		err = json.Unmarshal(data, &conf)
+	case ".toml":
+		// the document is converted, so the fields are read
+		// by their YAML (un)marshalers in both formats
+		var doc map[string]interface{}
+		if err = toml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		if data, err = yaml.Marshal(doc); err != nil {
+			return nil, err
+		}
+		err = yaml.Unmarshal(data, &conf)
+	default:
+		err = yaml.Unmarshal(data, &conf)
 	}
-	err = yaml.Unmarshal(yamlFile, &Conf)
-	return err
+	return conf, err
 }
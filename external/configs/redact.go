@@ -0,0 +1,38 @@
+package configs
+
+import (
+	"reflect"
+)
+
+const redacted = "<redacted>"
+
+// Redacted returns a copy of the configuration with the values of the
+// secrets replaced, so it can be shown or logged. The references are kept.
+func (c *Configs) Redacted() *Configs {
+	clone := *c
+	for _, f := range configFields {
+		if f.typ != secretType {
+			continue
+		}
+
+		// the sections on the way are copied, the original ones are shared
+		v := reflect.ValueOf(&clone).Elem()
+		for _, i := range f.index {
+			if v.Kind() == reflect.Ptr {
+				if v.IsNil() {
+					break
+				}
+				section := reflect.New(v.Type().Elem())
+				section.Elem().Set(v.Elem())
+				v.Set(section)
+				v = section.Elem()
+			}
+			v = v.Field(i)
+		}
+
+		if v.IsValid() && v.Type() == secretType {
+			v.Set(reflect.ValueOf(v.Interface().(Secret).redacted()))
+		}
+	}
+	return &clone
+}
@@ -0,0 +1,216 @@
+package configs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrRestartRequired = errors.New("the changed settings are applied on restart only")
+)
+
+// reloadablePaths are the settings read by the running components each
+// time they are used, so they're applied without a restart. The sections
+// are never enabled or disabled on reload.
+var reloadablePaths = []string{
+	"timeouts.default-timeout",
+	"logger.level",
+	"store.use-compression",
+	"consensus.log-level",
+	"auth.root-password",
+	"auth.join-token",
+	"auth.token-ttl",
+	"autopilot.cleanup-dead-servers",
+	"autopilot.dead-server-threshold",
+	"autopilot.last-contact-threshold",
+	"autopilot.max-trailing-logs",
+	"autopilot.stable-server-threshold",
+	"http-server.ready-max-lag",
+	"redis-server.redirect",
+	"redis-server.stale-reads",
+}
+
+// Change is a setting which differs between the running
+// configuration and the reloaded one.
+type Change struct {
+	Path       string `json:"path"`
+	Old        string `json:"old"`
+	New        string `json:"new"`
+	Reloadable bool   `json:"reloadable"`
+}
+
+func (c Change) String() string {
+	s := fmt.Sprintf("%s: %q -> %q", c.Path, c.Old, c.New)
+	if c.Old == c.New {
+		// the secret the reference points to has changed
+		s = fmt.Sprintf("%s: %q points to a new secret", c.Path, c.Old)
+	}
+	if !c.Reloadable {
+		s += " (restart required)"
+	}
+	return s
+}
+
+func reloadable(path string) bool {
+	for _, p := range reloadablePaths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// lookup returns the value of the field, it's invalid when its section is missing.
+func lookup(c *Configs, f configField) (v reflect.Value, section string) {
+	v = reflect.ValueOf(c).Elem()
+	for depth, i := range f.index {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, strings.Join(strings.Split(f.path, ".")[:depth], ".")
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	return v, ""
+}
+
+func format(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	// the secrets print their references only
+	return fmt.Sprint(v.Interface())
+}
+
+// Diff lists the settings of next which differ from c, a section which
+// is added or removed is reported once by its path.
+func (c *Configs) Diff(next *Configs) (changes []Change) {
+	sections := make(map[string]bool)
+	for _, f := range configFields {
+		old, oldSection := lookup(c, f)
+		cur, newSection := lookup(next, f)
+
+		if old.IsValid() != cur.IsValid() {
+			section := oldSection + newSection
+			if !sections[section] {
+				sections[section] = true
+				change := Change{Path: section, Old: "<set>", New: "<none>"}
+				if cur.IsValid() {
+					change.Old, change.New = change.New, change.Old
+				}
+				changes = append(changes, change)
+			}
+			continue
+		}
+		if !old.IsValid() || reflect.DeepEqual(old.Interface(), cur.Interface()) {
+			continue
+		}
+
+		changes = append(changes, Change{
+			Path:       f.path,
+			Old:        format(old),
+			New:        format(cur),
+			Reloadable: reloadable(f.path),
+		})
+	}
+	return changes
+}
+
+// Live is the running configuration shared by the components. The
+// configurations it holds are never modified, Reload replaces the whole
+// configuration, so the readers see either the old settings or the new ones.
+type Live struct {
+	v atomic.Value
+	// serializes the reloads
+	mu sync.Mutex
+}
+
+func NewLive(c *Configs) *Live {
+	l := &Live{}
+	l.v.Store(c)
+	return l
+}
+
+// Load returns the running configuration, it must not be modified.
+func (l *Live) Load() *Configs {
+	return l.v.Load().(*Configs)
+}
+
+// Reload loads the configuration like Load and replaces the running one
+// with it. Nothing is replaced when the new configuration is invalid or
+// changes a setting which needs a restart, ErrRestartRequired is
+// returned with the changes then.
+func (l *Live) Reload(file string, flags Overrides) ([]Change, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	next, err := Load(file, flags)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := l.Load().Diff(next)
+	for _, change := range changes {
+		if !change.Reloadable {
+			return changes, ErrRestartRequired
+		}
+	}
+
+	if len(changes) > 0 {
+		l.v.Store(next)
+	}
+	return changes, nil
+}
+
+// Watch reports the changes of the file, it's checked at the interval until
+// the stop channel is closed. Editors replacing the file are handled as well.
+func Watch(file string, interval time.Duration, stop <-chan struct{}) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+
+	stat := func() (time.Time, int64) {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, -1
+		}
+		return info.ModTime(), info.Size()
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		modTime, size := stat()
+		for {
+			select {
+			case <-ticker.C:
+				t, s := stat()
+				if t.Equal(modTime) && s == size {
+					continue
+				}
+				modTime, size = t, s
+
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	return changed
+}
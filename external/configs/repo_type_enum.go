@@ -3,6 +3,7 @@ package configs
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	"gopkg.in/yaml.v3"
 )
@@ -81,3 +82,13 @@ func (rt *RepoType) Set(val string) error {
 func (rt RepoType) String() string {
 	return _RepoTypeValueToName[rt]
 }
+
+// names lists the accepted values, for the config schema.
+func (rt RepoType) names() []string {
+	names := make([]string, 0, len(_RepoTypeNameToValue))
+	for name := range _RepoTypeNameToValue {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
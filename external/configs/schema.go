@@ -0,0 +1,111 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// schemaDraft is the JSON Schema version of the generated schema.
+const schemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// enum is implemented by the enums, they are written by their names.
+type enum interface {
+	names() []string
+}
+
+var (
+	enumType     = reflect.TypeOf((*enum)(nil)).Elem()
+	durationType = reflect.TypeOf(Duration(0))
+)
+
+// Schema returns the JSON Schema of the config files, format is "yaml",
+// "toml" or "json". The YAML and TOML files share their keys.
+func Schema(format string) ([]byte, error) {
+	var tag string
+	switch format {
+	case "yaml", "toml":
+		tag = "yaml"
+	case "json":
+		tag = "json"
+	default:
+		return nil, fmt.Errorf("unknown config format %q, expected yaml, toml or json", format)
+	}
+
+	schema := typeSchema(reflect.TypeOf(Configs{}), tag)
+	schema["$schema"] = schemaDraft
+	schema["title"] = "nietzsche configuration"
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// typeSchema describes the values of the type, the
+// fields of the structs are named by the tag.
+func typeSchema(t reflect.Type, tag string) map[string]interface{} {
+	// the sections are pointers, they may be left empty
+	var nullable bool
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = t.Kind() == reflect.Struct
+	}
+
+	switch {
+	case t.Implements(enumType):
+		return map[string]interface{}{
+			"type": "string",
+			"enum": reflect.Zero(t).Interface().(enum).names(),
+		}
+	case t == durationType:
+		return map[string]interface{}{
+			"type":        "string",
+			"pattern":     `^(0|-?([0-9]*(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+)$`,
+			"description": `a duration like "500ms", "2s" or "1m30s"`,
+		}
+	case t == secretType:
+		return map[string]interface{}{
+			"type":        "string",
+			"description": `the secret or a reference to it, like "file:///run/secrets/password" or "env://PASSWORD"`,
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		properties := make(map[string]interface{})
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name := strings.Split(f.Tag.Get(tag), ",")[0]
+			if len(name) == 0 || name == "-" || f.PkgPath != "" {
+				continue
+			}
+			properties[name] = typeSchema(f.Type, tag)
+		}
+		typ := interface{}("object")
+		if nullable {
+			typ = []string{"object", "null"}
+		}
+		return map[string]interface{}{
+			"type":                 typ,
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+	case reflect.Slice:
+		return map[string]interface{}{
+			"type":  "array",
+			"items": typeSchema(t.Elem(), tag),
+		}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{
+			"type":    "integer",
+			"minimum": 0,
+			"maximum": uint64(1)<<uint(t.Bits()) - 1,
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	default:
+		return map[string]interface{}{}
+	}
+}
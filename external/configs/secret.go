@@ -0,0 +1,212 @@
+package configs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrUnknownSecretProvider = errors.New("unknown secret provider")
+	ErrSecretNotFound        = errors.New("secret not found")
+)
+
+// SecretProvider looks up the secrets referenced as "<scheme>://<name>"
+// in the config, like "vault://kv/nietzsche#root". It gets the part
+// after "://", the secret is read again on each config reload.
+type SecretProvider interface {
+	Secret(name string) (string, error)
+}
+
+// SecretProviderFunc adapts a function to the SecretProvider interface.
+type SecretProviderFunc func(name string) (string, error)
+
+func (f SecretProviderFunc) Secret(name string) (string, error) {
+	return f(name)
+}
+
+var secretProviders = struct {
+	sync.RWMutex
+	m map[string]SecretProvider
+}{
+	m: map[string]SecretProvider{
+		"file": SecretProviderFunc(fileSecret),
+		"env":  SecretProviderFunc(envSecret),
+	},
+}
+
+// RegisterSecretProvider makes the references with the scheme be looked up
+// by the provider, it replaces the provider registered for the scheme before.
+func RegisterSecretProvider(scheme string, p SecretProvider) {
+	secretProviders.Lock()
+	defer secretProviders.Unlock()
+	secretProviders.m[scheme] = p
+}
+
+func secretProvider(scheme string) (SecretProvider, bool) {
+	secretProviders.RLock()
+	defer secretProviders.RUnlock()
+	p, ok := secretProviders.m[scheme]
+	return p, ok
+}
+
+// fileSecret reads the secret from the file, the
+// line break editors put at the end is dropped.
+func fileSecret(name string) (string, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+func envSecret(name string) (string, error) {
+	value, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("%w: the %s environment variable is not set", ErrSecretNotFound, name)
+	}
+	return value, nil
+}
+
+// Secret is a setting like a password, it's written in the config either
+// inline or as a reference, like "file:///run/secrets/root" or
+// "env://ROOT_PASSWORD". The value is never printed, the references are.
+type Secret struct {
+	ref   string
+	value string
+}
+
+var secretType = reflect.TypeOf(Secret{})
+
+// NewSecret returns an inline secret.
+func NewSecret(value string) Secret {
+	return Secret{value: value}
+}
+
+// Value returns the secret, the references are resolved when the config is loaded.
+func (s Secret) Value() string {
+	return s.value
+}
+
+func (s Secret) IsZero() bool {
+	return len(s.ref) == 0 && len(s.value) == 0
+}
+
+// String returns the reference, the inline secrets are redacted.
+func (s Secret) String() string {
+	if len(s.ref) > 0 {
+		return s.ref
+	}
+	if len(s.value) > 0 {
+		return redacted
+	}
+	return ""
+}
+
+// redacted drops the value, only the reference is kept.
+func (s Secret) redacted() Secret {
+	if len(s.ref) > 0 {
+		return Secret{ref: s.ref}
+	}
+	if len(s.value) > 0 {
+		return Secret{value: redacted}
+	}
+	return s
+}
+
+// scheme returns the scheme of the reference, empty for the inline secrets.
+func scheme(val string) string {
+	i := strings.Index(val, "://")
+	if i <= 0 {
+		return ""
+	}
+	for _, r := range val[:i] {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.') {
+			return ""
+		}
+	}
+	return val[:i]
+}
+
+// resolve looks the reference up, the inline secrets are kept.
+func (s *Secret) resolve() error {
+	if len(s.ref) == 0 {
+		return nil
+	}
+
+	sch := scheme(s.ref)
+	p, ok := secretProvider(sch)
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownSecretProvider, sch)
+	}
+
+	value, err := p.Secret(s.ref[len(sch)+len("://"):])
+	if err != nil {
+		return err
+	}
+	s.value = value
+	return nil
+}
+
+// it's for using with flag package
+func (s *Secret) Set(val string) error {
+	if len(scheme(val)) > 0 {
+		*s = Secret{ref: val}
+	} else {
+		*s = Secret{value: val}
+	}
+	return nil
+}
+
+func (s Secret) MarshalYAML() (interface{}, error) {
+	return s.String(), nil
+}
+
+func (s *Secret) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var val string
+	if err := unmarshal(&val); err != nil {
+		return err
+	}
+	return s.Set(val)
+}
+
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+func (s *Secret) UnmarshalJSON(data []byte) error {
+	var val string
+	if err := json.Unmarshal(data, &val); err != nil {
+		return fmt.Errorf("Secret should be a string, got %s", data)
+	}
+	return s.Set(val)
+}
+
+// ResolveSecrets looks up the referenced secrets of the
+// configuration, the problems are returned as ValidationErrors.
+func (c *Configs) ResolveSecrets() error {
+	var errs ValidationErrors
+	for _, f := range configFields {
+		if f.typ != secretType {
+			continue
+		}
+
+		v, _ := lookup(c, f)
+		if !v.IsValid() {
+			continue
+		}
+		if err := v.Addr().Interface().(*Secret).resolve(); err != nil {
+			errs = append(errs, FieldError{Path: f.path, Message: err.Error()})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
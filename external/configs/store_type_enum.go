@@ -3,6 +3,7 @@ package configs
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 
 	"gopkg.in/yaml.v3"
 )
@@ -85,3 +86,13 @@ func (st *StoreType) Set(val string) error {
 func (st StoreType) String() string {
 	return _StoreTypeValueToName[st]
 }
+
+// names lists the accepted values, for the config schema.
+func (st StoreType) names() []string {
+	names := make([]string, 0, len(_StoreTypeNameToValue))
+	for name := range _StoreTypeNameToValue {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,96 @@
+package configs
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+type Suffrage uint8
+
+const (
+	Voter Suffrage = iota
+	Nonvoter
+)
+
+var (
+	_SuffrageNameToValue = map[string]Suffrage{
+		"voter":    Voter,
+		"nonvoter": Nonvoter,
+	}
+
+	_SuffrageValueToName = map[Suffrage]string{
+		Voter:    "voter",
+		Nonvoter: "nonvoter",
+	}
+)
+
+func (sf Suffrage) MarshalYAML() (interface{}, error) {
+	s, ok := _SuffrageValueToName[sf]
+	if !ok {
+		return nil, fmt.Errorf("invalid Suffrage: %d", sf)
+	}
+	return s, nil
+}
+
+func (sf *Suffrage) UnmarshalYAML(value *yaml.Node) error {
+	v, ok := _SuffrageNameToValue[value.Value]
+	if !ok {
+		return fmt.Errorf("invalid Suffrage %q", value.Value)
+	}
+	*sf = v
+	return nil
+}
+
+func (sf Suffrage) MarshalJSON() ([]byte, error) {
+	if s, ok := interface{}(sf).(fmt.Stringer); ok {
+		return json.Marshal(s.String())
+	}
+	s, ok := _SuffrageValueToName[sf]
+	if !ok {
+		return nil, fmt.Errorf("invalid Suffrage: %d", sf)
+	}
+	return json.Marshal(s)
+}
+
+func (sf *Suffrage) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("Suffrage should be a string, got %s", data)
+	}
+	v, ok := _SuffrageNameToValue[s]
+	if !ok {
+		return fmt.Errorf("invalid Suffrage %q", s)
+	}
+	*sf = v
+	return nil
+}
+
+func (sf Suffrage) Val() uint8 {
+	return uint8(sf)
+}
+
+// it's for using with flag package
+func (sf *Suffrage) Set(val string) error {
+	if at, ok := _SuffrageNameToValue[val]; ok {
+		*sf = at
+		return nil
+	}
+	return fmt.Errorf("invalid suffrage: %v", val)
+}
+
+func (sf Suffrage) String() string {
+	return _SuffrageValueToName[sf]
+}
+
+// names lists the accepted values, for the config schema.
+func (sf Suffrage) names() []string {
+	names := make([]string, 0, len(_SuffrageNameToValue))
+	for name := range _SuffrageNameToValue {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,278 @@
+package configs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/alex60217101990/nietzsche/external/logger"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// FieldError is a problem with the value at a path of the config file.
+type FieldError struct {
+	Path    string
+	Message string
+}
+
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors holds every problem found by Validate.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	lines := make([]string, 0, len(e)+1)
+	lines = append(lines, fmt.Sprintf("invalid configuration, %d problem(s):", len(e)))
+	for _, fe := range e {
+		lines = append(lines, "  "+fe.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validator collects the problems of the sections.
+type validator struct {
+	errs ValidationErrors
+	// listeners maps the ports to the paths of the sections listening on them
+	listeners map[uint16][]listener
+}
+
+type listener struct {
+	path string
+	host string
+}
+
+func (v *validator) add(path, format string, args ...interface{}) {
+	v.errs = append(v.errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) required(path, value string) {
+	if len(strings.TrimSpace(value)) == 0 {
+		v.add(path, "is required")
+	}
+}
+
+func (v *validator) nonNegative(path string, d Duration) {
+	if d < 0 {
+		v.add(path, "must not be negative")
+	}
+}
+
+func (v *validator) address(path, addr string) {
+	if len(addr) == 0 {
+		return
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		v.add(path, "must be a <host>:<port> address, %v", err)
+	}
+}
+
+// listen checks the port of the section and that no other section listens on it,
+// an empty host stands for every interface.
+func (v *validator) listen(path, host string, port uint16) {
+	if port == 0 {
+		v.add(path+".port", "must be between 1 and 65535")
+		return
+	}
+
+	wildcard := func(host string) bool {
+		return len(host) == 0 || host == "0.0.0.0" || host == "::"
+	}
+	for _, l := range v.listeners[port] {
+		if l.host == host || wildcard(l.host) || wildcard(host) {
+			v.add(path+".port", "%d is also used by %s", port, l.path)
+			break
+		}
+	}
+
+	if v.listeners == nil {
+		v.listeners = make(map[uint16][]listener)
+	}
+	v.listeners[port] = append(v.listeners[port], listener{path: path, host: host})
+}
+
+// Validate checks the whole configuration, the returned
+// ValidationErrors holds every problem found.
+func (c *Configs) Validate() error {
+	var v validator
+	if c == nil {
+		v.add("", "the configuration is empty")
+		return v.errs
+	}
+
+	if c.Server == nil {
+		v.add("http-server", "section is required")
+	} else {
+		v.listen("http-server", c.Server.Host, c.Server.Port)
+		v.address("http-server.advertise-addr", c.Server.Advertise)
+	}
+	if c.Timeouts == nil {
+		v.add("timeouts", "section is required")
+	} else if c.Timeouts.DefaultTimeout == 0 {
+		v.add("timeouts.default-timeout", "must be positive")
+	}
+
+	c.Logger.validate(&v)
+	c.Raft.validate(&v)
+	c.Store.validate(&v)
+
+	if c.GRPC != nil {
+		v.listen("grpc-server", c.GRPC.Host, c.GRPC.Port)
+		v.address("grpc-server.advertise-addr", c.GRPC.Advertise)
+	}
+	if c.Redis != nil {
+		v.listen("redis-server", c.Redis.Host, c.Redis.Port)
+		v.address("redis-server.advertise-addr", c.Redis.Advertise)
+	}
+	if c.Memcached != nil {
+		v.listen("memcached-server", c.Memcached.Host, c.Memcached.Port)
+		v.address("memcached-server.advertise-addr", c.Memcached.Advertise)
+		if c.Auth != nil {
+			v.add("memcached-server", "the memcached protocol has no authentication, it can't be enabled with auth")
+		}
+	}
+
+	if c.DB != nil {
+		if _, ok := _RepoTypeValueToName[c.DB.RepoType]; !ok {
+			v.add("db.db-type", "must be one of boldbd")
+		}
+	}
+	if c.Auth != nil {
+		v.nonNegative("auth.token-ttl", c.Auth.TokenTTL)
+		if c.Raft != nil && c.Auth.JoinToken.IsZero() {
+			for i, addr := range c.Raft.Join {
+				if !strings.HasPrefix(addr, "https://") {
+					v.add(fmt.Sprintf("consensus.join[%d]", i), "the root password is sent to https addresses only, set auth.join-token to join over http")
+				}
+			}
+		}
+	}
+	if c.Encryption != nil {
+		v.required("encryption.key-file", c.Encryption.KeyFile)
+		if len(c.Encryption.KeyFile) > 0 {
+			if _, err := os.Stat(c.Encryption.KeyFile); err != nil {
+				v.add("encryption.key-file", "%v", err)
+			}
+		}
+	}
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+func (l *Logger) validate(v *validator) {
+	// the section is created by SetDefaults
+	if l == nil {
+		return
+	}
+
+	if !logger.ValidLevel(l.Level) {
+		v.add("logger.level", "must be one of %s", strings.Join(logger.Levels, ", "))
+	}
+	if l.Encoding != logger.EncodingJSON && l.Encoding != logger.EncodingConsole {
+		v.add("logger.encoding", "must be one of %s, %s", logger.EncodingJSON, logger.EncodingConsole)
+	}
+
+	files := 0
+	for i, output := range l.Outputs {
+		path := fmt.Sprintf("logger.outputs[%d]", i)
+		switch output {
+		case logger.OutputStdout, logger.OutputStderr:
+		case "":
+			v.add(path, "must not be empty")
+		default:
+			files++
+			if err := writableDir(filepath.Dir(output)); err != nil {
+				v.add(path, "%v", err)
+			}
+		}
+	}
+	if l.Rotation != nil && files == 0 {
+		v.add("logger.rotation", "applies to the files, none of the outputs is a file")
+	}
+	if l.Async != nil {
+		v.nonNegative("logger.async.flush-interval", l.Async.FlushInterval)
+		if l.Async.Policy != logger.PolicyBlock && l.Async.Policy != logger.PolicyDrop {
+			v.add("logger.async.policy", "must be one of %s, %s", logger.PolicyBlock, logger.PolicyDrop)
+		}
+	}
+}
+
+func (r *Raft) validate(v *validator) {
+	if r == nil {
+		v.add("consensus", "section is required")
+		return
+	}
+
+	v.required("consensus.node-id", r.NodeID)
+	v.required("consensus.volume-dir", r.VolumeDir)
+	if len(r.VolumeDir) > 0 {
+		if err := writableDir(r.VolumeDir); err != nil {
+			v.add("consensus.volume-dir", "%v", err)
+		}
+	}
+
+	// the transport listens on every interface
+	v.listen("consensus", "", r.Port)
+	v.address("consensus.advertise-addr", r.Advertise)
+
+	if _, ok := _RaftTransportTypeValueToName[r.Transport]; !ok {
+		v.add("consensus.transport-type", "must be one of tcp, udp")
+	}
+	if _, ok := _SuffrageValueToName[r.Suffrage]; !ok {
+		v.add("consensus.suffrage", "must be one of voter, nonvoter")
+	}
+	for i, addr := range r.Join {
+		if len(strings.TrimSpace(addr)) == 0 {
+			v.add(fmt.Sprintf("consensus.join[%d]", i), "must not be empty")
+		}
+	}
+	if len(r.LogLevel) > 0 && hclog.LevelFromString(r.LogLevel) == hclog.NoLevel {
+		v.add("consensus.log-level", "must be one of trace, debug, info, warn, error")
+	}
+
+	v.nonNegative("consensus.heartbeat-timeout", r.HeartbeatTimeout)
+	v.nonNegative("consensus.election-timeout", r.ElectionTimeout)
+	v.nonNegative("consensus.leader-lease-timeout", r.LeaderLeaseTimeout)
+	v.nonNegative("consensus.commit-timeout", r.CommitTimeout)
+	v.nonNegative("consensus.snapshot-interval", r.SnapshotInterval)
+}
+
+func (s *Store) validate(v *validator) {
+	if s == nil {
+		v.add("store", "section is required")
+		return
+	}
+
+	// the bolt store is the only one implemented
+	if s.StoreType != StoreBoldDB {
+		v.add("store.store-type", "must be boldbd")
+	}
+	v.required("store.db-name", s.DbName)
+	v.required("store.bucket-name", s.BucketName)
+}
+
+// writableDir checks that the directory exists and files can be created in it.
+func writableDir(dir string) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	f, err := ioutil.TempFile(dir, ".nietzsche-")
+	if err != nil {
+		return fmt.Errorf("%s is not writable", dir)
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
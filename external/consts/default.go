@@ -3,22 +3,108 @@ package consts
 import "time"
 
 const (
-	// The maxPool controls how many connections we will pool.
-	maxPool = 3
+	// Defaults of the timeouts section, in seconds: the time limit of the
+	// requests to the cluster and of opening the data file.
+	DefaultTimeout      = 10
+	DefaultStoreTimeout = 5
 
-	// The timeout is used to apply I/O deadlines. For InstallSnapshot, we multiply
-	// the timeout by (SnapshotSize / TimeoutScale).
-	// https://github.com/hashicorp/raft/blob/v1.1.2/net_transport.go#L177-L181
-	TCPTimeout = 10 * time.Second
+	// The RaftMaxPool controls how many connections we will pool.
+	RaftMaxPool = 3
 
 	// The `retain` parameter controls how many
 	// snapshots are retained. Must be at least 1.
 	RaftSnapShotRetain = 5
 
+	// RaftSnapshotThreshold controls how many outstanding logs
+	// there must be before raft performs a snapshot.
+	RaftSnapshotThreshold = 2 << 10
+
 	// raftLogCacheSize is the maximum number of logs to cache in-memory.
 	// This is used to reduce disk I/O for the recently committed entries.
 	RaftLogCacheSize = 512
 
+	// A server which has not been contacted by the leader for longer than
+	// that is not counted as healthy when membership changes check the quorum.
+	ServerHealthyContact = 10 * time.Second
+
+	// How often a server which is not a member of the cluster
+	// yet retries to join it through the configured addresses.
+	JoinRetryInterval = 2 * time.Second
+
+	// How often the autopilot on the leader checks the servers health.
+	AutopilotInterval = 10 * time.Second
+
+	// A server which failed for longer than that is removed by the autopilot.
+	AutopilotDeadServerThreshold = 24 * time.Hour
+
+	// A server is healthy while the leader contacted it recently
+	// and its log does not lag behind by more entries than that.
+	AutopilotLastContactThreshold = 10 * time.Second
+	AutopilotMaxTrailingLogs      = 250
+
+	// A joined server is promoted to voter after being healthy for that long.
+	AutopilotStableServerThreshold = 10 * time.Second
+
+	// How many committed entries may wait to be applied
+	// to the store while the node still reports ready.
+	ReadyMaxAppliedLag = 128
+
+	// How many events may wait for a slow watcher,
+	// the watch is closed once the buffer is full.
+	WatchBufferSize = 256
+
+	// How often the leader revokes the expired leases.
+	LeaseCheckInterval = 500 * time.Millisecond
+
+	// Defaults of the client: time limit of a single request attempt,
+	// retries of idempotent requests and the backoff between them.
+	ClientRequestTimeout = 10 * time.Second
+	ClientMaxRetries     = 3
+	ClientBackoffBase    = 100 * time.Millisecond
+	ClientBackoffMax     = 2 * time.Second
+
+	// Limits of a single RESP command: the number of
+	// arguments and the size of a bulk string.
+	RESPMaxArgs     = 1 << 20
+	RESPMaxBulkSize = 512 << 20
+
+	// How many times read-modify-write commands of the RESP and
+	// memcached frontends retry when the key is changed concurrently.
+	CASMaxRetries = 32
+
+	// Limit of the keys and the values of memcached items.
+	MemcachedMaxKeySize  = 250
+	MemcachedMaxItemSize = 1 << 20
+
+	// How long the issued auth tokens are valid.
+	AuthTokenTTL = time.Hour
+
+	// PBKDF2 iterations of the stored password hashes.
+	PasswordHashIterations = 10000
+
+	// How many values a key rotation re-encrypts in a single bolt
+	// transaction and the size of the encrypted snapshot chunks.
+	EncryptionRotationBatch = 1000
+	EncryptionChunkSize     = 64 << 10
+
+	// How often the config file is checked for changes to reload.
+	ConfigWatchInterval = 2 * time.Second
+
+	// Defaults of the logger section, the size of
+	// the rotated log files is set in megabytes.
+	LogLevel              = "info"
+	LogEncoding           = "console"
+	LogOutput             = "stdout"
+	LogRotationMaxSize    = 100
+	LogSamplingInitial    = 100
+	LogSamplingThereafter = 100
+
+	// Defaults of the asynchronous logging, the size of
+	// the queue is set in entries.
+	LogQueueSize     = 4096
+	LogFlushInterval = time.Second
+	LogQueuePolicy   = "block"
+
 	// limit capacity of the pool
 	PoolCap = 100
 
@@ -2,4 +2,57 @@ package consts
 
 const (
 	RaftPathPreffix = "raft.dataRepo"
+
+	// Directory the raft file snapshot store keeps the snapshots in.
+	RaftSnapshotsDir = "snapshots"
+
+	// Prefix of every exported metric name.
+	MetricsNamespace = "nietzsche"
+
+	// Keys under this preffix are reserved for the cluster itself
+	// and can't be written through the public API.
+	SystemKeyPreffix = "_nietzsche/"
+
+	// Maps raft server id to the HTTP API address of the server.
+	ServersKeyPreffix = SystemKeyPreffix + "servers/"
+
+	// Maps raft server id to the gRPC API address of the server.
+	GRPCServersKeyPreffix = SystemKeyPreffix + "grpc-servers/"
+
+	// Maps raft server id to the RESP address of the server.
+	RedisServersKeyPreffix = SystemKeyPreffix + "redis-servers/"
+
+	// Maps raft server id to the memcached address of the server.
+	MemcachedServersKeyPreffix = SystemKeyPreffix + "memcached-servers/"
+
+	// Marks servers the autopilot promotes to voters once they are stable.
+	PromoteKeyPreffix = SystemKeyPreffix + "promote/"
+
+	// Maps lease id to its time to live.
+	LeasesKeyPreffix = SystemKeyPreffix + "leases/"
+
+	// Maps lease id to the user who granted it, when auth was enabled.
+	LeaseOwnersKeyPreffix = SystemKeyPreffix + "lease-owners/"
+
+	// Index of the keys attached to a lease, "<lease id>/<key>".
+	LeaseKeysKeyPreffix = SystemKeyPreffix + "lease-keys/"
+
+	// Users, roles and the token signing secret of the access control.
+	AuthUsersKeyPreffix = SystemKeyPreffix + "auth/users/"
+	AuthRolesKeyPreffix = SystemKeyPreffix + "auth/roles/"
+	AuthSecretKey       = SystemKeyPreffix + "auth/secret"
+
+	// Maps a key to the lease it is attached to.
+	KeyLeasesKeyPreffix = SystemKeyPreffix + "key-leases/"
+
+	// Maps a key to the index of the log entry which last wrote it.
+	KeyRevisionsKeyPreffix = SystemKeyPreffix + "key-revisions/"
+
+	// Maps a key to the client flags stored with its value, when not zero.
+	KeyFlagsKeyPreffix = SystemKeyPreffix + "key-flags/"
+
+	// The root user holds the root role, which grants everything
+	// including the cluster management APIs.
+	RootUser = "root"
+	RootRole = "root"
 )
@@ -6,110 +6,231 @@ import (
 	"net"
 	"os"
 	"path/filepath"
-
-	"github.com/alex60217101990/nietzsche/external/logger"
+	"strings"
 
 	"github.com/alex60217101990/nietzsche/external/configs"
 	"github.com/alex60217101990/nietzsche/external/consts"
+	"github.com/alex60217101990/nietzsche/external/logger"
 	rft "github.com/alex60217101990/nietzsche/external/raft-udp-transport"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/raft"
 	raftboltdb "github.com/hashicorp/raft-boltdb"
 )
 
 var (
 	errInvalidTransport = errors.New("invalid raft transport type in config file")
+	errInvalidLogLevel  = errors.New("consensus.log-level: must be one of trace, debug, info, warn, error")
 )
 
-func initRaftCacheStore(store *raftboltdb.BoltStore) (cacheStore *raft.LogCache, err error) {
-	if configs.Conf.Raft.LogCacheSize == 0 {
-		configs.Conf.Raft.LogCacheSize = consts.RaftLogCacheSize
-	}
+// raftConfigKeys maps the subjects of raft.ValidateConfig
+// errors to the keys of the config file.
+var raftConfigKeys = []struct {
+	subject string
+	key     string
+}{
+	{"LocalID", "consensus.node-id"},
+	{"Heartbeat timeout", "consensus.heartbeat-timeout"},
+	{"Election timeout", "consensus.election-timeout"},
+	{"Commit timeout", "consensus.commit-timeout"},
+	{"MaxAppendEntries", "consensus.max-append-entries"},
+	{"Snapshot interval", "consensus.snapshot-interval"},
+	{"Leader lease timeout", "consensus.leader-lease-timeout"},
+}
 
-	// Wrap the store in a LogCache to improve performance.
-	return raft.NewLogCache(int(configs.Conf.Raft.LogCacheSize), store)
+func raftConfigError(err error) error {
+	for _, k := range raftConfigKeys {
+		if strings.HasPrefix(err.Error(), k.subject) {
+			return fmt.Errorf("%s: %s", k.key, strings.ToLower(err.Error()[:1])+err.Error()[1:])
+		}
+	}
+	return fmt.Errorf("consensus: %s", err.Error())
 }
 
-func initRaftSnapshotStore() (snapshotStore *raft.FileSnapshotStore, err error) {
-	if configs.Conf.Raft.SnapShotRetain == 0 {
-		configs.Conf.Raft.SnapShotRetain = consts.RaftSnapShotRetain
+// initRaftConfig builds the raft settings from the
+// config file and validates the result.
+func initRaftConfig(conf *configs.Raft, log hclog.Logger) (*raft.Config, error) {
+	raftConf := raft.DefaultConfig()
+	raftConf.LocalID = raft.ServerID(conf.NodeID)
+	raftConf.Logger = log.ResetNamed("raft")
+	raftConf.HeartbeatTimeout = conf.HeartbeatTimeout.Duration()
+	raftConf.ElectionTimeout = conf.ElectionTimeout.Duration()
+	raftConf.LeaderLeaseTimeout = conf.LeaderLeaseTimeout.Duration()
+	raftConf.CommitTimeout = conf.CommitTimeout.Duration()
+	raftConf.SnapshotInterval = conf.SnapshotInterval.Duration()
+	raftConf.SnapshotThreshold = conf.SnapshotThreshold
+	raftConf.TrailingLogs = conf.TrailingLogs
+	raftConf.MaxAppendEntries = int(conf.MaxAppendEntries)
+	if hclog.LevelFromString(conf.LogLevel) == hclog.NoLevel {
+		return nil, errInvalidLogLevel
+	}
+	raftConf.LogLevel = conf.LogLevel
+
+	if err := raft.ValidateConfig(raftConf); err != nil {
+		return nil, raftConfigError(err)
 	}
 
-	return raft.NewFileSnapshotStore(configs.Conf.Raft.VolumeDir, int(configs.Conf.Raft.SnapShotRetain), os.Stdout)
+	return raftConf, nil
+}
+
+// NewRaftLogger returns the parent of the raft component loggers, their
+// entries are written through the logger. They share its level, which
+// follows consensus.log-level, an empty level stands for info.
+func NewRaftLogger(log logger.Logger, level string) hclog.Logger {
+	return logger.NewHCLogAdapter(log, "", hclog.LevelFromString(level))
 }
 
-func initRaftTransport() (transport *raft.NetworkTransport, err error) {
-	raftBinAddr := fmt.Sprintf(":%d", configs.Conf.Raft.Port)
-	switch configs.Conf.Raft.Transport {
+// raftAdvertiseAddr returns the address other servers use to reach this node,
+// falling back to the loopback interface when nothing is configured.
+func raftAdvertiseAddr(conf *configs.Raft) string {
+	if len(conf.Advertise) > 0 {
+		return conf.Advertise
+	}
+	return fmt.Sprintf("127.0.0.1:%d", conf.Port)
+}
+
+// NewRaftTransport creates the network transport selected in the config file.
+func NewRaftTransport(conf *configs.Configs, log hclog.Logger) (transport *raft.NetworkTransport, err error) {
+	var (
+		raftBinAddr = fmt.Sprintf(":%d", conf.Raft.Port)
+		maxPool     = int(conf.Raft.MaxPool)
+		timeout     = conf.Timeouts.Timeout()
+	)
+
+	switch conf.Raft.Transport {
 	case configs.TCP:
 		var tcpAddr *net.TCPAddr
-		tcpAddr, err = net.ResolveTCPAddr("tcp", raftBinAddr)
+		tcpAddr, err = net.ResolveTCPAddr("tcp", raftAdvertiseAddr(conf.Raft))
 		if err != nil {
 			return transport, err
 		}
 
-		return raft.NewTCPTransport(raftBinAddr, tcpAddr, int(configs.Conf.Raft.MaxPool), TimeoutSecond(configs.Conf.Timeouts.DefaultTimeout), os.Stdout)
+		return raft.NewTCPTransportWithLogger(raftBinAddr, tcpAddr, maxPool, timeout, log.ResetNamed("raft-transport"))
 	case configs.UDP:
 		var udpAddr *net.UDPAddr
-		udpAddr, err := net.ResolveUDPAddr("udp", raftBinAddr)
+		udpAddr, err := net.ResolveUDPAddr("udp", raftAdvertiseAddr(conf.Raft))
 		if err != nil {
 			return transport, err
 		}
-		return rft.NewUDPTransport(raftBinAddr, udpAddr, int(configs.Conf.Raft.MaxPool), TimeoutSecond(configs.Conf.Timeouts.DefaultTimeout), os.Stdout)
+		return rft.NewUDPTransport(raftBinAddr, udpAddr, maxPool, timeout, log.ResetNamed("raft-transport"))
 	default:
 		return transport, errInvalidTransport
 	}
 }
 
-func InitRaftNode() {
-	// Init default configs for raft cluster
-	raftConf := raft.DefaultConfig()
-	raftConf.LocalID = raft.ServerID(configs.Conf.Raft.NodeID)
-	raftConf.SnapshotThreshold = 2 << 10
+// NewRaftNode starts a raft server on top of the given FSM and transport.
+// The returned bolt store holds the raft log and must be closed by the caller
+// after the raft server has been shut down.
+func NewRaftNode(conf *configs.Configs, fsm raft.FSM, transport raft.Transport, log hclog.Logger) (raftServer *raft.Raft, store *raftboltdb.BoltStore, err error) {
+	// Init configs for raft cluster
+	raftConf, err := initRaftConfig(conf.Raft, log)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	// Init stable store
-	store, err := raftboltdb.NewBoltStore(filepath.Join(configs.Conf.Raft.VolumeDir, consts.RaftPathPreffix))
+	stableStore, err := raftboltdb.NewBoltStore(filepath.Join(conf.Raft.VolumeDir, consts.RaftPathPreffix))
 	if err != nil {
-		logger.AppLogger.Fatal(err)
+		return nil, nil, err
 	}
 
-	// Init cache store
+	defer func() {
+		if err != nil {
+			stableStore.Close()
+		}
+	}()
+
+	// Wrap the store in a LogCache to improve performance.
 	var cacheStore *raft.LogCache
-	cacheStore, err = initRaftCacheStore(store)
+	cacheStore, err = raft.NewLogCache(int(conf.Raft.LogCacheSize), stableStore)
 	if err != nil {
-		logger.AppLogger.Fatal(err)
+		return nil, nil, err
 	}
 
 	// Init snapshot store
 	var snapshotStore *raft.FileSnapshotStore
-	snapshotStore, err = initRaftSnapshotStore()
+	snapshotStore, err = raft.NewFileSnapshotStoreWithLogger(conf.Raft.VolumeDir, int(conf.Raft.SnapShotRetain), log.ResetNamed("raft-snapshot"))
 	if err != nil {
-		logger.AppLogger.Fatal(err)
+		return nil, nil, err
 	}
 
-	fmt.Println(snapshotStore, cacheStore)
-
-	// Init transport
-	var transport *raft.NetworkTransport
-	transport, err = initRaftTransport()
+	err = migrateEmptySnapshots(conf.Raft.VolumeDir, snapshotStore, fsm, transport, log.ResetNamed("raft-snapshot"))
 	if err != nil {
-		logger.AppLogger.Fatal(err)
+		return nil, nil, err
 	}
 
-	raftServer, err := raft.NewRaft(raftConf /*fsmStore*/, nil, cacheStore, store, snapshotStore, transport)
+	raftServer, err = raft.NewRaft(raftConf, fsm, cacheStore, stableStore, snapshotStore, transport)
 	if err != nil {
-		logger.AppLogger.Fatal(err)
+		return nil, nil, err
 	}
 
-	// always start single server as a leader
+	if !conf.Raft.Bootstrap {
+		// the node waits to be added by the leader of an existing cluster
+		return raftServer, stableStore, nil
+	}
+
+	// start the bootstrap server as a single-node cluster
 	configuration := raft.Configuration{
 		Servers: []raft.Server{
 			{
-				ID:      raft.ServerID(configs.Conf.Raft.NodeID),
+				ID:      raft.ServerID(conf.Raft.NodeID),
 				Address: transport.LocalAddr(),
 			},
 		},
 	}
 
-	raftServer.BootstrapCluster(configuration)
+	err = raftServer.BootstrapCluster(configuration).Error()
+	if err == raft.ErrCantBootstrap {
+		// the cluster state already exists on disk
+		err = nil
+	}
+	if err != nil {
+		raftServer.Shutdown()
+		return nil, nil, err
+	}
+
+	return raftServer, stableStore, nil
+}
+
+// migrateEmptySnapshots replaces the empty snapshots written by the former
+// no-op Persist, the FSM rejects them on restore. The bolt file already
+// held the data then, so its current state is persisted in their place
+// with the same index, the later logs are applied again as they were.
+func migrateEmptySnapshots(dir string, snapshots *raft.FileSnapshotStore, fsm raft.FSM, transport raft.Transport, log hclog.Logger) error {
+	metas, err := snapshots.List()
+	if err != nil {
+		return err
+	}
+
+	for _, meta := range metas {
+		if meta.Size > 0 {
+			continue
+		}
+
+		snapshot, err := fsm.Snapshot()
+		if err != nil {
+			return err
+		}
+
+		sink, err := snapshots.Create(meta.Version, meta.Index, meta.Term, meta.Configuration, meta.ConfigurationIndex, transport)
+		if err != nil {
+			snapshot.Release()
+			return err
+		}
+
+		err = snapshot.Persist(sink)
+		snapshot.Release()
+		if err != nil {
+			return err
+		}
+
+		// the sink may have reaped the empty snapshot already
+		if err = os.RemoveAll(filepath.Join(dir, consts.RaftSnapshotsDir, meta.ID)); err != nil {
+			return err
+		}
+
+		log.Warn("replaced an empty snapshot", "id", meta.ID, "replacement", sink.ID())
+	}
+
+	return nil
 }
@@ -0,0 +1,188 @@
+package logger
+
+import (
+	"bufio"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// PolicyBlock makes the logging calls wait for room in the queue.
+	PolicyBlock = "block"
+	// PolicyDrop drops the entries while the queue is full.
+	PolicyDrop = "drop"
+
+	// size of the buffer the queued entries are written through
+	asyncBufferSize = 256 << 10
+)
+
+// Async writes the entries from a goroutine, the logging calls only put
+// them into a queue of QueueSize entries. The written entries are buffered
+// and flushed every FlushInterval, on Sync, on Close and on fatal entries.
+// The zero settings stand for the defaults of consts, blocking the calls.
+type Async struct {
+	QueueSize     int
+	FlushInterval time.Duration
+	// Policy is PolicyBlock or PolicyDrop.
+	Policy string
+}
+
+// asyncWriter queues the encoded entries for the output.
+type asyncWriter struct {
+	out   zapcore.WriteSyncer
+	buf   *bufio.Writer
+	queue chan []byte
+	// Sync asks for the queue to be written and the output synced
+	syncCh   chan chan error
+	interval time.Duration
+	drop     bool
+
+	// dropped counts the entries dropped since the last report
+	dropped uint64
+	// onDrop reports the dropped entries, it's called by the writer goroutine
+	onDrop func(n uint64)
+
+	closeOnce sync.Once
+	done      chan struct{}
+	stopped   chan struct{}
+}
+
+func newAsyncWriter(out zapcore.WriteSyncer, opts *Async) *asyncWriter {
+	size, interval := opts.QueueSize, opts.FlushInterval
+	if size <= 0 {
+		size = consts.LogQueueSize
+	}
+	if interval <= 0 {
+		interval = consts.LogFlushInterval
+	}
+
+	w := &asyncWriter{
+		out:      out,
+		buf:      bufio.NewWriterSize(out, asyncBufferSize),
+		queue:    make(chan []byte, size),
+		syncCh:   make(chan chan error),
+		interval: interval,
+		drop:     opts.Policy == PolicyDrop,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	select {
+	case <-w.stopped:
+		// the entries logged after Close are written directly
+		return w.out.Write(p)
+	default:
+	}
+
+	// the encoders reuse their buffers
+	entry := append([]byte(nil), p...)
+
+	if w.drop {
+		select {
+		case w.queue <- entry:
+		default:
+			atomic.AddUint64(&w.dropped, 1)
+		}
+		return len(p), nil
+	}
+
+	select {
+	case w.queue <- entry:
+		return len(p), nil
+	case <-w.stopped:
+		return w.out.Write(p)
+	}
+}
+
+// Sync returns once the entries queued before are written and flushed.
+func (w *asyncWriter) Sync() error {
+	ack := make(chan error, 1)
+	select {
+	case w.syncCh <- ack:
+		return <-ack
+	case <-w.stopped:
+		return w.out.Sync()
+	}
+}
+
+// Close writes the queued entries and stops the writer goroutine.
+func (w *asyncWriter) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.done)
+	})
+	<-w.stopped
+	return w.out.Sync()
+}
+
+// direct returns the output, the entries written to it follow the queued ones.
+func (w *asyncWriter) direct() zapcore.WriteSyncer {
+	return directWriter{w}
+}
+
+type directWriter struct {
+	w *asyncWriter
+}
+
+func (d directWriter) Write(p []byte) (int, error) {
+	_ = d.w.Sync()
+	return d.w.out.Write(p)
+}
+
+func (d directWriter) Sync() error {
+	return d.w.out.Sync()
+}
+
+func (w *asyncWriter) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry := <-w.queue:
+			w.buf.Write(entry)
+		case <-ticker.C:
+			w.flush()
+		case ack := <-w.syncCh:
+			w.drain()
+			if err := w.flush(); err != nil {
+				ack <- err
+				continue
+			}
+			ack <- w.out.Sync()
+		case <-w.done:
+			w.drain()
+			w.flush()
+			return
+		}
+	}
+}
+
+// drain writes the entries waiting in the queue.
+func (w *asyncWriter) drain() {
+	for {
+		select {
+		case entry := <-w.queue:
+			w.buf.Write(entry)
+		default:
+			return
+		}
+	}
+}
+
+func (w *asyncWriter) flush() error {
+	if n := atomic.SwapUint64(&w.dropped, 0); n > 0 && w.onDrop != nil {
+		w.onDrop(n)
+	}
+	return w.buf.Flush()
+}
@@ -0,0 +1,55 @@
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// benchmarkLogger writes JSON entries to a file in a temporary
+// directory, the same entry is logged by every iteration.
+func benchmarkLogger(b *testing.B, async *Async) {
+	dir, err := ioutil.TempDir("", "nietzsche-logger")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	l, err := New(Options{
+		Encoding: EncodingJSON,
+		Outputs:  []string{filepath.Join(dir, "bench.log")},
+		Async:    async,
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer l.Close()
+
+	fields := map[string]interface{}{
+		"raft":      "apply",
+		"operation": "SET",
+		"index":     uint64(42),
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Infof("command applied", fields)
+		}
+	})
+	b.StopTimer()
+}
+
+func BenchmarkSyncCore(b *testing.B) {
+	benchmarkLogger(b, nil)
+}
+
+func BenchmarkAsyncCoreBlock(b *testing.B) {
+	benchmarkLogger(b, &Async{Policy: PolicyBlock})
+}
+
+func BenchmarkAsyncCoreDrop(b *testing.B) {
+	benchmarkLogger(b, &Async{Policy: PolicyDrop})
+}
@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"go.uber.org/zap"
+)
+
+// The fields WithContext adds to the entries.
+const (
+	RequestIDField = "request_id"
+	NodeIDField    = "node_id"
+	TermField      = "term"
+)
+
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	nodeIDKey
+	termKey
+)
+
+// NewRequestID returns a random ID for a request which came without one.
+func NewRequestID() string {
+	id := make([]byte, 8)
+	// the reader of crypto/rand doesn't fail on the supported platforms
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// ContextWithRequestID returns the context carrying the ID of the client request.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns the ID of the client request, empty when there is none.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// ContextWithNodeID returns the context carrying the ID of the raft node.
+func ContextWithNodeID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, nodeIDKey, id)
+}
+
+// NodeID returns the ID of the raft node, empty when there is none.
+func NodeID(ctx context.Context) string {
+	id, _ := ctx.Value(nodeIDKey).(string)
+	return id
+}
+
+// ContextWithTerm returns the context carrying the raft term.
+func ContextWithTerm(ctx context.Context, term uint64) context.Context {
+	return context.WithValue(ctx, termKey, term)
+}
+
+// Term returns the raft term, ok is false when there is none.
+func Term(ctx context.Context) (term uint64, ok bool) {
+	term, ok = ctx.Value(termKey).(uint64)
+	return term, ok
+}
+
+// contextFields returns the fields of the values the context carries.
+func contextFields(ctx context.Context) []zap.Field {
+	fields := make([]zap.Field, 0, 3)
+	if id := RequestID(ctx); len(id) > 0 {
+		fields = append(fields, zap.String(RequestIDField, id))
+	}
+	if id := NodeID(ctx); len(id) > 0 {
+		fields = append(fields, zap.String(NodeIDField, id))
+	}
+	if term, ok := Term(ctx); ok {
+		fields = append(fields, zap.Uint64(TermField, term))
+	}
+	return fields
+}
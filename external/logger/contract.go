@@ -1,7 +1,11 @@
 package logger
 
+import "context"
+
 type Logger interface {
 	GetNativeLogger() interface{}
+	Debug(msg string)
+	Debugf(tpl string, args map[string]interface{})
 	Info(msg string)
 	Infof(tpl string, args map[string]interface{})
 	Error(err error)
@@ -11,5 +15,16 @@ type Logger interface {
 	Fatal(err error)
 	Fatalf(tpl string, args map[string]interface{})
 	Printf(format string, args ...interface{})
+	// With returns a child logger adding the fields to every entry.
+	With(fields map[string]interface{}) Logger
+	// WithContext returns a child logger adding the request ID,
+	// the node ID and the raft term the context carries.
+	WithContext(ctx context.Context) Logger
+	SetLevel(level string) error
+	// Enabled reports whether the entries of the level are written, the
+	// callers check it before building costly fields of debug entries.
+	Enabled(level string) bool
+	// Close writes the pending entries and closes the outputs,
+	// closing a child logger only writes its pending entries.
 	Close()
 }
@@ -0,0 +1,175 @@
+package logger
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// HCLogAdapter writes the entries of hashicorp libraries (raft, its
+// transports and snapshot store) through the project Logger.
+type HCLogAdapter struct {
+	logger Logger
+	name   string
+	fields []interface{}
+	level  *int32
+}
+
+// NewHCLogAdapter returns an hclog.Logger named after the component,
+// entries below the level are dropped.
+func NewHCLogAdapter(l Logger, name string, level hclog.Level) hclog.Logger {
+	if level == hclog.NoLevel {
+		level = hclog.Info
+	}
+
+	lvl := int32(level)
+	return &HCLogAdapter{
+		logger: l,
+		name:   name,
+		level:  &lvl,
+	}
+}
+
+func (a *HCLogAdapter) enabled(level hclog.Level) bool {
+	return level >= hclog.Level(atomic.LoadInt32(a.level))
+}
+
+func (a *HCLogAdapter) entryFields(args []interface{}) map[string]interface{} {
+	fields := make(map[string]interface{}, (len(a.fields)+len(args))/2+1)
+	if len(a.name) > 0 {
+		fields["component"] = a.name
+	}
+
+	all := append(a.fields[:len(a.fields):len(a.fields)], args...)
+	if len(all)%2 != 0 {
+		all = append(all[:len(all)-1], "EXTRA_VALUE_AT_END", all[len(all)-1])
+	}
+	for i := 0; i < len(all); i += 2 {
+		value := all[i+1]
+		if f, ok := value.(hclog.Format); ok && len(f) > 0 {
+			value = fmt.Sprintf(fmt.Sprint(f[0]), f[1:]...)
+		}
+		fields[fmt.Sprint(all[i])] = value
+	}
+
+	return fields
+}
+
+func (a *HCLogAdapter) log(level hclog.Level, msg string, args []interface{}) {
+	if !a.enabled(level) {
+		return
+	}
+
+	fields := a.entryFields(args)
+	switch level {
+	case hclog.Trace, hclog.Debug:
+		a.logger.Debugf(msg, fields)
+	case hclog.Info:
+		a.logger.Infof(msg, fields)
+	case hclog.Warn:
+		a.logger.Warnf(msg, fields)
+	default:
+		a.logger.Errorf(msg, fields)
+	}
+}
+
+func (a *HCLogAdapter) Trace(msg string, args ...interface{}) { a.log(hclog.Trace, msg, args) }
+func (a *HCLogAdapter) Debug(msg string, args ...interface{}) { a.log(hclog.Debug, msg, args) }
+func (a *HCLogAdapter) Info(msg string, args ...interface{})  { a.log(hclog.Info, msg, args) }
+func (a *HCLogAdapter) Warn(msg string, args ...interface{})  { a.log(hclog.Warn, msg, args) }
+func (a *HCLogAdapter) Error(msg string, args ...interface{}) { a.log(hclog.Error, msg, args) }
+
+func (a *HCLogAdapter) IsTrace() bool { return a.enabled(hclog.Trace) }
+func (a *HCLogAdapter) IsDebug() bool { return a.enabled(hclog.Debug) }
+func (a *HCLogAdapter) IsInfo() bool  { return a.enabled(hclog.Info) }
+func (a *HCLogAdapter) IsWarn() bool  { return a.enabled(hclog.Warn) }
+func (a *HCLogAdapter) IsError() bool { return a.enabled(hclog.Error) }
+
+// With returns a child logger which adds the key/value pairs to every entry.
+func (a *HCLogAdapter) With(args ...interface{}) hclog.Logger {
+	child := *a
+	child.fields = append(a.fields[:len(a.fields):len(a.fields)], args...)
+	return &child
+}
+
+// Named returns a child logger with the name appended to the component.
+func (a *HCLogAdapter) Named(name string) hclog.Logger {
+	if len(a.name) > 0 {
+		name = a.name + "." + name
+	}
+	return a.ResetNamed(name)
+}
+
+// ResetNamed returns a child logger with the component replaced by the name.
+func (a *HCLogAdapter) ResetNamed(name string) hclog.Logger {
+	child := *a
+	child.name = name
+	return &child
+}
+
+// SetLevel changes the level of the logger and all its children.
+func (a *HCLogAdapter) SetLevel(level hclog.Level) {
+	atomic.StoreInt32(a.level, int32(level))
+}
+
+func (a *HCLogAdapter) StandardLogger(opts *hclog.StandardLoggerOptions) *log.Logger {
+	return log.New(a.StandardWriter(opts), "", 0)
+}
+
+func (a *HCLogAdapter) StandardWriter(opts *hclog.StandardLoggerOptions) io.Writer {
+	if opts == nil {
+		opts = &hclog.StandardLoggerOptions{}
+	}
+	return &hclogWriter{
+		adapter:     a,
+		inferLevels: opts.InferLevels,
+	}
+}
+
+// hclogWriter turns the lines of standard library loggers into entries,
+// optionally taking the level from prefixes like "[WARN]".
+type hclogWriter struct {
+	adapter     *HCLogAdapter
+	inferLevels bool
+}
+
+var hclogWriterPrefixes = []struct {
+	prefix string
+	level  hclog.Level
+}{
+	{"[TRACE]", hclog.Trace},
+	{"[DEBUG]", hclog.Debug},
+	{"[INFO]", hclog.Info},
+	{"[WARN]", hclog.Warn},
+	{"[ERROR]", hclog.Error},
+	{"[ERR]", hclog.Error},
+}
+
+func (w *hclogWriter) Write(p []byte) (n int, err error) {
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\r\n"), []byte{'\n'}) {
+		msg := strings.TrimSpace(string(line))
+		if len(msg) == 0 {
+			continue
+		}
+
+		level := hclog.Info
+		if w.inferLevels {
+			for _, p := range hclogWriterPrefixes {
+				if strings.HasPrefix(msg, p.prefix) {
+					level = p.level
+					msg = strings.TrimSpace(msg[len(p.prefix):])
+					break
+				}
+			}
+		}
+
+		w.adapter.log(level, msg, nil)
+	}
+
+	return len(p), nil
+}
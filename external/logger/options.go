@@ -0,0 +1,209 @@
+package logger
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+
+	EncodingJSON    = "json"
+	EncodingConsole = "console"
+
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
+)
+
+// Levels are the accepted log levels, from the most verbose one.
+var Levels = []string{LevelDebug, LevelInfo, LevelWarn, LevelError}
+
+// Options configure the logger built by New, the empty
+// settings stand for info entries written to stdout.
+type Options struct {
+	Level string
+	// Encoding is json or console.
+	Encoding string
+	// Outputs are stdout, stderr or paths of files,
+	// the entries are written once to every output.
+	Outputs []string
+	// Rotation rotates the files, they grow without limit when it's nil.
+	Rotation *Rotation
+	// Sampling limits the repeated entries, every entry is written when it's nil.
+	Sampling *Sampling
+	// Async writes the entries from a goroutine, they're
+	// written by the logging calls when it's nil.
+	Async *Async
+}
+
+// Rotation starts a new log file once the file reaches MaxSize megabytes,
+// the old files are removed once there are MaxBackups of them or they are
+// older than MaxAge days. Zero MaxBackups and MaxAge keep every file.
+type Rotation struct {
+	MaxSize    int
+	MaxAge     int
+	MaxBackups int
+	// Compress gzips the rotated files.
+	Compress bool
+}
+
+// Sampling writes the first Initial entries with the same level and message
+// each second and then every Thereafter-th of them.
+type Sampling struct {
+	Initial    int
+	Thereafter int
+}
+
+// ValidLevel reports whether the level is one of Levels.
+func ValidLevel(level string) bool {
+	for _, l := range Levels {
+		if level == l {
+			return true
+		}
+	}
+	return false
+}
+
+func parseLevel(level string) (zapcore.Level, error) {
+	if len(level) == 0 {
+		return zapcore.InfoLevel, nil
+	}
+	if !ValidLevel(level) {
+		return zapcore.InfoLevel, fmt.Errorf("invalid log level %q, expected one of %s", level, strings.Join(Levels, ", "))
+	}
+
+	var lvl zapcore.Level
+	err := lvl.UnmarshalText([]byte(level))
+	return lvl, err
+}
+
+// New builds the logger writing to the outputs of the options, its
+// Close writes the queued entries and closes the files it has opened.
+func New(opts Options) (_ Logger, err error) {
+	lvl, err := parseLevel(opts.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := opts.Outputs
+	if len(outputs) == 0 {
+		outputs = []string{OutputStdout}
+	}
+
+	l := &ZapLogger{level: zap.NewAtomicLevelAt(lvl)}
+	defer func() {
+		if err != nil {
+			l.closeOutputs()
+		}
+	}()
+
+	cores := make([]zapcore.Core, 0, len(outputs))
+	for _, output := range outputs {
+		var (
+			sink     zapcore.WriteSyncer
+			terminal bool
+		)
+		switch output {
+		case OutputStdout:
+			sink, terminal = zapcore.Lock(os.Stdout), true
+		case OutputStderr:
+			sink, terminal = zapcore.Lock(os.Stderr), true
+		default:
+			var w io.WriteCloser
+			if w, err = openOutput(output, opts.Rotation); err != nil {
+				return nil, err
+			}
+			l.closers = append(l.closers, w)
+			sink = zapcore.AddSync(w)
+		}
+
+		var enc zapcore.Encoder
+		if enc, err = newEncoder(opts.Encoding, terminal); err != nil {
+			return nil, err
+		}
+
+		if opts.Async == nil {
+			cores = append(cores, zapcore.NewCore(enc, sink, l.level))
+			continue
+		}
+
+		w := newAsyncWriter(sink, opts.Async)
+		w.onDrop = l.reportDropped
+		l.async = append(l.async, w)
+
+		// the entries which may end the program are never dropped,
+		// they're written directly once the queue is written
+		queued := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
+			return lvl <= zapcore.ErrorLevel && l.level.Enabled(lvl)
+		})
+		direct := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
+			return lvl > zapcore.ErrorLevel && l.level.Enabled(lvl)
+		})
+		cores = append(cores,
+			zapcore.NewCore(enc, w, queued),
+			zapcore.NewCore(enc.Clone(), w.direct(), direct),
+		)
+	}
+
+	core := zapcore.NewTee(cores...)
+	if opts.Sampling != nil {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, opts.Sampling.Initial, opts.Sampling.Thereafter)
+	}
+
+	l.logger = zap.New(core, zap.AddStacktrace(zapcore.ErrorLevel))
+	return l, nil
+}
+
+// openOutput opens the log file for appending, it's rotated
+// by the size when the rotation is configured.
+func openOutput(path string, rotation *Rotation) (io.WriteCloser, error) {
+	if rotation == nil {
+		return os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	}
+
+	return &lumberjack.Logger{
+		Filename:   path,
+		MaxSize:    rotation.MaxSize,
+		MaxAge:     rotation.MaxAge,
+		MaxBackups: rotation.MaxBackups,
+		Compress:   rotation.Compress,
+	}, nil
+}
+
+// newEncoder returns the encoder of the entries, the levels are
+// colored by the console encoder when they're written to a terminal.
+func newEncoder(encoding string, terminal bool) (zapcore.Encoder, error) {
+	switch encoding {
+	case EncodingJSON:
+		return zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), nil
+	case EncodingConsole, "":
+		config := zapcore.EncoderConfig{
+			MessageKey: "message",
+
+			LevelKey:    "level",
+			EncodeLevel: zapcore.CapitalLevelEncoder,
+
+			TimeKey:    "time",
+			EncodeTime: zapcore.ISO8601TimeEncoder,
+
+			CallerKey:    "caller",
+			EncodeCaller: zapcore.ShortCallerEncoder,
+		}
+		if terminal {
+			config.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		}
+		return zapcore.NewConsoleEncoder(config), nil
+	default:
+		return nil, fmt.Errorf("invalid log encoding %q, expected %s or %s", encoding, EncodingJSON, EncodingConsole)
+	}
+}
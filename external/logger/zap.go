@@ -1,8 +1,9 @@
 package logger
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"io"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -10,73 +11,88 @@ import (
 
 type ZapLogger struct {
 	logger *zap.Logger
+	level  zap.AtomicLevel
+	// the asynchronous writers and the log files opened by
+	// New, the writers are closed first to write their queues
+	async   []*asyncWriter
+	closers []io.Closer
 }
 
+// NewZapLogger returns the logger writing the info
+// entries to stdout, see New for the other options.
 func NewZapLogger() Logger {
-	highPriority := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return lvl >= zapcore.ErrorLevel
-	})
-	lowPriority := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return lvl < zapcore.ErrorLevel
-	})
-
-	consoleDebugging := zapcore.Lock(os.Stdout)
-	consoleErrors := zapcore.Lock(os.Stderr)
-
-	config := zap.NewDevelopmentConfig()
-	config.EncoderConfig = zapcore.EncoderConfig{
-		MessageKey: "message",
+	// stdout is always available
+	l, _ := New(Options{})
+	return l
+}
 
-		LevelKey:    "level",
-		EncodeLevel: zapcore.CapitalLevelEncoder,
+func (l *ZapLogger) GetNativeLogger() interface{} {
+	return l.logger
+}
 
-		TimeKey:    "time",
-		EncodeTime: zapcore.ISO8601TimeEncoder,
+func (l *ZapLogger) Close() {
+	_ = l.logger.Sync()
+	l.closeOutputs()
+}
 
-		CallerKey:    "caller",
-		EncodeCaller: zapcore.ShortCallerEncoder,
+func (l *ZapLogger) closeOutputs() {
+	for _, w := range l.async {
+		_ = w.Close()
 	}
-	config.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+	l.async = nil
+	for _, c := range l.closers {
+		_ = c.Close()
+	}
+	l.closers = nil
+}
 
-	jsonEncoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
-	consoleEncoder := zapcore.NewConsoleEncoder(config.EncoderConfig)
+// SetLevel changes the level of the entries written, it's one of Levels.
+func (l *ZapLogger) SetLevel(level string) error {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return err
+	}
+	l.level.SetLevel(lvl)
+	return nil
+}
 
-	core := zapcore.NewTee(
-		zapcore.NewCore(jsonEncoder, consoleErrors, highPriority),
-		zapcore.NewCore(consoleEncoder, consoleErrors, highPriority),
-		zapcore.NewCore(jsonEncoder, consoleDebugging, lowPriority),
-		zapcore.NewCore(consoleEncoder, consoleDebugging, lowPriority),
-	)
+// With returns the child logger, it shares the level and the outputs.
+func (l *ZapLogger) With(args map[string]interface{}) Logger {
+	fields := make([]zapcore.Field, 0, len(args))
+	for k, v := range args {
+		fields = append(fields, zap.Any(k, v))
+	}
+	return &ZapLogger{
+		logger: l.logger.With(fields...),
+		level:  l.level,
+	}
+}
 
+// WithContext returns the child logger adding the values of the context.
+func (l *ZapLogger) WithContext(ctx context.Context) Logger {
 	return &ZapLogger{
-		logger: zap.New(
-			core,
-			zap.AddStacktrace(zapcore.ErrorLevel),
-		),
+		logger: l.logger.With(contextFields(ctx)...),
+		level:  l.level,
 	}
 }
 
-func (l *ZapLogger) GetNativeLogger() interface{} {
-	return l.logger
+func (l *ZapLogger) Debug(msg string) {
+	l.logger.Debug(msg)
 }
 
-func (l *ZapLogger) Close() {
-	defer l.logger.Sync()
+func (l *ZapLogger) Enabled(level string) bool {
+	lvl, err := parseLevel(level)
+	if err != nil {
+		return false
+	}
+	return l.logger.Core().Enabled(lvl)
 }
 
 func (l *ZapLogger) Info(msg string) {
-	defer func() {
-		_ = l.logger.Sync()
-	}()
-
 	l.logger.Info(msg)
 }
 
 func (l *ZapLogger) Infof(tpl string, args map[string]interface{}) {
-	defer func() {
-		_ = l.logger.Sync()
-	}()
-
 	fields := make([]zapcore.Field, 0)
 	for k, v := range args {
 		fields = append(fields, zap.Any(k, v))
@@ -84,19 +100,19 @@ func (l *ZapLogger) Infof(tpl string, args map[string]interface{}) {
 	l.logger.Info(tpl, fields...)
 }
 
-func (l *ZapLogger) Error(err error) {
-	defer func() {
-		_ = l.logger.Sync()
-	}()
+func (l *ZapLogger) Debugf(tpl string, args map[string]interface{}) {
+	fields := make([]zapcore.Field, 0)
+	for k, v := range args {
+		fields = append(fields, zap.Any(k, v))
+	}
+	l.logger.Debug(tpl, fields...)
+}
 
+func (l *ZapLogger) Error(err error) {
 	l.logger.Error(err.Error())
 }
 
 func (l *ZapLogger) Errorf(tpl string, args map[string]interface{}) {
-	defer func() {
-		_ = l.logger.Sync()
-	}()
-
 	fields := make([]zapcore.Field, 0)
 	for k, v := range args {
 		fields = append(fields, zap.Any(k, v))
@@ -105,26 +121,14 @@ func (l *ZapLogger) Errorf(tpl string, args map[string]interface{}) {
 }
 
 func (l *ZapLogger) Printf(format string, args ...interface{}) {
-	defer func() {
-		_ = l.logger.Sync()
-	}()
-
 	l.logger.Warn(fmt.Sprintf(format, args...))
 }
 
 func (l *ZapLogger) Warn(msg string) {
-	defer func() {
-		_ = l.logger.Sync()
-	}()
-
 	l.logger.Warn(msg)
 }
 
 func (l *ZapLogger) Warnf(tpl string, args map[string]interface{}) {
-	defer func() {
-		_ = l.logger.Sync()
-	}()
-
 	fields := make([]zapcore.Field, 0)
 	for k, v := range args {
 		fields = append(fields, zap.Any(k, v))
@@ -133,18 +137,10 @@ func (l *ZapLogger) Warnf(tpl string, args map[string]interface{}) {
 }
 
 func (l *ZapLogger) Fatal(err error) {
-	defer func() {
-		_ = l.logger.Sync()
-	}()
-
 	l.logger.Fatal(err.Error())
 }
 
 func (l *ZapLogger) Fatalf(tpl string, args map[string]interface{}) {
-	defer func() {
-		_ = l.logger.Sync()
-	}()
-
 	fields := make([]zapcore.Field, 0)
 	for k, v := range args {
 		fields = append(fields, zap.Any(k, v))
@@ -152,3 +148,8 @@ func (l *ZapLogger) Fatalf(tpl string, args map[string]interface{}) {
 
 	l.logger.Fatal(tpl, fields...)
 }
+
+// reportDropped logs how many entries the asynchronous writers have dropped.
+func (l *ZapLogger) reportDropped(n uint64) {
+	l.logger.Warn("log entries dropped, the queue was full", zap.Uint64("dropped", n))
+}
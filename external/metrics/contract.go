@@ -0,0 +1,29 @@
+package metrics
+
+import "net/http"
+
+// Counter, Gauge and Histogram take the values of the labels
+// declared when the metric was created, in the same order.
+type Counter interface {
+	Inc(labels ...string)
+	Add(delta float64, labels ...string)
+}
+
+type Gauge interface {
+	Set(value float64, labels ...string)
+	Add(delta float64, labels ...string)
+}
+
+type Histogram interface {
+	Observe(value float64, labels ...string)
+}
+
+type Metrics interface {
+	Counter(name, help string, labels ...string) Counter
+	Gauge(name, help string, labels ...string) Gauge
+	// GaugeFunc reports the value returned by fn on every scrape,
+	// registering the same name again replaces the function.
+	GaugeFunc(name, help string, fn func() float64)
+	Histogram(name, help string, buckets []float64, labels ...string) Histogram
+	Handler() http.Handler
+}
@@ -0,0 +1,20 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+)
+
+var (
+	AppMetrics Metrics = NewPrometheusMetrics(consts.MetricsNamespace)
+
+	// LatencyBuckets suit operations taking from a hundred
+	// microseconds up to a few seconds.
+	LatencyBuckets = []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5}
+)
+
+// Since returns the seconds elapsed from start, as expected by latency histograms.
+func Since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
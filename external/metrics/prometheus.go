@@ -0,0 +1,123 @@
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+type PrometheusMetrics struct {
+	namespace string
+	registry  *prometheus.Registry
+
+	mu    sync.Mutex
+	funcs map[string]prometheus.Collector
+}
+
+func NewPrometheusMetrics(namespace string) Metrics {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	return &PrometheusMetrics{
+		namespace: namespace,
+		registry:  registry,
+		funcs:     make(map[string]prometheus.Collector),
+	}
+}
+
+// register returns the already registered collector when
+// the metric was created before, e.g. by another store.
+func (m *PrometheusMetrics) register(c prometheus.Collector) prometheus.Collector {
+	if err := m.registry.Register(c); err != nil {
+		if are, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return are.ExistingCollector
+		}
+		panic(err)
+	}
+	return c
+}
+
+func (m *PrometheusMetrics) Counter(name, help string, labels ...string) Counter {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: m.namespace,
+		Name:      name,
+		Help:      help,
+	}, labels)
+	return &promCounter{vec: m.register(vec).(*prometheus.CounterVec)}
+}
+
+func (m *PrometheusMetrics) Gauge(name, help string, labels ...string) Gauge {
+	vec := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: m.namespace,
+		Name:      name,
+		Help:      help,
+	}, labels)
+	return &promGauge{vec: m.register(vec).(*prometheus.GaugeVec)}
+}
+
+func (m *PrometheusMetrics) GaugeFunc(name, help string, fn func() float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if prev, ok := m.funcs[name]; ok {
+		m.registry.Unregister(prev)
+	}
+
+	gauge := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: m.namespace,
+		Name:      name,
+		Help:      help,
+	}, fn)
+	m.funcs[name] = m.register(gauge)
+}
+
+func (m *PrometheusMetrics) Histogram(name, help string, buckets []float64, labels ...string) Histogram {
+	vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: m.namespace,
+		Name:      name,
+		Help:      help,
+		Buckets:   buckets,
+	}, labels)
+	return &promHistogram{vec: m.register(vec).(*prometheus.HistogramVec)}
+}
+
+func (m *PrometheusMetrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+type promCounter struct {
+	vec *prometheus.CounterVec
+}
+
+func (c *promCounter) Inc(labels ...string) {
+	c.vec.WithLabelValues(labels...).Inc()
+}
+
+func (c *promCounter) Add(delta float64, labels ...string) {
+	c.vec.WithLabelValues(labels...).Add(delta)
+}
+
+type promGauge struct {
+	vec *prometheus.GaugeVec
+}
+
+func (g *promGauge) Set(value float64, labels ...string) {
+	g.vec.WithLabelValues(labels...).Set(value)
+}
+
+func (g *promGauge) Add(delta float64, labels ...string) {
+	g.vec.WithLabelValues(labels...).Add(delta)
+}
+
+type promHistogram struct {
+	vec *prometheus.HistogramVec
+}
+
+func (h *promHistogram) Observe(value float64, labels ...string) {
+	h.vec.WithLabelValues(labels...).Observe(value)
+}
@@ -2,10 +2,10 @@ package raft_udp_transport
 
 import (
 	"errors"
-	"io"
 	"net"
 	"time"
 
+	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/raft"
 )
 
@@ -26,10 +26,10 @@ func NewUDPTransport(
 	advertise net.Addr,
 	maxPool int,
 	timeout time.Duration,
-	logOutput io.Writer,
+	logger hclog.Logger,
 ) (*raft.NetworkTransport, error) {
 	return newUDPTransport(bindAddr, advertise, func(stream raft.StreamLayer) *raft.NetworkTransport {
-		return raft.NewNetworkTransport(stream, maxPool, timeout, logOutput)
+		return raft.NewNetworkTransportWithLogger(stream, maxPool, timeout, logger)
 	})
 }
 
@@ -0,0 +1,703 @@
+package servers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+	"github.com/alex60217101990/nietzsche/external/store"
+)
+
+var (
+	ErrUnauthenticated  = errors.New("authentication is required")
+	ErrBadCredentials   = errors.New("invalid user name, password or token")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrAuthDisabled     = errors.New("auth is disabled")
+	ErrUnknownUser      = errors.New("user not found")
+	ErrUnknownRole      = errors.New("role not found")
+	ErrInvalidName      = errors.New("names of users and roles must not be empty or contain '/'")
+	ErrEmptyPassword    = errors.New("password is required")
+	ErrInvalidAccess    = errors.New("access must be read, write or readwrite")
+	ErrRootImmutable    = errors.New("the root user and the root role can't be removed or changed")
+	ErrInsecureJoin     = errors.New("the root password is sent to https addresses only, set auth.join-token to join over http")
+)
+
+// Access granted by a permission over a key prefix.
+const (
+	AccessRead      = "read"
+	AccessWrite     = "write"
+	AccessReadWrite = "readwrite"
+)
+
+// Permission grants the access to every key starting with the prefix.
+type Permission struct {
+	Prefix string `json:"prefix"`
+	Access string `json:"access"`
+}
+
+// Role is a named set of permissions.
+type Role struct {
+	Name        string       `json:"name"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// User is an account holding roles.
+type User struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+}
+
+// userRecord is the stored user, the password is kept hashed.
+type userRecord struct {
+	User
+	PasswordHash string `json:"password_hash"`
+}
+
+// Token authenticates the requests of a user until it expires.
+type Token struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// tokenClaims are signed into a token. The fingerprint of the password
+// hash invalidates the tokens when the password changes.
+type tokenClaims struct {
+	User        string `json:"u"`
+	ExpiresAt   int64  `json:"e"`
+	Fingerprint string `json:"p"`
+}
+
+func (n *RaftNode) authEnabled() bool {
+	return n.config().Auth != nil
+}
+
+type userContextKey struct{}
+
+// withUser returns the context of a request made by the user.
+func withUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userContextKey{}, user)
+}
+
+// userFrom returns the user who made the request, nil while auth is disabled.
+func userFrom(ctx context.Context) *User {
+	user, _ := ctx.Value(userContextKey{}).(*User)
+	return user
+}
+
+func validateName(name string) error {
+	if len(name) == 0 || strings.Contains(name, "/") {
+		return ErrInvalidName
+	}
+	return nil
+}
+
+// pbkdf2 derives the key from the password as defined by RFC 8018.
+func pbkdf2(password, salt []byte, iterations, size int) []byte {
+	prf := hmac.New(sha256.New, password)
+
+	var key []byte
+	for block := uint32(1); len(key) < size; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := prf.Sum(nil)
+
+		t := append([]byte(nil), u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		key = append(key, t...)
+	}
+
+	return key[:size]
+}
+
+// hashPassword returns the salted hash of the password
+// as "pbkdf2-sha256$<iterations>$<salt>$<hash>".
+func hashPassword(password string) (string, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	hash := pbkdf2([]byte(password), salt, consts.PasswordHashIterations, sha256.Size)
+	return fmt.Sprintf("pbkdf2-sha256$%d$%s$%s", consts.PasswordHashIterations,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(hash)), nil
+}
+
+func checkPassword(encoded, password string) bool {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 4 || parts[0] != "pbkdf2-sha256" {
+		return false
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	hash, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	return hmac.Equal(hash, pbkdf2([]byte(password), salt, iterations, len(hash)))
+}
+
+// loadJSON decodes the JSON document stored under the system key.
+func (n *RaftNode) loadJSON(key string, v interface{}) error {
+	data, err := n.fsm.Get(key)
+	if err != nil {
+		return err
+	}
+
+	s, ok := data.(string)
+	if !ok {
+		return fmt.Errorf("unexpected value of %s", key)
+	}
+	return json.Unmarshal([]byte(s), v)
+}
+
+// storeJSON replicates the JSON document under the system key.
+func (n *RaftNode) storeJSON(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.Apply(store.CommandPayload{
+		Operation: "SET",
+		Key:       key,
+		Value:     string(data),
+	})
+	return err
+}
+
+func (n *RaftNode) user(name string) (*userRecord, error) {
+	var user userRecord
+	err := n.loadJSON(consts.AuthUsersKeyPreffix+name, &user)
+	if err == store.ErrKeyNotFound {
+		return nil, ErrUnknownUser
+	}
+	return &user, err
+}
+
+func (n *RaftNode) role(name string) (*Role, error) {
+	if name == consts.RootRole {
+		return &Role{
+			Name:        consts.RootRole,
+			Permissions: []Permission{{Access: AccessReadWrite}},
+		}, nil
+	}
+
+	var role Role
+	err := n.loadJSON(consts.AuthRolesKeyPreffix+name, &role)
+	if err == store.ErrKeyNotFound {
+		return nil, ErrUnknownRole
+	}
+	return &role, err
+}
+
+// User returns the user without its password.
+func (n *RaftNode) User(name string) (*User, error) {
+	record, err := n.user(name)
+	if err != nil {
+		return nil, err
+	}
+	return &record.User, nil
+}
+
+// Users lists the users in the order of their names.
+func (n *RaftNode) Users() ([]User, error) {
+	entries, err := n.fsm.Scan(consts.AuthUsersKeyPreffix, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]User, 0, len(entries))
+	for _, entry := range entries {
+		var record userRecord
+		if err = n.loadJSON(entry.Key, &record); err != nil {
+			return nil, err
+		}
+		users = append(users, record.User)
+	}
+	return users, nil
+}
+
+// Role returns the role, the root role is built in.
+func (n *RaftNode) Role(name string) (*Role, error) {
+	return n.role(name)
+}
+
+// Roles lists the roles in the order of their names, including the root role.
+func (n *RaftNode) Roles() ([]Role, error) {
+	entries, err := n.fsm.Scan(consts.AuthRolesKeyPreffix, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	root, _ := n.role(consts.RootRole)
+	roles := append(make([]Role, 0, len(entries)+1), *root)
+	for _, entry := range entries {
+		var role Role
+		if err = n.loadJSON(entry.Key, &role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	sort.Slice(roles, func(i, j int) bool {
+		return roles[i].Name < roles[j].Name
+	})
+	return roles, nil
+}
+
+// PutUser creates or updates the user, an empty password keeps
+// the current one of an existing user. The roles must exist.
+func (n *RaftNode) PutUser(name, password string, roles []string) error {
+	if !n.authEnabled() {
+		return ErrAuthDisabled
+	}
+	if err := validateName(name); err != nil {
+		return err
+	}
+	if name == consts.RootUser && !containsString(roles, consts.RootRole) {
+		return ErrRootImmutable
+	}
+	for _, role := range roles {
+		if _, err := n.role(role); err != nil {
+			return err
+		}
+	}
+
+	record, err := n.user(name)
+	switch {
+	case err == ErrUnknownUser && len(password) == 0:
+		return ErrEmptyPassword
+	case err == ErrUnknownUser:
+		record = &userRecord{}
+	case err != nil:
+		return err
+	}
+
+	record.Name, record.Roles = name, roles
+	if record.Roles == nil {
+		record.Roles = []string{}
+	}
+	if len(password) > 0 {
+		if record.PasswordHash, err = hashPassword(password); err != nil {
+			return err
+		}
+	}
+
+	return n.storeJSON(consts.AuthUsersKeyPreffix+name, record)
+}
+
+// DeleteUser removes the user, the root user can't be removed.
+func (n *RaftNode) DeleteUser(name string) error {
+	if name == consts.RootUser {
+		return ErrRootImmutable
+	}
+	if _, err := n.user(name); err != nil {
+		return err
+	}
+
+	_, err := n.Apply(store.CommandPayload{
+		Operation: "DELETE",
+		Key:       consts.AuthUsersKeyPreffix + name,
+	})
+	return err
+}
+
+// PutRole creates or replaces the role.
+func (n *RaftNode) PutRole(role Role) error {
+	if !n.authEnabled() {
+		return ErrAuthDisabled
+	}
+	if err := validateName(role.Name); err != nil {
+		return err
+	}
+	if role.Name == consts.RootRole {
+		return ErrRootImmutable
+	}
+	for _, p := range role.Permissions {
+		switch p.Access {
+		case AccessRead, AccessWrite, AccessReadWrite:
+		default:
+			return ErrInvalidAccess
+		}
+	}
+	if role.Permissions == nil {
+		role.Permissions = []Permission{}
+	}
+
+	return n.storeJSON(consts.AuthRolesKeyPreffix+role.Name, role)
+}
+
+// DeleteRole removes the role, the users holding it lose its permissions.
+func (n *RaftNode) DeleteRole(name string) error {
+	if name == consts.RootRole {
+		return ErrRootImmutable
+	}
+	if _, err := n.role(name); err != nil {
+		return err
+	}
+
+	_, err := n.Apply(store.CommandPayload{
+		Operation: "DELETE",
+		Key:       consts.AuthRolesKeyPreffix + name,
+	})
+	return err
+}
+
+// bootstrapAuth creates the token signing secret and the root user when
+// the cluster has none, it runs on the leader while auth is enabled.
+func (n *RaftNode) bootstrapAuth() error {
+	if _, err := n.fsm.Get(consts.AuthSecretKey); err == store.ErrKeyNotFound {
+		secret := make([]byte, 32)
+		if _, err = rand.Read(secret); err != nil {
+			return err
+		}
+
+		_, err = n.Apply(store.CommandPayload{
+			Operation: "SET",
+			Key:       consts.AuthSecretKey,
+			Value:     hex.EncodeToString(secret),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := n.user(consts.RootUser); err != ErrUnknownUser {
+		return err
+	}
+	password := n.config().Auth.RootPassword.Value()
+	if len(password) == 0 {
+		n.log.Warnf("the cluster has no root user and no root password is configured",
+			map[string]interface{}{
+				"raft": "auth-bootstrap",
+			})
+		return nil
+	}
+
+	return n.PutUser(consts.RootUser, password, []string{consts.RootRole})
+}
+
+func (n *RaftNode) secret() ([]byte, error) {
+	data, err := n.fsm.Get(consts.AuthSecretKey)
+	if err == store.ErrKeyNotFound {
+		// the leader has not bootstrapped the auth yet
+		return nil, ErrBadCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s, _ := data.(string)
+	return hex.DecodeString(s)
+}
+
+func fingerprint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+func sign(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// IssueToken signs a token for the user.
+func (n *RaftNode) IssueToken(name string) (*Token, error) {
+	record, err := n.user(name)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := n.secret()
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(n.config().Auth.TokenTTL.Duration()).Truncate(time.Second)
+
+	claims, err := json.Marshal(tokenClaims{
+		User:        name,
+		ExpiresAt:   expiresAt.Unix(),
+		Fingerprint: fingerprint(record.PasswordHash),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(claims)
+	return &Token{
+		Token:     payload + "." + sign(secret, payload),
+		ExpiresAt: expiresAt.UTC(),
+	}, nil
+}
+
+func (n *RaftNode) verifyToken(token string) (*User, error) {
+	secret, err := n.secret()
+	if err != nil {
+		return nil, err
+	}
+
+	dot := strings.IndexByte(token, '.')
+	if dot < 0 || !hmac.Equal([]byte(token[dot+1:]), []byte(sign(secret, token[:dot]))) {
+		return nil, ErrBadCredentials
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(token[:dot])
+	if err != nil {
+		return nil, ErrBadCredentials
+	}
+	var claims tokenClaims
+	if err = json.Unmarshal(data, &claims); err != nil || time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrBadCredentials
+	}
+
+	record, err := n.user(claims.User)
+	if err == ErrUnknownUser || (err == nil && fingerprint(record.PasswordHash) != claims.Fingerprint) {
+		return nil, ErrBadCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record.User, nil
+}
+
+// CheckPassword returns the user when the password is right.
+func (n *RaftNode) CheckPassword(name, password string) (*User, error) {
+	record, err := n.user(name)
+	if err == ErrUnknownUser || (err == nil && !checkPassword(record.PasswordHash, password)) {
+		return nil, ErrBadCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record.User, nil
+}
+
+// Authenticate returns the user of the "Basic" or "Bearer" credentials.
+func (n *RaftNode) Authenticate(authorization string) (*User, error) {
+	scheme, credentials := authorization, ""
+	if i := strings.IndexByte(authorization, ' '); i >= 0 {
+		scheme, credentials = authorization[:i], strings.TrimSpace(authorization[i+1:])
+	}
+
+	switch {
+	case len(authorization) == 0:
+		return nil, ErrUnauthenticated
+	case strings.EqualFold(scheme, "Bearer"):
+		return n.verifyToken(credentials)
+	case strings.EqualFold(scheme, "Basic"):
+		data, err := base64.StdEncoding.DecodeString(credentials)
+		if err != nil {
+			return nil, ErrBadCredentials
+		}
+		colon := strings.IndexByte(string(data), ':')
+		if colon < 0 {
+			return nil, ErrBadCredentials
+		}
+		return n.CheckPassword(string(data[:colon]), string(data[colon+1:]))
+	default:
+		return nil, ErrBadCredentials
+	}
+}
+
+func grants(granted, access string) bool {
+	return granted == AccessReadWrite || granted == access
+}
+
+// allowed reports whether any permission of the user passes the check.
+func (n *RaftNode) allowed(user *User, check func(p Permission) bool) (bool, error) {
+	for _, name := range user.Roles {
+		role, err := n.role(name)
+		if err == ErrUnknownRole {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		for _, p := range role.Permissions {
+			if check(p) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func permissionError(ok bool, err error) error {
+	if err == nil && !ok {
+		return ErrPermissionDenied
+	}
+	return err
+}
+
+// Authorize checks the access of the user to the key, scans and watches
+// check the access to their prefix, which covers every key they return.
+// Everything is allowed while auth is disabled.
+func (n *RaftNode) Authorize(user *User, key, access string) error {
+	if !n.authEnabled() {
+		return nil
+	}
+	if user == nil {
+		return ErrUnauthenticated
+	}
+	if access == AccessReadWrite {
+		// the access may be granted by different roles
+		if err := n.Authorize(user, key, AccessRead); err != nil {
+			return err
+		}
+		access = AccessWrite
+	}
+
+	return permissionError(n.allowed(user, func(p Permission) bool {
+		return strings.HasPrefix(key, p.Prefix) && grants(p.Access, access)
+	}))
+}
+
+// AuthorizeTxn checks the read access to the compared and read keys,
+// the write access to the written ones and the access to their leases.
+func (n *RaftNode) AuthorizeTxn(user *User, txn *store.Txn) error {
+	if txn == nil {
+		return nil
+	}
+
+	for _, cmp := range txn.Compare {
+		if err := n.Authorize(user, cmp.Key, AccessRead); err != nil {
+			return err
+		}
+	}
+	for _, ops := range [][]store.TxnOp{txn.Success, txn.Failure} {
+		for _, op := range ops {
+			access := AccessWrite
+			if strings.EqualFold(op.Operation, "GET") {
+				access = AccessRead
+			}
+			if err := n.Authorize(user, op.Key, access); err != nil {
+				return err
+			}
+			if op.KeepLease {
+				continue
+			}
+			if err := n.AuthorizeLease(user, op.Lease); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// AuthorizeLeases checks the access to the lease APIs, they are open
+// to the users allowed to write any key. A granted lease is used
+// by its owner only, see AuthorizeLease.
+func (n *RaftNode) AuthorizeLeases(user *User) error {
+	if !n.authEnabled() {
+		return nil
+	}
+	if user == nil {
+		return ErrUnauthenticated
+	}
+
+	return permissionError(n.allowed(user, func(p Permission) bool {
+		return grants(p.Access, AccessWrite)
+	}))
+}
+
+// AuthorizeLease checks the access to the lease, it's used by the user who
+// granted it and by root only. Keys are attached, and the lease is kept
+// alive or revoked with them. A zero id stands for no lease.
+func (n *RaftNode) AuthorizeLease(user *User, id uint64) error {
+	if !n.authEnabled() || id == 0 {
+		return nil
+	}
+	if user == nil {
+		return ErrUnauthenticated
+	}
+	if containsString(user.Roles, consts.RootRole) {
+		return nil
+	}
+
+	lease, err := n.lease(id)
+	if err != nil {
+		return err
+	}
+	if lease.Owner != user.Name {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// AuthorizeJoin checks the join token sent by a server joining the
+// cluster, it's missing while the servers join with the root user.
+func (n *RaftNode) AuthorizeJoin(token string) error {
+	if !n.authEnabled() {
+		return nil
+	}
+
+	expected := n.config().Auth.JoinToken.Value()
+	if len(token) == 0 || len(expected) == 0 {
+		return ErrUnauthenticated
+	}
+	if !hmac.Equal([]byte(token), []byte(expected)) {
+		return ErrBadCredentials
+	}
+	return nil
+}
+
+// AuthorizeRoot checks that the user holds the root role, it's
+// required by the cluster management and the auth APIs.
+func (n *RaftNode) AuthorizeRoot(user *User) error {
+	if !n.authEnabled() {
+		return nil
+	}
+	if user == nil {
+		return ErrUnauthenticated
+	}
+	if !containsString(user.Roles, consts.RootRole) {
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+// userName returns the name of the user, empty while auth is disabled.
+func userName(user *User) string {
+	if user == nil {
+		return ""
+	}
+	return user.Name
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,239 @@
+package servers
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+	"github.com/alex60217101990/nietzsche/external/helpers"
+	"github.com/alex60217101990/nietzsche/external/store"
+
+	"github.com/hashicorp/raft"
+)
+
+var (
+	ErrAutopilotDisabled = errors.New("autopilot is disabled")
+)
+
+// ServerHealth is the autopilot view of a single server.
+type ServerHealth struct {
+	ID               string     `json:"id"`
+	Address          string     `json:"address"`
+	Suffrage         string     `json:"suffrage"`
+	Healthy          bool       `json:"healthy"`
+	LastContact      *time.Time `json:"last_contact,omitempty"`
+	TrailingLogs     uint64     `json:"trailing_logs"`
+	StableSince      *time.Time `json:"stable_since,omitempty"`
+	FailedSince      *time.Time `json:"failed_since,omitempty"`
+	PendingPromotion bool       `json:"pending_promotion"`
+}
+
+// autopilot runs on the leader. It removes servers which have been failing
+// for too long and promotes joined servers to voters once they are stable.
+type autopilot struct {
+	node *RaftNode
+
+	mu     sync.RWMutex
+	health map[raft.ServerID]*ServerHealth
+}
+
+func newAutopilot(node *RaftNode) *autopilot {
+	return &autopilot{
+		node:   node,
+		health: make(map[raft.ServerID]*ServerHealth),
+	}
+}
+
+func seconds(n uint64) time.Duration {
+	return time.Duration(n) * time.Second
+}
+
+// run checks the servers until the stop channel is closed,
+// it's started each time the node becomes the leader.
+func (a *autopilot) run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(seconds(uint64(a.node.config().Autopilot.Interval)))
+	defer ticker.Stop()
+
+	a.mu.Lock()
+	a.health = make(map[raft.ServerID]*ServerHealth)
+	a.mu.Unlock()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := a.check(); err != nil {
+				a.node.log.Errorf(err.Error(),
+					map[string]interface{}{
+						"raft": "autopilot",
+					})
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+func (a *autopilot) check() error {
+	cfg, _, err := a.node.configuration()
+	if err != nil {
+		return err
+	}
+
+	var (
+		conf         = a.node.config().Autopilot
+		now          = time.Now()
+		lastIndex    = a.node.raft.LastIndex()
+		localID      = raft.ServerID(a.node.config().Raft.NodeID)
+		contactLimit = seconds(uint64(conf.LastContactThreshold))
+		maxTrailing  = conf.MaxTrailingLogs
+	)
+
+	health := make(map[raft.ServerID]*ServerHealth, len(cfg.Servers))
+	for _, server := range cfg.Servers {
+		h := &ServerHealth{
+			ID:       string(server.ID),
+			Address:  string(server.Address),
+			Suffrage: suffrageName(server.Suffrage),
+		}
+
+		if server.ID == localID {
+			h.Healthy = true
+			h.LastContact = helpers.TimeToTimePtr(now)
+		} else if progress, ok := a.node.transport.Get(server.ID); ok {
+			h.LastContact = helpers.TimeToTimePtr(progress.LastContact)
+			if lastIndex > progress.MatchIndex {
+				h.TrailingLogs = lastIndex - progress.MatchIndex
+			}
+			h.Healthy = now.Sub(progress.LastContact) < contactLimit && h.TrailingLogs <= maxTrailing
+		}
+
+		a.mu.RLock()
+		prev, ok := a.health[server.ID]
+		a.mu.RUnlock()
+
+		switch {
+		case h.Healthy && ok && prev.StableSince != nil:
+			h.StableSince = prev.StableSince
+		case h.Healthy:
+			h.StableSince = helpers.TimeToTimePtr(now)
+		case ok && prev.FailedSince != nil:
+			h.FailedSince = prev.FailedSince
+		default:
+			h.FailedSince = helpers.TimeToTimePtr(now)
+		}
+
+		_, err = a.node.fsm.Get(consts.PromoteKeyPreffix + string(server.ID))
+		h.PendingPromotion = err == nil
+
+		health[server.ID] = h
+	}
+
+	a.mu.Lock()
+	a.health = health
+	a.mu.Unlock()
+
+	for _, server := range cfg.Servers {
+		if server.ID == localID {
+			continue
+		}
+
+		h := health[server.ID]
+		switch {
+		case !h.Healthy && conf.CleanupDeadServers &&
+			now.Sub(*h.FailedSince) > seconds(uint64(conf.DeadServerThreshold)):
+			a.removeDeadServer(server)
+		case h.PendingPromotion && server.Suffrage == raft.Voter:
+			// the server became a voter in some other way
+			a.logError(a.node.clearPromotion(string(server.ID)), server)
+		case h.PendingPromotion && h.Healthy &&
+			now.Sub(*h.StableSince) >= seconds(uint64(conf.StableServerThreshold)):
+			a.promote(server)
+		}
+	}
+
+	return nil
+}
+
+func (a *autopilot) removeDeadServer(server raft.Server) {
+	err := a.node.RemoveServer(string(server.ID), false)
+	if err == nil {
+		a.node.log.Infof("autopilot removed dead server",
+			map[string]interface{}{
+				"raft":   "autopilot",
+				"server": server.ID,
+			})
+	}
+	a.logError(err, server)
+}
+
+func (a *autopilot) promote(server raft.Server) {
+	err := a.node.AddVoter(string(server.ID), string(server.Address))
+	if err == nil {
+		a.node.log.Infof("autopilot promoted server to voter",
+			map[string]interface{}{
+				"raft":   "autopilot",
+				"server": server.ID,
+			})
+		err = a.node.clearPromotion(string(server.ID))
+	}
+	a.logError(err, server)
+}
+
+func (a *autopilot) logError(err error, server raft.Server) {
+	if err == nil {
+		return
+	}
+
+	a.node.log.Errorf(err.Error(),
+		map[string]interface{}{
+			"raft":   "autopilot",
+			"server": server.ID,
+		})
+}
+
+// Health returns the servers health as of the last check.
+func (a *autopilot) Health() []ServerHealth {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	health := make([]ServerHealth, 0, len(a.health))
+	for _, h := range a.health {
+		health = append(health, *h)
+	}
+	sort.Slice(health, func(i, j int) bool {
+		return health[i].ID < health[j].ID
+	})
+
+	return health
+}
+
+// AutopilotHealth returns the servers health tracked by the autopilot,
+// the data is only available on the leader.
+func (n *RaftNode) AutopilotHealth() ([]ServerHealth, error) {
+	if n.autopilot == nil {
+		return nil, ErrAutopilotDisabled
+	}
+	if !n.IsLeader() {
+		return nil, raft.ErrNotLeader
+	}
+	return n.autopilot.Health(), nil
+}
+
+func (n *RaftNode) markForPromotion(id string) error {
+	_, err := n.Apply(store.CommandPayload{
+		Operation: "SET",
+		Key:       consts.PromoteKeyPreffix + id,
+		Value:     true,
+	})
+	return err
+}
+
+func (n *RaftNode) clearPromotion(id string) error {
+	_, err := n.Apply(store.CommandPayload{
+		Operation: "DELETE",
+		Key:       consts.PromoteKeyPreffix + id,
+	})
+	return err
+}
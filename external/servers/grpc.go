@@ -0,0 +1,252 @@
+package servers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/logger"
+	"github.com/alex60217101990/nietzsche/external/servers/pb"
+
+	"github.com/hashicorp/raft"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// forwardedMetadata marks calls forwarded to the leader, so they
+	// are not forwarded again while the leadership is changing.
+	forwardedMetadata = "x-nietzsche-forwarded"
+	// requestIDMetadata carries the ID of the call, it's sent
+	// back in the header and passed on when the call is forwarded.
+	requestIDMetadata = "x-request-id"
+)
+
+// GRPCServer is the gRPC API of the node, it serves
+// the KV, Cluster and Maintenance services.
+type GRPCServer struct {
+	node   *RaftNode
+	server *grpc.Server
+	addr   string
+
+	mu    sync.Mutex
+	conns map[string]*grpc.ClientConn
+
+	// closed on shutdown to end the streaming calls
+	closeCh chan struct{}
+}
+
+func NewGRPCServer(node *RaftNode) *GRPCServer {
+	s := &GRPCServer{
+		node:    node,
+		addr:    fmt.Sprintf("%s:%d", node.config().GRPC.Host, node.config().GRPC.Port),
+		conns:   make(map[string]*grpc.ClientConn),
+		closeCh: make(chan struct{}),
+	}
+	s.server = grpc.NewServer(
+		grpc.UnaryInterceptor(s.unaryInterceptor),
+		grpc.StreamInterceptor(s.streamInterceptor),
+	)
+
+	pb.RegisterKVServer(s.server, &kvService{GRPCServer: s})
+	pb.RegisterClusterServer(s.server, &clusterService{GRPCServer: s})
+	pb.RegisterMaintenanceServer(s.server, &maintenanceService{GRPCServer: s})
+
+	return s
+}
+
+func (s *GRPCServer) Start() error {
+	listener, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != grpc.ErrServerStopped {
+			s.node.log.Error(err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *GRPCServer) Close() error {
+	close(s.closeCh)
+
+	stopped := make(chan struct{})
+	go func() {
+		s.server.GracefulStop()
+		close(stopped)
+	}()
+
+	if timeout := s.node.config().Timeouts.Timeout(); timeout > 0 {
+		select {
+		case <-stopped:
+		case <-time.After(timeout):
+			s.server.Stop()
+		}
+	} else {
+		<-stopped
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for address, conn := range s.conns {
+		conn.Close()
+		delete(s.conns, address)
+	}
+
+	return nil
+}
+
+// forward returns the connection to the leader and the context to call it
+// with. The connection is nil when the call has to be served locally.
+func (s *GRPCServer) forward(ctx context.Context) (*grpc.ClientConn, context.Context, error) {
+	if s.node.IsLeader() {
+		return nil, ctx, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	if len(md.Get(forwardedMetadata)) > 0 {
+		return nil, ctx, raft.ErrNotLeader
+	}
+
+	address, err := s.node.LeaderGRPCAddr()
+	if err != nil {
+		return nil, ctx, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	conn, ok := s.conns[address]
+	if !ok {
+		// the connection is established lazily by the first call
+		if conn, err = grpc.Dial(address, grpc.WithInsecure()); err != nil {
+			return nil, ctx, err
+		}
+		s.conns[address] = conn
+	}
+
+	md = md.Copy()
+	md.Set(forwardedMetadata, s.node.config().Raft.NodeID)
+	md.Set(requestIDMetadata, logger.RequestID(ctx))
+	return conn, metadata.NewOutgoingContext(ctx, md), nil
+}
+
+// grpcError maps the errors of the node to gRPC statuses,
+// the same way the HTTP API maps them to HTTP ones.
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	code := codes.Internal
+	switch errorStatus(err) {
+	case http.StatusUnauthorized:
+		code = codes.Unauthenticated
+	case http.StatusForbidden:
+		code = codes.PermissionDenied
+	case http.StatusBadRequest:
+		code = codes.InvalidArgument
+	case http.StatusNotFound:
+		code = codes.NotFound
+	case http.StatusPreconditionFailed:
+		code = codes.FailedPrecondition
+	case http.StatusMisdirectedRequest, http.StatusServiceUnavailable:
+		code = codes.Unavailable
+	}
+
+	return status.Error(code, err.Error())
+}
+
+const (
+	// authorizationMetadata holds the same credentials
+	// as the "Authorization" header of the HTTP API
+	authorizationMetadata = "authorization"
+
+	readyMethod = "/nietzsche.v1.Maintenance/Ready"
+)
+
+// rootMethod reports whether the call is restricted to the root users.
+func rootMethod(method string) bool {
+	return strings.HasPrefix(method, "/nietzsche.v1.Cluster/") ||
+		method == "/nietzsche.v1.Maintenance/Snapshot" ||
+		method == "/nietzsche.v1.Maintenance/Restore"
+}
+
+// authenticate resolves the user of the call, every call
+// but the readiness check requires a user while auth is enabled.
+func (s *GRPCServer) authenticate(ctx context.Context, method string) (context.Context, error) {
+	if !s.node.authEnabled() || method == readyMethod {
+		return ctx, nil
+	}
+
+	var authorization string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(authorizationMetadata); len(values) > 0 {
+		authorization = values[0]
+	}
+
+	user, err := s.node.Authenticate(authorization)
+	if err != nil {
+		return ctx, grpcError(err)
+	}
+	if rootMethod(method) {
+		if err = s.node.AuthorizeRoot(user); err != nil {
+			return ctx, grpcError(err)
+		}
+	}
+	return withUser(ctx, user), nil
+}
+
+// identify gives the call its ID, the one sent by the client or a new one.
+func (s *GRPCServer) identify(ctx context.Context) context.Context {
+	var id string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(requestIDMetadata); len(values) > 0 {
+		id = values[0]
+	}
+
+	ctx = s.node.requestContext(ctx, id)
+	_ = grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadata, logger.RequestID(ctx)))
+	return ctx
+}
+
+func (s *GRPCServer) unaryInterceptor(ctx context.Context, req interface{},
+	info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := s.authenticate(s.identify(ctx), info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+// authenticatedStream carries the user and the ID of the streaming call in its context.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *GRPCServer) streamInterceptor(srv interface{}, stream grpc.ServerStream,
+	info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := s.authenticate(s.identify(stream.Context()), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ServerStream: stream, ctx: ctx})
+}
@@ -0,0 +1,151 @@
+package servers
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/configs"
+	"github.com/alex60217101990/nietzsche/external/servers/pb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type clusterService struct {
+	pb.UnimplementedClusterServer
+	*GRPCServer
+}
+
+func timestampToPB(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+func membersToPB(servers []ServerInfo) []*pb.Member {
+	members := make([]*pb.Member, 0, len(servers))
+	for _, server := range servers {
+		members = append(members, &pb.Member{
+			Id:          server.ID,
+			Address:     server.Address,
+			Suffrage:    server.Suffrage,
+			Leader:      server.Leader,
+			LastContact: timestampToPB(server.LastContact),
+			MatchIndex:  server.MatchIndex,
+		})
+	}
+	return members
+}
+
+func (s *clusterService) MemberList(ctx context.Context, req *pb.MemberListRequest) (*pb.MemberListResponse, error) {
+	membership, err := s.node.Members()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &pb.MemberListResponse{
+		Index:   membership.Index,
+		Members: membersToPB(membership.Servers),
+	}, nil
+}
+
+func (s *clusterService) MemberAdd(ctx context.Context, req *pb.MemberAddRequest) (*pb.MemberAddResponse, error) {
+	conn, fctx, err := s.forward(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if conn != nil {
+		return pb.NewClusterClient(conn).MemberAdd(fctx, req)
+	}
+
+	var suffrage configs.Suffrage
+	if len(req.Suffrage) > 0 {
+		if err = suffrage.Set(strings.ToLower(req.Suffrage)); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	if err = s.node.Join(req.Id, req.Address, req.ApiAddress, suffrage); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.MemberAddResponse{}, nil
+}
+
+func (s *clusterService) MemberRemove(ctx context.Context, req *pb.MemberRemoveRequest) (*pb.MemberRemoveResponse, error) {
+	conn, fctx, err := s.forward(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if conn != nil {
+		return pb.NewClusterClient(conn).MemberRemove(fctx, req)
+	}
+
+	if err = s.node.RemoveServer(req.Id, req.Force); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.MemberRemoveResponse{}, nil
+}
+
+func (s *clusterService) MemberDemote(ctx context.Context, req *pb.MemberDemoteRequest) (*pb.MemberDemoteResponse, error) {
+	conn, fctx, err := s.forward(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if conn != nil {
+		return pb.NewClusterClient(conn).MemberDemote(fctx, req)
+	}
+
+	if err = s.node.DemoteVoter(req.Id, req.Force); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.MemberDemoteResponse{}, nil
+}
+
+func (s *clusterService) LeaderTransfer(ctx context.Context, req *pb.LeaderTransferRequest) (*pb.LeaderTransferResponse, error) {
+	conn, fctx, err := s.forward(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if conn != nil {
+		return pb.NewClusterClient(conn).LeaderTransfer(fctx, req)
+	}
+
+	if err = s.node.LeadershipTransfer(req.Id); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.LeaderTransferResponse{}, nil
+}
+
+func (s *clusterService) AutopilotHealth(ctx context.Context, req *pb.AutopilotHealthRequest) (*pb.AutopilotHealthResponse, error) {
+	conn, fctx, err := s.forward(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if conn != nil {
+		return pb.NewClusterClient(conn).AutopilotHealth(fctx, req)
+	}
+
+	health, err := s.node.AutopilotHealth()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &pb.AutopilotHealthResponse{Servers: make([]*pb.ServerHealth, 0, len(health))}
+	for _, h := range health {
+		resp.Servers = append(resp.Servers, &pb.ServerHealth{
+			Id:               h.ID,
+			Address:          h.Address,
+			Suffrage:         h.Suffrage,
+			Healthy:          h.Healthy,
+			LastContact:      timestampToPB(h.LastContact),
+			TrailingLogs:     h.TrailingLogs,
+			StableSince:      timestampToPB(h.StableSince),
+			FailedSince:      timestampToPB(h.FailedSince),
+			PendingPromotion: h.PendingPromotion,
+		})
+	}
+	return resp, nil
+}
@@ -0,0 +1,334 @@
+package servers
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/alex60217101990/nietzsche/external/servers/pb"
+	"github.com/alex60217101990/nietzsche/external/store"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type kvService struct {
+	pb.UnimplementedKVServer
+	*GRPCServer
+}
+
+func encodeValue(value interface{}) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	return json.Marshal(value)
+}
+
+// decodeValue reads the JSON value, empty data is decoded as nil.
+func decodeValue(data []byte) (value interface{}, err error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	if err = json.Unmarshal(data, &value); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid JSON value: %v", err)
+	}
+	return value, nil
+}
+
+func consistencyFromPB(c pb.Consistency) Consistency {
+	if c == pb.Consistency_STALE {
+		return Stale
+	}
+	return Consistent
+}
+
+func (s *kvService) Get(ctx context.Context, req *pb.GetRequest) (*pb.GetResponse, error) {
+	consistency := consistencyFromPB(req.Consistency)
+	if consistency == Consistent {
+		conn, fctx, err := s.forward(ctx)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+		if conn != nil {
+			return pb.NewKVClient(conn).Get(fctx, req)
+		}
+	}
+
+	if err := s.node.Authorize(userFrom(ctx), req.Key, AccessRead); err != nil {
+		return nil, grpcError(err)
+	}
+
+	value, err := s.node.Get(ctx, req.Key, consistency)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	data, err := encodeValue(value)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.GetResponse{Kv: &pb.KeyValue{Key: req.Key, Value: data}}, nil
+}
+
+func (s *kvService) Put(ctx context.Context, req *pb.PutRequest) (*pb.PutResponse, error) {
+	conn, fctx, err := s.forward(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if conn != nil {
+		return pb.NewKVClient(conn).Put(fctx, req)
+	}
+
+	if len(req.Value) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "value is required")
+	}
+	if err = s.node.Authorize(userFrom(ctx), req.Key, AccessWrite); err != nil {
+		return nil, grpcError(err)
+	}
+	if err = s.node.AuthorizeLease(userFrom(ctx), req.Lease); err != nil {
+		return nil, grpcError(err)
+	}
+	value, err := decodeValue(req.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.node.Set(ctx, req.Key, value, req.Lease); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.PutResponse{}, nil
+}
+
+func (s *kvService) Delete(ctx context.Context, req *pb.DeleteRequest) (*pb.DeleteResponse, error) {
+	conn, fctx, err := s.forward(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if conn != nil {
+		return pb.NewKVClient(conn).Delete(fctx, req)
+	}
+
+	if err = s.node.Authorize(userFrom(ctx), req.Key, AccessWrite); err != nil {
+		return nil, grpcError(err)
+	}
+	if err = s.node.Delete(ctx, req.Key); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.DeleteResponse{}, nil
+}
+
+func (s *kvService) Scan(ctx context.Context, req *pb.ScanRequest) (*pb.ScanResponse, error) {
+	if req.Limit < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit can't be negative")
+	}
+
+	consistency := consistencyFromPB(req.Consistency)
+	if consistency == Consistent {
+		conn, fctx, err := s.forward(ctx)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+		if conn != nil {
+			return pb.NewKVClient(conn).Scan(fctx, req)
+		}
+	}
+
+	if err := s.node.Authorize(userFrom(ctx), req.Prefix, AccessRead); err != nil {
+		return nil, grpcError(err)
+	}
+
+	entries, err := s.node.Scan(req.Prefix, int(req.Limit), consistency)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &pb.ScanResponse{Kvs: make([]*pb.KeyValue, 0, len(entries))}
+	for _, entry := range entries {
+		data, err := encodeValue(entry.Value)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+		resp.Kvs = append(resp.Kvs, &pb.KeyValue{Key: entry.Key, Value: data})
+	}
+	return resp, nil
+}
+
+func txnOpsFromPB(ops []*pb.TxnOp) ([]store.TxnOp, error) {
+	result := make([]store.TxnOp, 0, len(ops))
+	for _, op := range ops {
+		value, err := decodeValue(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, store.TxnOp{
+			Operation: op.Operation.String(),
+			Key:       op.Key,
+			Value:     value,
+			Lease:     op.Lease,
+		})
+	}
+	return result, nil
+}
+
+func (s *kvService) Txn(ctx context.Context, req *pb.TxnRequest) (*pb.TxnResponse, error) {
+	conn, fctx, err := s.forward(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if conn != nil {
+		return pb.NewKVClient(conn).Txn(fctx, req)
+	}
+
+	txn := &store.Txn{
+		Compare: make([]store.Compare, 0, len(req.Compare)),
+	}
+	for _, cmp := range req.Compare {
+		value, err := decodeValue(cmp.Value)
+		if err != nil {
+			return nil, err
+		}
+		txn.Compare = append(txn.Compare, store.Compare{
+			Key:    cmp.Key,
+			Result: strings.ToLower(cmp.Result.String()),
+			Value:  value,
+		})
+	}
+	if txn.Success, err = txnOpsFromPB(req.Success); err != nil {
+		return nil, err
+	}
+	if txn.Failure, err = txnOpsFromPB(req.Failure); err != nil {
+		return nil, err
+	}
+
+	if err = s.node.AuthorizeTxn(userFrom(ctx), txn); err != nil {
+		return nil, grpcError(err)
+	}
+
+	result, err := s.node.Txn(ctx, txn)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &pb.TxnResponse{
+		Succeeded: result.Succeeded,
+		Results:   make([]*pb.TxnOpResult, 0, len(result.Results)),
+	}
+	for _, r := range result.Results {
+		data, err := encodeValue(r.Value)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+		resp.Results = append(resp.Results, &pb.TxnOpResult{
+			Operation: pb.TxnOp_Operation(pb.TxnOp_Operation_value[r.Operation]),
+			Key:       r.Key,
+			Value:     data,
+			Found:     r.Found,
+		})
+	}
+	return resp, nil
+}
+
+// Watch is served by whichever server receives it.
+func (s *kvService) Watch(req *pb.WatchRequest, stream pb.KV_WatchServer) error {
+	if err := s.node.Authorize(userFrom(stream.Context()), req.Prefix, AccessRead); err != nil {
+		return grpcError(err)
+	}
+
+	events, cancel, err := s.node.Watch(req.Prefix)
+	if err != nil {
+		return grpcError(err)
+	}
+	defer cancel()
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return status.Error(codes.Aborted, "watch fell behind or the store was restored")
+			}
+
+			data, err := encodeValue(event.Value)
+			if err != nil {
+				return grpcError(err)
+			}
+			err = stream.Send(&pb.Event{
+				Type:  pb.Event_EventType(pb.Event_EventType_value[event.Type]),
+				Key:   event.Key,
+				Value: data,
+				Index: event.Index,
+			})
+			if err != nil {
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
+		case <-s.closeCh:
+			return status.Error(codes.Unavailable, "server is shutting down")
+		}
+	}
+}
+
+func (s *kvService) LeaseGrant(ctx context.Context, req *pb.LeaseGrantRequest) (*pb.Lease, error) {
+	conn, fctx, err := s.forward(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if conn != nil {
+		return pb.NewKVClient(conn).LeaseGrant(fctx, req)
+	}
+
+	if err = s.node.AuthorizeLeases(userFrom(ctx)); err != nil {
+		return nil, grpcError(err)
+	}
+
+	lease, err := s.node.Grant(ctx, req.Ttl, userName(userFrom(ctx)))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.Lease{Id: lease.ID, Ttl: lease.TTL}, nil
+}
+
+func (s *kvService) LeaseRevoke(ctx context.Context, req *pb.LeaseRevokeRequest) (*pb.LeaseRevokeResponse, error) {
+	conn, fctx, err := s.forward(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if conn != nil {
+		return pb.NewKVClient(conn).LeaseRevoke(fctx, req)
+	}
+
+	if err = s.node.AuthorizeLeases(userFrom(ctx)); err != nil {
+		return nil, grpcError(err)
+	}
+	if err = s.node.AuthorizeLease(userFrom(ctx), req.Id); err != nil {
+		return nil, grpcError(err)
+	}
+
+	if err = s.node.Revoke(ctx, req.Id); err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.LeaseRevokeResponse{}, nil
+}
+
+func (s *kvService) LeaseKeepAlive(ctx context.Context, req *pb.LeaseKeepAliveRequest) (*pb.Lease, error) {
+	conn, fctx, err := s.forward(ctx)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if conn != nil {
+		return pb.NewKVClient(conn).LeaseKeepAlive(fctx, req)
+	}
+
+	if err = s.node.AuthorizeLeases(userFrom(ctx)); err != nil {
+		return nil, grpcError(err)
+	}
+	if err = s.node.AuthorizeLease(userFrom(ctx), req.Id); err != nil {
+		return nil, grpcError(err)
+	}
+
+	lease, err := s.node.KeepAlive(req.Id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &pb.Lease{Id: lease.ID, Ttl: lease.TTL}, nil
+}
@@ -0,0 +1,185 @@
+package servers
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/alex60217101990/nietzsche/external/servers/pb"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// snapshotChunkSize limits the size of the streamed snapshot messages.
+const snapshotChunkSize = 64 << 10
+
+type maintenanceService struct {
+	pb.UnimplementedMaintenanceServer
+	*GRPCServer
+}
+
+func (s *maintenanceService) Status(ctx context.Context, req *pb.StatusRequest) (*pb.StatusResponse, error) {
+	st, err := s.node.Status()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	return &pb.StatusResponse{
+		NodeId:            st.NodeID,
+		State:             st.State,
+		LeaderId:          st.LeaderID,
+		LeaderAddress:     st.LeaderAddress,
+		LeaderApiAddress:  st.LeaderAPIAddress,
+		Term:              st.Term,
+		LastLogIndex:      st.LastLogIndex,
+		LastLogTerm:       st.LastLogTerm,
+		CommitIndex:       st.CommitIndex,
+		AppliedIndex:      st.AppliedIndex,
+		FsmPending:        st.FSMPending,
+		LastContact:       st.LastContact,
+		LastSnapshotIndex: st.LastSnapshotIndex,
+		LastSnapshotTerm:  st.LastSnapshotTerm,
+		Peers:             membersToPB(st.Peers),
+	}, nil
+}
+
+func (s *maintenanceService) Ready(ctx context.Context, req *pb.ReadyRequest) (*pb.ReadyResponse, error) {
+	if err := s.node.Ready(); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &pb.ReadyResponse{}, nil
+}
+
+// chunkWriter sends the written data as snapshot chunks.
+type chunkWriter struct {
+	stream pb.Maintenance_SnapshotServer
+}
+
+func (w *chunkWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		size := len(p)
+		if size > snapshotChunkSize {
+			size = snapshotChunkSize
+		}
+		if err = w.stream.Send(&pb.SnapshotChunk{Data: p[:size]}); err != nil {
+			return n, err
+		}
+		n += size
+		p = p[size:]
+	}
+	return n, nil
+}
+
+func (s *maintenanceService) Snapshot(req *pb.SnapshotRequest, stream pb.Maintenance_SnapshotServer) error {
+	if consistencyFromPB(req.Consistency) == Consistent {
+		conn, fctx, err := s.forward(stream.Context())
+		if err != nil {
+			return grpcError(err)
+		}
+		if conn != nil {
+			return s.relaySnapshot(fctx, pb.NewMaintenanceClient(conn), req, stream)
+		}
+	}
+
+	return grpcError(s.node.Backup(&chunkWriter{stream: stream}))
+}
+
+func (s *maintenanceService) relaySnapshot(ctx context.Context, client pb.MaintenanceClient,
+	req *pb.SnapshotRequest, stream pb.Maintenance_SnapshotServer) error {
+	leader, err := client.Snapshot(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		chunk, err := leader.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(chunk); err != nil {
+			return err
+		}
+	}
+}
+
+// Restore spools the chunks to a temporary file,
+// raft has to know the size of the snapshot up front.
+func (s *maintenanceService) Restore(stream pb.Maintenance_RestoreServer) error {
+	conn, fctx, err := s.forward(stream.Context())
+	if err != nil {
+		return grpcError(err)
+	}
+	if conn != nil {
+		return s.relayRestore(fctx, pb.NewMaintenanceClient(conn), stream)
+	}
+
+	tmp, err := ioutil.TempFile("", "nietzsche-restore-")
+	if err != nil {
+		return grpcError(err)
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	var size int64
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		n, err := tmp.Write(chunk.Data)
+		if err != nil {
+			return grpcError(err)
+		}
+		size += int64(n)
+	}
+
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		return grpcError(err)
+	}
+	if err = s.node.RestoreSnapshot(tmp, size); err != nil {
+		return grpcError(err)
+	}
+
+	return stream.SendAndClose(&pb.RestoreResponse{})
+}
+
+func (s *maintenanceService) relayRestore(ctx context.Context, client pb.MaintenanceClient, stream pb.Maintenance_RestoreServer) error {
+	leader, err := client.Restore(ctx)
+	if err != nil {
+		return err
+	}
+
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err = leader.Send(chunk); err == io.EOF {
+			// the leader failed the call, CloseAndRecv returns the status
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	resp, err := leader.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(resp)
+}
@@ -0,0 +1,174 @@
+package servers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+type putUserRequest struct {
+	Password string   `json:"password"`
+	Roles    []string `json:"roles"`
+}
+
+type putRoleRequest struct {
+	Permissions []Permission `json:"permissions"`
+}
+
+// handleToken serves
+//
+//	POST /v1/auth/token - issue a token for the user of the basic credentials
+//
+// Tokens are signed with the replicated secret, so they're issued and
+// accepted by every server of the cluster.
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	user := userFrom(r.Context())
+	if user == nil {
+		s.writeError(w, ErrAuthDisabled)
+		return
+	}
+
+	token, err := s.node.IssueToken(user.Name)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, token)
+}
+
+// handleUsers serves
+//
+//	GET /v1/auth/users - list the users
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	users, err := s.node.Users()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, users)
+}
+
+// handleUser serves
+//
+//	GET    /v1/auth/users/{name} - read the user
+//	PUT    /v1/auth/users/{name} - create or update the user from the JSON body
+//	DELETE /v1/auth/users/{name} - remove the user
+//
+// Writes are forwarded to the leader.
+func (s *Server) handleUser(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/v1/auth/users/")
+
+	switch r.Method {
+	case http.MethodGet:
+		user, err := s.node.User(name)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, user)
+	case http.MethodPut:
+		if s.forward(w, r) {
+			return
+		}
+
+		var req putUserRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+
+		if err := s.node.PutUser(name, req.Password, req.Roles); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusNoContent, nil)
+	case http.MethodDelete:
+		if s.forward(w, r) {
+			return
+		}
+
+		if err := s.node.DeleteUser(name); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusNoContent, nil)
+	default:
+		s.methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// handleRoles serves
+//
+//	GET /v1/auth/roles - list the roles
+func (s *Server) handleRoles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	roles, err := s.node.Roles()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, roles)
+}
+
+// handleRole serves
+//
+//	GET    /v1/auth/roles/{name} - read the role
+//	PUT    /v1/auth/roles/{name} - replace the permissions of the role from the JSON body
+//	DELETE /v1/auth/roles/{name} - remove the role
+//
+// Writes are forwarded to the leader.
+func (s *Server) handleRole(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/v1/auth/roles/")
+
+	switch r.Method {
+	case http.MethodGet:
+		role, err := s.node.Role(name)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, role)
+	case http.MethodPut:
+		if s.forward(w, r) {
+			return
+		}
+
+		var req putRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+
+		if err := s.node.PutRole(Role{Name: name, Permissions: req.Permissions}); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusNoContent, nil)
+	case http.MethodDelete:
+		if s.forward(w, r) {
+			return
+		}
+
+		if err := s.node.DeleteRole(name); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusNoContent, nil)
+	default:
+		s.methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
@@ -0,0 +1,25 @@
+package servers
+
+import (
+	"net/http"
+)
+
+// handleAutopilotHealth serves
+//
+//	GET /v1/autopilot/health - the servers health tracked by the leader
+func (s *Server) handleAutopilotHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if s.forward(w, r) {
+		return
+	}
+
+	health, err := s.node.AutopilotHealth()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, health)
+}
@@ -0,0 +1,19 @@
+package servers
+
+import (
+	"net/http"
+)
+
+// handleConfig serves
+//
+//	GET /v1/config - effective configuration of the server, the secrets are redacted
+//
+// Every server answers with its own configuration, the defaults included.
+func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, s.node.config().Redacted())
+}
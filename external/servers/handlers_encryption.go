@@ -0,0 +1,36 @@
+package servers
+
+import (
+	"net/http"
+)
+
+// handleEncryption serves
+//
+//	GET /v1/encryption - keys of the local store and progress of their rotation
+func (s *Server) handleEncryption(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, s.node.EncryptionStatus())
+}
+
+// handleKeyRotation serves
+//
+//	POST /v1/encryption/rotate - reload the keyfile and re-encrypt the local store with its active key
+//
+// Rotations are served by whichever server receives them,
+// each server encrypts its own copy of the data.
+func (s *Server) handleKeyRotation(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	if err := s.node.RotateKeys(); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusAccepted, s.node.EncryptionStatus())
+}
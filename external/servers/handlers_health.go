@@ -0,0 +1,55 @@
+package servers
+
+import (
+	"net/http"
+)
+
+type healthResponse struct {
+	Status string `json:"status"`
+}
+
+// handleLive serves
+//
+//	GET /health/live - the process is up and serving HTTP
+func (s *Server) handleLive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	s.writeJSON(w, http.StatusOK, healthResponse{Status: "alive"})
+}
+
+// handleReady serves
+//
+//	GET /health/ready - the leader is known, the store is open
+//	                    and caught up with the committed log
+func (s *Server) handleReady(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	if err := s.node.Ready(); err != nil {
+		s.writeJSON(w, http.StatusServiceUnavailable, errorResponse{Error: err.Error()})
+		return
+	}
+	s.writeJSON(w, http.StatusOK, healthResponse{Status: "ready"})
+}
+
+// handleStatus serves
+//
+//	GET /v1/status - raft state, indexes, peers and snapshot info of the node
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	status, err := s.node.Status()
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, status)
+}
@@ -0,0 +1,240 @@
+package servers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alex60217101990/nietzsche/external/store"
+)
+
+type kvResponse struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+func parseConsistency(r *http.Request) (Consistency, error) {
+	switch c := r.URL.Query().Get("consistency"); c {
+	case "", "consistent":
+		return Consistent, nil
+	case "stale":
+		return Stale, nil
+	default:
+		return Consistent, fmt.Errorf("invalid consistency %q", c)
+	}
+}
+
+// handleKV serves
+//
+//	GET    /v1/kv/{key}[?consistency=stale] - read the key
+//	PUT    /v1/kv/{key}[?lease={id}]        - store the JSON body under the key
+//	DELETE /v1/kv/{key}                     - remove the key
+//
+// Writes and consistent reads are forwarded to the leader,
+// stale reads are answered by whichever server receives them.
+func (s *Server) handleKV(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+
+	switch r.Method {
+	case http.MethodGet:
+		consistency, err := parseConsistency(r)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+		if consistency == Consistent && s.forward(w, r) {
+			return
+		}
+
+		if !s.authorize(w, r, key, AccessRead) {
+			return
+		}
+
+		value, err := s.node.Get(r.Context(), key, consistency)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, kvResponse{
+			Key:   key,
+			Value: value,
+		})
+	case http.MethodPut:
+		if s.forward(w, r) {
+			return
+		}
+
+		var lease uint64
+		if l := r.URL.Query().Get("lease"); len(l) > 0 {
+			var err error
+			if lease, err = strconv.ParseUint(l, 10, 64); err != nil {
+				s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid lease %q", l)})
+				return
+			}
+		}
+
+		var value interface{}
+		if err := json.NewDecoder(r.Body).Decode(&value); err != nil {
+			s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+
+		if !s.authorize(w, r, key, AccessWrite) {
+			return
+		}
+		if err := s.node.AuthorizeLease(userFrom(r.Context()), lease); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		if err := s.node.Set(r.Context(), key, value, lease); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusNoContent, nil)
+	case http.MethodDelete:
+		if s.forward(w, r) {
+			return
+		}
+
+		if !s.authorize(w, r, key, AccessWrite) {
+			return
+		}
+		if err := s.node.Delete(r.Context(), key); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusNoContent, nil)
+	default:
+		s.methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// handleScan serves
+//
+//	GET /v1/kv?prefix={prefix}[&limit={n}][&consistency=stale] - list the keys in order
+//
+// Consistent scans are forwarded to the leader.
+func (s *Server) handleScan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	consistency, err := parseConsistency(r)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	var limit int
+	if l := r.URL.Query().Get("limit"); len(l) > 0 {
+		if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+			s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid limit %q", l)})
+			return
+		}
+	}
+
+	if consistency == Consistent && s.forward(w, r) {
+		return
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	if !s.authorize(w, r, prefix, AccessRead) {
+		return
+	}
+
+	entries, err := s.node.Scan(prefix, limit, consistency)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, entries)
+}
+
+// handleTxn serves
+//
+//	POST /v1/txn - run the JSON transaction atomically
+//
+// Transactions are forwarded to the leader.
+func (s *Server) handleTxn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if s.forward(w, r) {
+		return
+	}
+
+	var txn store.Txn
+	if err := json.NewDecoder(r.Body).Decode(&txn); err != nil {
+		s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := s.node.AuthorizeTxn(userFrom(r.Context()), &txn); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	resp, err := s.node.Txn(r.Context(), &txn)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, resp)
+}
+
+// handleWatch serves
+//
+//	GET /v1/watch[?prefix={prefix}] - stream the changes as JSON lines
+//
+// Watches are served by whichever server receives them, the stream
+// ends when the server falls behind or its store is restored.
+func (s *Server) handleWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		s.writeJSON(w, http.StatusInternalServerError, errorResponse{Error: "streaming is not supported"})
+		return
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	if !s.authorize(w, r, prefix, AccessRead) {
+		return
+	}
+
+	events, cancel, err := s.node.Watch(prefix)
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	enc := json.NewEncoder(w)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err = enc.Encode(event); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-s.closeCh:
+			return
+		}
+	}
+}
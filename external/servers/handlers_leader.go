@@ -0,0 +1,37 @@
+package servers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+type leaderTransferRequest struct {
+	ID string `json:"id"`
+}
+
+// handleLeaderTransfer serves
+//
+//	POST /v1/leader/transfer - hand the leadership over to the server
+//	from the optional body, or to the most up to date voter
+func (s *Server) handleLeaderTransfer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if s.forward(w, r) {
+		return
+	}
+
+	var req leaderTransferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := s.node.LeadershipTransfer(req.ID); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,93 @@
+package servers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type grantRequest struct {
+	TTL int64 `json:"ttl"`
+}
+
+// handleLeases serves
+//
+//	POST /v1/lease - grant a lease with the ttl in seconds from the JSON body
+//
+// Lease requests are forwarded to the leader.
+func (s *Server) handleLeases(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if s.forward(w, r) {
+		return
+	}
+
+	var req grantRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	lease, err := s.node.Grant(r.Context(), req.TTL, userName(userFrom(r.Context())))
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusOK, lease)
+}
+
+// handleLease serves
+//
+//	DELETE /v1/lease/{id}           - revoke the lease and delete its keys
+//	POST   /v1/lease/{id}/keepalive - restart the ttl of the lease
+func (s *Server) handleLease(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/lease/"), "/")
+
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid lease %q", parts[0])})
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if s.forward(w, r) {
+			return
+		}
+
+		if err = s.node.AuthorizeLease(userFrom(r.Context()), id); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		if err = s.node.Revoke(r.Context(), id); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusNoContent, nil)
+	case len(parts) == 2 && parts[1] == "keepalive" && r.Method == http.MethodPost:
+		if s.forward(w, r) {
+			return
+		}
+
+		if err = s.node.AuthorizeLease(userFrom(r.Context()), id); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		lease, err := s.node.KeepAlive(id)
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, lease)
+	case len(parts) == 1:
+		s.methodNotAllowed(w, http.MethodDelete)
+	case len(parts) == 2 && parts[1] == "keepalive":
+		s.methodNotAllowed(w, http.MethodPost)
+	default:
+		http.NotFound(w, r)
+	}
+}
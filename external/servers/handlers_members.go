@@ -0,0 +1,136 @@
+package servers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alex60217101990/nietzsche/external/configs"
+)
+
+type addMemberRequest struct {
+	ID         string `json:"id"`
+	Address    string `json:"address"`
+	APIAddress string `json:"api_address"`
+	Suffrage   string `json:"suffrage"`
+}
+
+// handleMembers serves
+//
+//	GET  /v1/members - list the raft configuration
+//	POST /v1/members - add a voter or a non-voter
+func (s *Server) handleMembers(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		membership, err := s.node.Members()
+		if err != nil {
+			s.writeError(w, err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, membership)
+	case http.MethodPost:
+		s.addMember(w, r)
+	default:
+		s.methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleJoin serves
+//
+//	POST /v1/join - add a voter or a non-voter, like POST /v1/members
+//
+// The joining servers authenticate with the join token, which
+// grants nothing else, instead of the root user.
+func (s *Server) handleJoin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		s.methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if err := s.node.AuthorizeJoin(r.Header.Get(joinTokenHeader)); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	s.addMember(w, r)
+}
+
+// addMember adds the server of the request body on the leader.
+func (s *Server) addMember(w http.ResponseWriter, r *http.Request) {
+	if s.forward(w, r) {
+		return
+	}
+
+	var req addMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	var suffrage configs.Suffrage
+	if len(req.Suffrage) > 0 {
+		if err := suffrage.Set(strings.ToLower(req.Suffrage)); err != nil {
+			s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+	}
+
+	if err := s.node.Join(req.ID, req.Address, req.APIAddress, suffrage); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusCreated, nil)
+}
+
+// handleMember serves
+//
+//	DELETE /v1/members/{id}[?force=true]        - remove the server
+//	POST   /v1/members/{id}/demote[?force=true] - turn the voter into a non-voter
+func (s *Server) handleMember(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/members/"), "/")
+	parts := strings.Split(path, "/")
+
+	force, err := parseForce(r)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && len(parts[0]) > 0:
+		if r.Method != http.MethodDelete {
+			s.methodNotAllowed(w, http.MethodDelete)
+			return
+		}
+		if s.forward(w, r) {
+			return
+		}
+		err = s.node.RemoveServer(parts[0], force)
+	case len(parts) == 2 && parts[1] == "demote":
+		if r.Method != http.MethodPost {
+			s.methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		if s.forward(w, r) {
+			return
+		}
+		err = s.node.DemoteVoter(parts[0], force)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusNoContent, nil)
+}
+
+func parseForce(r *http.Request) (bool, error) {
+	force := r.URL.Query().Get("force")
+	if len(force) == 0 {
+		return false, nil
+	}
+	return strconv.ParseBool(force)
+}
@@ -0,0 +1,76 @@
+package servers
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+)
+
+// handleSnapshot serves
+//
+//	GET /v1/snapshot[?consistency=stale] - download a backup of the store
+//	PUT /v1/snapshot                     - restore the cluster from the backup in the body
+//
+// Restores and consistent backups are forwarded to the leader.
+func (s *Server) handleSnapshot(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		consistency, err := parseConsistency(r)
+		if err != nil {
+			s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+		if consistency == Consistent && s.forward(w, r) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		if err = s.node.Backup(w); err != nil {
+			// the status line is already sent,
+			// the client gets a truncated body
+			s.node.log.Errorf(err.Error(),
+				map[string]interface{}{
+					"http-server": "snapshot-backup",
+				})
+		}
+	case http.MethodPut:
+		if s.forward(w, r) {
+			return
+		}
+
+		s.restoreSnapshot(w, r)
+	default:
+		s.methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
+
+// restoreSnapshot spools the body to a temporary file,
+// raft has to know the size of the snapshot up front.
+func (s *Server) restoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	tmp, err := ioutil.TempFile("", "nietzsche-restore-")
+	if err != nil {
+		s.writeError(w, err)
+		return
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	size, err := io.Copy(tmp, r.Body)
+	if err != nil {
+		s.writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+		s.writeError(w, err)
+		return
+	}
+
+	if err = s.node.RestoreSnapshot(tmp, size); err != nil {
+		s.writeError(w, err)
+		return
+	}
+	s.writeJSON(w, http.StatusNoContent, nil)
+}
@@ -0,0 +1,336 @@
+package servers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/configs"
+	"github.com/alex60217101990/nietzsche/external/consts"
+	"github.com/alex60217101990/nietzsche/external/store"
+
+	"github.com/hashicorp/raft"
+)
+
+func advertiseAddr(advertise, host string, port uint16) string {
+	if len(advertise) > 0 {
+		return advertise
+	}
+
+	if ip := net.ParseIP(host); len(host) == 0 || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+	}
+	return fmt.Sprintf("%s:%d", host, port)
+}
+
+// apiAdvertiseAddr returns the address other servers use
+// to reach the HTTP API of this node.
+func (n *RaftNode) apiAdvertiseAddr() string {
+	s := n.config().Server
+	return advertiseAddr(s.Advertise, s.Host, s.Port)
+}
+
+// grpcAdvertiseAddr returns the address other servers use to reach
+// the gRPC API of this node, empty when the gRPC API is disabled.
+func (n *RaftNode) grpcAdvertiseAddr() string {
+	s := n.config().GRPC
+	if s == nil {
+		return ""
+	}
+	return advertiseAddr(s.Advertise, s.Host, s.Port)
+}
+
+// redisAdvertiseAddr returns the address other servers use to reach
+// the RESP listener of this node, empty when it's disabled.
+func (n *RaftNode) redisAdvertiseAddr() string {
+	s := n.config().Redis
+	if s == nil {
+		return ""
+	}
+	return advertiseAddr(s.Advertise, s.Host, s.Port)
+}
+
+// memcachedAdvertiseAddr returns the address other servers use to reach
+// the memcached listener of this node, empty when it's disabled.
+func (n *RaftNode) memcachedAdvertiseAddr() string {
+	s := n.config().Memcached
+	if s == nil {
+		return ""
+	}
+	return advertiseAddr(s.Advertise, s.Host, s.Port)
+}
+
+// Join adds the server to the cluster with the given suffrage and
+// remembers the address of its HTTP API, so requests can be forwarded to it.
+// With the autopilot enabled voters join as non-voters and are promoted
+// once they are stable.
+func (n *RaftNode) Join(id, address, apiAddress string, suffrage configs.Suffrage) (err error) {
+	switch {
+	case suffrage == configs.Nonvoter:
+		err = n.AddNonvoter(id, address)
+	case n.autopilot != nil:
+		if err = n.AddNonvoter(id, address); err == nil {
+			err = n.markForPromotion(id)
+		}
+	default:
+		err = n.AddVoter(id, address)
+	}
+	if err != nil || len(apiAddress) == 0 {
+		return err
+	}
+
+	return n.registerAddr(consts.ServersKeyPreffix, id, apiAddress)
+}
+
+// registerAddr remembers the address of an API of the server under the preffix.
+func (n *RaftNode) registerAddr(preffix, id, address string) error {
+	key := preffix + id
+	if current, err := n.fsm.Get(key); err == nil && current == address {
+		return nil
+	}
+
+	_, err := n.Apply(store.CommandPayload{
+		Operation: "SET",
+		Key:       key,
+		Value:     address,
+	})
+	return err
+}
+
+// unregisterServer drops everything the cluster remembers about the server.
+func (n *RaftNode) unregisterServer(id string) error {
+	for _, preffix := range []string{
+		consts.ServersKeyPreffix,
+		consts.GRPCServersKeyPreffix,
+		consts.RedisServersKeyPreffix,
+		consts.MemcachedServersKeyPreffix,
+	} {
+		_, err := n.Apply(store.CommandPayload{
+			Operation: "DELETE",
+			Key:       preffix + id,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return n.clearPromotion(id)
+}
+
+// LeaderAPIAddr returns the HTTP API address of the current leader.
+func (n *RaftNode) LeaderAPIAddr() (string, error) {
+	return n.leaderAddr(consts.ServersKeyPreffix)
+}
+
+// LeaderGRPCAddr returns the gRPC API address of the current leader.
+func (n *RaftNode) LeaderGRPCAddr() (string, error) {
+	return n.leaderAddr(consts.GRPCServersKeyPreffix)
+}
+
+// LeaderRedisAddr returns the RESP address of the current leader.
+func (n *RaftNode) LeaderRedisAddr() (string, error) {
+	return n.leaderAddr(consts.RedisServersKeyPreffix)
+}
+
+// LeaderMemcachedAddr returns the memcached address of the current leader.
+func (n *RaftNode) LeaderMemcachedAddr() (string, error) {
+	return n.leaderAddr(consts.MemcachedServersKeyPreffix)
+}
+
+func (n *RaftNode) leaderAddr(preffix string) (string, error) {
+	cfg, _, err := n.configuration()
+	if err != nil {
+		return "", err
+	}
+
+	leader := n.raft.Leader()
+	if len(leader) == 0 {
+		return "", ErrNoLeader
+	}
+
+	for _, server := range cfg.Servers {
+		if server.Address != leader {
+			continue
+		}
+
+		data, err := n.fsm.Get(preffix + string(server.ID))
+		if err != nil {
+			return "", err
+		}
+		if address, ok := data.(string); ok {
+			return address, nil
+		}
+	}
+
+	return "", ErrNoLeader
+}
+
+func (n *RaftNode) isMember() bool {
+	cfg, _, err := n.configuration()
+	if err != nil {
+		return false
+	}
+
+	for _, server := range cfg.Servers {
+		if server.ID == raft.ServerID(n.config().Raft.NodeID) {
+			return true
+		}
+	}
+	return false
+}
+
+// join asks the configured members to add the node
+// to the cluster until one of them succeeds.
+func (n *RaftNode) join() {
+	ticker := time.NewTicker(consts.JoinRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		if n.isMember() {
+			return
+		}
+
+		for _, address := range n.config().Raft.Join {
+			err := n.requestJoin(address)
+			if err == nil {
+				return
+			}
+
+			n.log.Warnf(err.Error(),
+				map[string]interface{}{
+					"raft": "join",
+					"peer": address,
+				})
+		}
+
+		select {
+		case <-ticker.C:
+		case <-n.shutdownCh:
+			return
+		}
+	}
+}
+
+func (n *RaftNode) requestJoin(address string) error {
+	body, err := json.Marshal(addMemberRequest{
+		ID:         n.config().Raft.NodeID,
+		Address:    string(n.transport.LocalAddr()),
+		APIAddress: n.apiAdvertiseAddr(),
+		Suffrage:   n.config().Raft.Suffrage.String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+
+	// the root user adds the server, the join token lets it add itself
+	path := "/v1/members"
+	auth := n.config().Auth
+	if auth != nil && len(auth.JoinToken.Value()) > 0 {
+		path = "/v1/join"
+	}
+
+	req, err := http.NewRequest(http.MethodPost, address+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch {
+	case auth == nil:
+	case len(auth.JoinToken.Value()) > 0:
+		req.Header.Set(joinTokenHeader, auth.JoinToken.Value())
+	case req.URL.Scheme == "https":
+		req.SetBasicAuth(consts.RootUser, auth.RootPassword.Value())
+	default:
+		return ErrInsecureJoin
+	}
+
+	client := http.Client{
+		Timeout: n.config().Timeouts.Timeout(),
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusCreated {
+		return nil
+	}
+
+	var errResp errorResponse
+	if err = json.NewDecoder(resp.Body).Decode(&errResp); err != nil || len(errResp.Error) == 0 {
+		return fmt.Errorf("join request failed with status %d", resp.StatusCode)
+	}
+	return fmt.Errorf("join request failed: %s", errResp.Error)
+}
+
+// monitorLeadership keeps the API addresses of the leader registered
+// and runs the autopilot for as long as the node holds the leadership.
+func (n *RaftNode) monitorLeadership() {
+	// closed when the node loses the leadership,
+	// it stops the loops only the leader runs
+	var leaderStopCh chan struct{}
+	stopLeaderLoops := func() {
+		if leaderStopCh != nil {
+			close(leaderStopCh)
+			leaderStopCh = nil
+		}
+	}
+
+	for {
+		select {
+		case isLeader := <-n.raft.LeaderCh():
+			if !isLeader {
+				stopLeaderLoops()
+				continue
+			}
+
+			if leaderStopCh == nil {
+				leaderStopCh = make(chan struct{})
+				if n.autopilot != nil {
+					go n.autopilot.run(leaderStopCh)
+				}
+				go n.leases.run(leaderStopCh)
+			}
+
+			for _, api := range []struct {
+				preffix, address, name string
+			}{
+				{consts.ServersKeyPreffix, n.apiAdvertiseAddr(), "register-api-address"},
+				{consts.GRPCServersKeyPreffix, n.grpcAdvertiseAddr(), "register-grpc-address"},
+				{consts.RedisServersKeyPreffix, n.redisAdvertiseAddr(), "register-redis-address"},
+				{consts.MemcachedServersKeyPreffix, n.memcachedAdvertiseAddr(), "register-memcached-address"},
+			} {
+				if len(api.address) == 0 {
+					continue
+				}
+				if err := n.registerAddr(api.preffix, n.config().Raft.NodeID, api.address); err != nil {
+					n.log.Errorf(err.Error(),
+						map[string]interface{}{
+							"raft": api.name,
+						})
+				}
+			}
+
+			if n.authEnabled() {
+				if err := n.bootstrapAuth(); err != nil {
+					n.log.Errorf(err.Error(),
+						map[string]interface{}{
+							"raft": "auth-bootstrap",
+						})
+				}
+			}
+		case <-n.shutdownCh:
+			stopLeaderLoops()
+			return
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package servers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+	"github.com/alex60217101990/nietzsche/external/logger"
+	"github.com/alex60217101990/nietzsche/external/store"
+
+	"github.com/hashicorp/raft"
+)
+
+var (
+	ErrEmptyKey  = errors.New("key is required")
+	ErrSystemKey = errors.New("keys with the system preffix are reserved")
+	ErrNoLeader  = errors.New("cluster has no leader")
+)
+
+// Consistency selects which servers are allowed to answer a read.
+type Consistency uint8
+
+const (
+	// Consistent reads go through the raft log of the leader.
+	Consistent Consistency = iota
+	// Stale reads are served from the local copy of any server,
+	// including non-voting replicas.
+	Stale
+)
+
+func validateKey(key string) error {
+	if len(key) == 0 {
+		return ErrEmptyKey
+	}
+	if strings.HasPrefix(key, consts.SystemKeyPreffix) {
+		return ErrSystemKey
+	}
+	return nil
+}
+
+// stringValue returns the stored value as the text protocols send it,
+// values written through the JSON APIs are JSON encoded.
+func stringValue(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+
+	data, err := json.Marshal(value)
+	return string(data), err
+}
+
+// IsLeader reports whether the node is the leader of the cluster.
+func (n *RaftNode) IsLeader() bool {
+	return n.raft != nil && n.raft.State() == raft.Leader
+}
+
+// Apply replicates the command of the node itself, see ApplyContext.
+func (n *RaftNode) Apply(payload store.CommandPayload) (data interface{}, err error) {
+	return n.ApplyContext(context.Background(), payload)
+}
+
+// ApplyContext replicates the command through the raft log and returns the
+// result of applying it to the store. The request ID of the context is sent
+// with the command, so the servers log it when they apply the command.
+func (n *RaftNode) ApplyContext(ctx context.Context, payload store.CommandPayload) (data interface{}, err error) {
+	if n.raft == nil {
+		return nil, errNodeNotStarted
+	}
+
+	if id := logger.RequestID(ctx); len(id) > 0 {
+		payload.Metadata = map[string]string{store.MetadataRequestID: id}
+	}
+
+	cmd, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	future := n.raft.Apply(cmd, n.config().Timeouts.Timeout())
+	if err = future.Error(); err != nil {
+		n.log.WithContext(ctx).Warnf("command not applied", map[string]interface{}{
+			"raft":      "apply",
+			"operation": payload.Operation,
+			"error":     err.Error(),
+		})
+		return nil, err
+	}
+
+	result, ok := future.Response().(*store.ApplyResult)
+	if !ok {
+		return nil, nil
+	}
+
+	return result.Data, result.Error
+}
+
+// maxRequestIDLength bounds the request IDs sent by the clients, the longer
+// ones are replaced, so they can't blow up the log entries and commands.
+const maxRequestIDLength = 128
+
+// requestContext returns the context of the client request, the entries
+// logged while serving it carry the request ID and the node ID. A new
+// ID is generated when the client hasn't sent one.
+func (n *RaftNode) requestContext(ctx context.Context, id string) context.Context {
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		id = logger.NewRequestID()
+	}
+	ctx = logger.ContextWithNodeID(ctx, n.config().Raft.NodeID)
+	return logger.ContextWithRequestID(ctx, id)
+}
+
+// Get reads the key. Consistent reads must be served by the leader,
+// stale reads are answered from the local store.
+func (n *RaftNode) Get(ctx context.Context, key string, consistency Consistency) (data interface{}, err error) {
+	if err = validateKey(key); err != nil {
+		return nil, err
+	}
+
+	if consistency == Stale {
+		return n.fsm.Get(key)
+	}
+
+	return n.ApplyContext(ctx, store.CommandPayload{
+		Operation: "GET",
+		Key:       key,
+	})
+}
+
+// Set stores the value under the key, a non-zero
+// lease deletes the key when the lease expires.
+func (n *RaftNode) Set(ctx context.Context, key string, value interface{}, lease uint64) (err error) {
+	if err = validateKey(key); err != nil {
+		return err
+	}
+
+	_, err = n.ApplyContext(ctx, store.CommandPayload{
+		Operation: "SET",
+		Key:       key,
+		Value:     value,
+		Lease:     lease,
+	})
+	return err
+}
+
+// Delete removes the key.
+func (n *RaftNode) Delete(ctx context.Context, key string) (err error) {
+	if err = validateKey(key); err != nil {
+		return err
+	}
+
+	_, err = n.ApplyContext(ctx, store.CommandPayload{
+		Operation: "DELETE",
+		Key:       key,
+	})
+	return err
+}
+
+// Scan lists the keys starting with the prefix, a limit of zero returns all
+// of them. Consistent scans wait until the leader has applied every
+// committed entry, stale scans read the local store.
+func (n *RaftNode) Scan(prefix string, limit int, consistency Consistency) (entries []store.KeyValue, err error) {
+	if strings.HasPrefix(prefix, consts.SystemKeyPreffix) {
+		return nil, ErrSystemKey
+	}
+
+	if consistency == Consistent {
+		if n.raft == nil {
+			return nil, errNodeNotStarted
+		}
+		if !n.IsLeader() {
+			return nil, raft.ErrNotLeader
+		}
+		if err = n.raft.Barrier(n.config().Timeouts.Timeout()).Error(); err != nil {
+			return nil, err
+		}
+	}
+
+	return n.fsm.Scan(prefix, limit, func(key string) bool {
+		return strings.HasPrefix(key, consts.SystemKeyPreffix)
+	})
+}
+
+// Txn runs the transaction atomically through the raft log.
+func (n *RaftNode) Txn(ctx context.Context, txn *store.Txn) (*store.TxnResponse, error) {
+	if txn == nil {
+		return nil, store.ErrInvalidOperation
+	}
+	for _, cmp := range txn.Compare {
+		if err := validateKey(cmp.Key); err != nil {
+			return nil, err
+		}
+	}
+	for _, ops := range [][]store.TxnOp{txn.Success, txn.Failure} {
+		for _, op := range ops {
+			if err := validateKey(op.Key); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	data, err := n.ApplyContext(ctx, store.CommandPayload{
+		Operation: "TXN",
+		Txn:       txn,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, _ := data.(*store.TxnResponse)
+	return resp, nil
+}
+
+// Watch sends the changes of the keys starting with the prefix as they are
+// applied to the local store, until cancel is called. The channel is closed
+// when the watcher falls behind or the store is restored from a snapshot.
+func (n *RaftNode) Watch(prefix string) (events <-chan store.Event, cancel func(), err error) {
+	if strings.HasPrefix(prefix, consts.SystemKeyPreffix) {
+		return nil, nil, ErrSystemKey
+	}
+	if n.raft == nil {
+		return nil, nil, errNodeNotStarted
+	}
+
+	events, cancel = n.fsm.Watch(prefix, func(key string) bool {
+		return strings.HasPrefix(key, consts.SystemKeyPreffix)
+	})
+	return events, cancel, nil
+}
@@ -0,0 +1,66 @@
+package servers
+
+import (
+	"errors"
+
+	"github.com/hashicorp/raft"
+)
+
+var (
+	ErrNotVoter = errors.New("leadership can only be transferred to a voter")
+)
+
+// LeadershipTransfer makes the leader step down in favour of the server with
+// the given id, or of the most up to date voter when the id is empty.
+func (n *RaftNode) LeadershipTransfer(id string) error {
+	if len(id) == 0 {
+		if n.raft == nil {
+			return errNodeNotStarted
+		}
+		return n.raft.LeadershipTransfer().Error()
+	}
+
+	cfg, _, err := n.configuration()
+	if err != nil {
+		return err
+	}
+
+	for _, server := range cfg.Servers {
+		if server.ID != raft.ServerID(id) {
+			continue
+		}
+		if server.Suffrage != raft.Voter {
+			return ErrNotVoter
+		}
+		return n.raft.LeadershipTransferToServer(server.ID, server.Address).Error()
+	}
+
+	return ErrUnknownServer
+}
+
+// stepDown hands the leadership over before the node shuts down,
+// so the cluster does not wait for an election timeout.
+func (n *RaftNode) stepDown() {
+	if n.raft.State() != raft.Leader {
+		return
+	}
+
+	cfg, _, err := n.configuration()
+	if err != nil {
+		n.log.Error(err)
+		return
+	}
+
+	localID := raft.ServerID(n.config().Raft.NodeID)
+	for _, server := range cfg.Servers {
+		if server.ID != localID && server.Suffrage == raft.Voter {
+			if err = n.raft.LeadershipTransfer().Error(); err != nil {
+				n.log.Errorf(err.Error(),
+					map[string]interface{}{
+						"raft": "leadership-transfer",
+					})
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package servers
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+	"github.com/alex60217101990/nietzsche/external/store"
+
+	"github.com/hashicorp/raft"
+)
+
+var (
+	ErrInvalidTTL = errors.New("lease ttl must be positive")
+)
+
+// leaseKeeper revokes the expired leases on the leader. The deadlines are
+// kept in memory only, a new leader gives every lease its full ttl again.
+type leaseKeeper struct {
+	node *RaftNode
+
+	mu        sync.Mutex
+	deadlines map[uint64]time.Time
+}
+
+func newLeaseKeeper(node *RaftNode) *leaseKeeper {
+	return &leaseKeeper{
+		node:      node,
+		deadlines: make(map[uint64]time.Time),
+	}
+}
+
+// run checks the leases until the stop channel is closed,
+// it's started each time the node becomes the leader.
+func (k *leaseKeeper) run(stopCh <-chan struct{}) {
+	ticker := time.NewTicker(consts.LeaseCheckInterval)
+	defer ticker.Stop()
+
+	k.mu.Lock()
+	k.deadlines = make(map[uint64]time.Time)
+	k.mu.Unlock()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := k.check(); err != nil {
+				k.node.log.Errorf(err.Error(),
+					map[string]interface{}{
+						"raft": "lease-expiry",
+					})
+			}
+		case <-stopCh:
+			return
+		}
+	}
+}
+
+// check picks up the leases granted or restored since the last run
+// and revokes the ones whose deadline has passed.
+func (k *leaseKeeper) check() error {
+	leases, err := k.node.fsm.Leases()
+	if err != nil {
+		return err
+	}
+
+	var (
+		now     = time.Now()
+		expired []uint64
+		known   = make(map[uint64]struct{}, len(leases))
+	)
+
+	k.mu.Lock()
+	for _, lease := range leases {
+		known[lease.ID] = struct{}{}
+
+		deadline, ok := k.deadlines[lease.ID]
+		switch {
+		case !ok:
+			k.deadlines[lease.ID] = now.Add(time.Duration(lease.TTL) * time.Second)
+		case now.After(deadline):
+			expired = append(expired, lease.ID)
+		}
+	}
+	for id := range k.deadlines {
+		if _, ok := known[id]; !ok {
+			delete(k.deadlines, id)
+		}
+	}
+	k.mu.Unlock()
+
+	for _, id := range expired {
+		if err = k.node.revoke(context.Background(), id); err != nil && err != store.ErrLeaseNotFound {
+			return err
+		}
+
+		k.mu.Lock()
+		delete(k.deadlines, id)
+		k.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (k *leaseKeeper) keepAlive(lease store.Lease) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.deadlines[lease.ID] = time.Now().Add(time.Duration(lease.TTL) * time.Second)
+}
+
+// remaining returns how long the lease has left, a lease
+// the keeper has not picked up yet gets its full ttl.
+func (k *leaseKeeper) remaining(lease store.Lease) time.Duration {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	now := time.Now()
+	deadline, ok := k.deadlines[lease.ID]
+	if !ok {
+		deadline = now.Add(time.Duration(lease.TTL) * time.Second)
+		k.deadlines[lease.ID] = deadline
+	}
+	if now.After(deadline) {
+		return 0
+	}
+	return deadline.Sub(now)
+}
+
+// Grant creates a lease which expires unless it's kept alive within the ttl,
+// the owner is the user allowed to use it once auth is enabled.
+func (n *RaftNode) Grant(ctx context.Context, ttl int64, owner string) (*store.Lease, error) {
+	if ttl <= 0 {
+		return nil, ErrInvalidTTL
+	}
+
+	data, err := n.ApplyContext(ctx, store.CommandPayload{
+		Operation: "LEASE_GRANT",
+		TTL:       ttl,
+		Owner:     owner,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lease, _ := data.(*store.Lease)
+	if lease == nil {
+		return nil, store.ErrLeaseNotFound
+	}
+	n.leases.keepAlive(*lease)
+
+	return lease, nil
+}
+
+// Revoke removes the lease and deletes the keys attached to it.
+func (n *RaftNode) Revoke(ctx context.Context, id uint64) error {
+	return n.revoke(ctx, id)
+}
+
+func (n *RaftNode) revoke(ctx context.Context, id uint64) error {
+	_, err := n.ApplyContext(ctx, store.CommandPayload{
+		Operation: "LEASE_REVOKE",
+		Lease:     id,
+	})
+	return err
+}
+
+// KeepAlive restarts the ttl of the lease, it must run on the leader.
+func (n *RaftNode) KeepAlive(id uint64) (*store.Lease, error) {
+	if !n.IsLeader() {
+		return nil, raft.ErrNotLeader
+	}
+
+	lease, err := n.lease(id)
+	if err != nil {
+		return nil, err
+	}
+
+	n.leases.keepAlive(*lease)
+	return lease, nil
+}
+
+// lease returns the granted lease with the id.
+func (n *RaftNode) lease(id uint64) (*store.Lease, error) {
+	leases, err := n.fsm.Leases()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, lease := range leases {
+		if lease.ID == id {
+			return &lease, nil
+		}
+	}
+
+	return nil, store.ErrLeaseNotFound
+}
+
+// TimeToLive returns how long the key has left until its lease expires,
+// leased is false for keys without a lease. It must run on the leader.
+func (n *RaftNode) TimeToLive(key string) (ttl time.Duration, leased bool, err error) {
+	if err = validateKey(key); err != nil {
+		return 0, false, err
+	}
+	if !n.IsLeader() {
+		return 0, false, raft.ErrNotLeader
+	}
+
+	if _, err = n.fsm.Get(key); err != nil {
+		return 0, false, err
+	}
+
+	id, err := n.fsm.LeaseOf(key)
+	if err != nil || id == 0 {
+		return 0, false, err
+	}
+
+	lease, err := n.lease(id)
+	if err != nil {
+		return 0, false, err
+	}
+
+	return n.leases.remaining(*lease), true, nil
+}
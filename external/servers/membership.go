@@ -0,0 +1,225 @@
+package servers
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+	"github.com/alex60217101990/nietzsche/external/helpers"
+
+	"github.com/hashicorp/raft"
+)
+
+var (
+	ErrLastVoter     = errors.New("the change removes the last voter of the cluster, force is required")
+	ErrQuorumLoss    = errors.New("the change leaves the cluster without a healthy quorum, force is required")
+	ErrUnknownServer = errors.New("server is not a member of the cluster")
+	ErrEmptyServer   = errors.New("server id and address are required")
+)
+
+// ServerInfo describes a single member of the raft configuration.
+type ServerInfo struct {
+	ID          string     `json:"id"`
+	Address     string     `json:"address"`
+	Suffrage    string     `json:"suffrage"`
+	Leader      bool       `json:"leader"`
+	LastContact *time.Time `json:"last_contact,omitempty"`
+	MatchIndex  uint64     `json:"match_index"`
+}
+
+// Membership is the current raft configuration with the
+// replication state of every server.
+type Membership struct {
+	Index   uint64       `json:"index"`
+	Servers []ServerInfo `json:"servers"`
+}
+
+func suffrageName(s raft.ServerSuffrage) string {
+	return strings.ToLower(s.String())
+}
+
+func (n *RaftNode) configuration() (cfg raft.Configuration, index uint64, err error) {
+	if n.raft == nil {
+		return cfg, 0, errNodeNotStarted
+	}
+
+	future := n.raft.GetConfiguration()
+	if err = future.Error(); err != nil {
+		return cfg, 0, err
+	}
+
+	return future.Configuration(), future.Index(), nil
+}
+
+// Members lists the servers of the current raft configuration. Last contact
+// and match index of remote servers are only known on the leader.
+func (n *RaftNode) Members() (membership *Membership, err error) {
+	cfg, index, err := n.configuration()
+	if err != nil {
+		return nil, err
+	}
+
+	leader := n.raft.Leader()
+	isLeader := n.raft.State() == raft.Leader
+	localID := raft.ServerID(n.config().Raft.NodeID)
+
+	membership = &Membership{
+		Index:   index,
+		Servers: make([]ServerInfo, 0, len(cfg.Servers)),
+	}
+	for _, server := range cfg.Servers {
+		info := ServerInfo{
+			ID:       string(server.ID),
+			Address:  string(server.Address),
+			Suffrage: suffrageName(server.Suffrage),
+			Leader:   server.Address == leader,
+		}
+
+		switch {
+		case server.ID == localID:
+			info.MatchIndex = n.raft.LastIndex()
+			if isLeader {
+				info.LastContact = helpers.TimeToTimePtr(time.Now())
+			} else if lastContact := n.raft.LastContact(); !lastContact.IsZero() {
+				info.LastContact = helpers.TimeToTimePtr(lastContact)
+			}
+		case isLeader:
+			if progress, ok := n.transport.Get(server.ID); ok {
+				info.LastContact = helpers.TimeToTimePtr(progress.LastContact)
+				info.MatchIndex = progress.MatchIndex
+			}
+		}
+
+		membership.Servers = append(membership.Servers, info)
+	}
+
+	return membership, nil
+}
+
+// AddVoter adds the server to the cluster as a voter.
+func (n *RaftNode) AddVoter(id, address string) error {
+	if len(id) == 0 || len(address) == 0 {
+		return ErrEmptyServer
+	}
+
+	_, index, err := n.configuration()
+	if err != nil {
+		return err
+	}
+
+	return n.raft.AddVoter(raft.ServerID(id), raft.ServerAddress(address), index,
+		n.config().Timeouts.Timeout()).Error()
+}
+
+// AddNonvoter adds the server to the cluster as a non-voter,
+// it receives the replicated log without taking part in elections.
+func (n *RaftNode) AddNonvoter(id, address string) error {
+	if len(id) == 0 || len(address) == 0 {
+		return ErrEmptyServer
+	}
+
+	_, index, err := n.configuration()
+	if err != nil {
+		return err
+	}
+
+	return n.raft.AddNonvoter(raft.ServerID(id), raft.ServerAddress(address), index,
+		n.config().Timeouts.Timeout()).Error()
+}
+
+// DemoteVoter turns the voter into a non-voter. Without force the change is
+// refused when it would remove the last voter or the healthy quorum.
+func (n *RaftNode) DemoteVoter(id string, force bool) error {
+	cfg, index, err := n.configuration()
+	if err != nil {
+		return err
+	}
+
+	if err = n.checkRemoval(cfg, raft.ServerID(id), force); err != nil {
+		return err
+	}
+
+	return n.raft.DemoteVoter(raft.ServerID(id), index,
+		n.config().Timeouts.Timeout()).Error()
+}
+
+// RemoveServer removes the server from the cluster. Without force the change
+// is refused when it would remove the last voter or the healthy quorum.
+func (n *RaftNode) RemoveServer(id string, force bool) error {
+	cfg, index, err := n.configuration()
+	if err != nil {
+		return err
+	}
+
+	if err = n.checkRemoval(cfg, raft.ServerID(id), force); err != nil {
+		return err
+	}
+
+	err = n.raft.RemoveServer(raft.ServerID(id), index,
+		n.config().Timeouts.Timeout()).Error()
+	if err != nil {
+		return err
+	}
+
+	n.transport.Forget(raft.ServerID(id))
+	if err = n.unregisterServer(id); err != nil {
+		n.log.Errorf(err.Error(),
+			map[string]interface{}{
+				"raft": "unregister-server",
+			})
+	}
+
+	return nil
+}
+
+// checkRemoval verifies that the voters left after the server
+// stops voting are still able to form a healthy quorum.
+func (n *RaftNode) checkRemoval(cfg raft.Configuration, id raft.ServerID, force bool) error {
+	if n.raft.State() != raft.Leader {
+		return raft.ErrNotLeader
+	}
+
+	var (
+		found     bool
+		isVoter   bool
+		remaining []raft.ServerID
+	)
+	for _, server := range cfg.Servers {
+		if server.ID == id {
+			found = true
+			isVoter = server.Suffrage == raft.Voter
+			continue
+		}
+		if server.Suffrage == raft.Voter {
+			remaining = append(remaining, server.ID)
+		}
+	}
+
+	switch {
+	case !found:
+		return ErrUnknownServer
+	case !isVoter || force:
+		return nil
+	case len(remaining) == 0:
+		return ErrLastVoter
+	}
+
+	localID := raft.ServerID(n.config().Raft.NodeID)
+	healthy := 0
+	for _, voter := range remaining {
+		if voter == localID {
+			healthy++
+			continue
+		}
+		if progress, ok := n.transport.Get(voter); ok && time.Since(progress.LastContact) < consts.ServerHealthyContact {
+			healthy++
+		}
+	}
+
+	if healthy < len(remaining)/2+1 {
+		return ErrQuorumLoss
+	}
+
+	return nil
+}
@@ -0,0 +1,636 @@
+package servers
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/configs"
+	"github.com/alex60217101990/nietzsche/external/consts"
+	"github.com/alex60217101990/nietzsche/external/store"
+
+	"github.com/hashicorp/raft"
+)
+
+// ErrMemcachedAuth is returned by Start while auth is enabled,
+// the text protocol has no way to authenticate the clients.
+var ErrMemcachedAuth = errors.New("the memcached server can't be enabled together with auth")
+
+const (
+	// memcachedVersion is reported by the version command.
+	memcachedVersion = "1.6.0"
+
+	// memcachedForwardedCommand marks connections a follower opens to proxy
+	// commands to the leader, so they are not proxied again while the
+	// leadership is changing.
+	memcachedForwardedCommand = "nietzsche_forwarded"
+
+	// exptime values above that are unix times, not relative ones
+	memcachedMaxRelativeExptime = 30 * 24 * 60 * 60
+)
+
+const (
+	mcStored    = "STORED\r\n"
+	mcNotStored = "NOT_STORED\r\n"
+	mcExists    = "EXISTS\r\n"
+	mcNotFound  = "NOT_FOUND\r\n"
+	mcDeleted   = "DELETED\r\n"
+	mcTouched   = "TOUCHED\r\n"
+	mcEnd       = "END\r\n"
+	mcOK        = "OK\r\n"
+	mcError     = "ERROR\r\n"
+
+	mcBadFormat  = "CLIENT_ERROR bad command line format\r\n"
+	mcBadChunk   = "CLIENT_ERROR bad data chunk\r\n"
+	mcNonNumeric = "CLIENT_ERROR cannot increment or decrement non-numeric value\r\n"
+	mcTooLarge   = "SERVER_ERROR object too large for cache\r\n"
+	mcContention = "SERVER_ERROR the key keeps changing concurrently\r\n"
+)
+
+// MemcachedServer serves the replicated store over the memcached text
+// protocol. The cas unique of an item is the revision of its key, flags are
+// kept with the value and the expiration time by a lease. Followers proxy
+// the commands to the leader.
+type MemcachedServer struct {
+	*tcpServer
+
+	node *RaftNode
+}
+
+func NewMemcachedServer(node *RaftNode) *MemcachedServer {
+	return &MemcachedServer{
+		tcpServer: newTCPServer("memcached", fmt.Sprintf("%s:%d", node.config().Memcached.Host, node.config().Memcached.Port), node.log),
+		node:      node,
+	}
+}
+
+func (s *MemcachedServer) Start() error {
+	if s.node.authEnabled() {
+		return ErrMemcachedAuth
+	}
+	return s.start(func(conn net.Conn) {
+		newMemcachedConn(s, conn).serve()
+	})
+}
+
+func (s *MemcachedServer) Close() error {
+	return s.close()
+}
+
+// memcachedCommand is a parsed request, data is
+// the block sent after the storage commands.
+type memcachedCommand struct {
+	name    string
+	args    []string
+	data    []byte
+	noreply bool
+}
+
+// memcachedConn is a single client connection,
+// its commands are served one after another.
+type memcachedConn struct {
+	server *MemcachedServer
+	conn   net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+
+	quit      bool
+	forwarded bool
+
+	// connection to the leader the commands are proxied to
+	leader *memcachedProxy
+
+	// ctx carries the request ID of the command being served
+	ctx context.Context
+}
+
+func newMemcachedConn(s *MemcachedServer, conn net.Conn) *memcachedConn {
+	return &memcachedConn{
+		server: s,
+		conn:   conn,
+		r:      bufio.NewReaderSize(conn, respReadBufferSize),
+		w:      bufio.NewWriter(conn),
+	}
+}
+
+func (c *memcachedConn) serve() {
+	defer c.closeProxy()
+
+	for {
+		cmd, reply, err := c.readCommand()
+		if err != nil {
+			if _, ok := err.(respProtocolError); ok {
+				c.w.WriteString("CLIENT_ERROR line too long\r\n")
+				c.w.Flush()
+			}
+			return
+		}
+
+		if cmd != nil {
+			reply = c.dispatch(cmd)
+			if cmd.noreply {
+				reply = ""
+			}
+		}
+		if _, err = c.w.WriteString(reply); err != nil {
+			return
+		}
+
+		// pipelined commands are answered together
+		if c.quit || c.r.Buffered() == 0 {
+			if err = c.w.Flush(); err != nil || c.quit {
+				return
+			}
+		}
+	}
+}
+
+// readCommand reads the next request. Malformed requests are
+// answered with the reply instead of being returned.
+func (c *memcachedConn) readCommand() (cmd *memcachedCommand, reply string, err error) {
+	line, err := readLine(c.r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, mcError, nil
+	}
+
+	cmd = &memcachedCommand{
+		name: fields[0],
+		args: fields[1:],
+	}
+	if n := len(cmd.args); n > 0 && cmd.args[n-1] == "noreply" {
+		cmd.args, cmd.noreply = cmd.args[:n-1], true
+	}
+
+	switch cmd.name {
+	case "set", "add", "replace", "cas":
+		if len(cmd.args) != 4 && !(cmd.name == "cas" && len(cmd.args) == 5) {
+			return nil, mcError, nil
+		}
+
+		size, err := strconv.Atoi(cmd.args[3])
+		if err != nil || size < 0 {
+			return nil, mcBadFormat, nil
+		}
+		if size > consts.MemcachedMaxItemSize {
+			// the data block is still sent, skip it
+			_, err = io.CopyN(ioutil.Discard, c.r, int64(size)+2)
+			return nil, mcTooLarge, err
+		}
+
+		cmd.data = make([]byte, size+2)
+		if _, err = io.ReadFull(c.r, cmd.data); err != nil {
+			return nil, "", err
+		}
+		if cmd.data[size] != '\r' || cmd.data[size+1] != '\n' {
+			return nil, mcBadChunk, nil
+		}
+		cmd.data = cmd.data[:size]
+	}
+
+	return cmd, "", nil
+}
+
+func (c *memcachedConn) dispatch(cmd *memcachedCommand) string {
+	c.ctx = c.server.node.requestContext(context.Background(), "")
+
+	switch cmd.name {
+	case "version":
+		return "VERSION " + memcachedVersion + "\r\n"
+	case "verbosity":
+		return mcOK
+	case "quit":
+		c.quit, cmd.noreply = true, true
+		return ""
+	case memcachedForwardedCommand:
+		c.forwarded = true
+		return mcOK
+	case "get", "gets", "set", "add", "replace", "cas", "delete", "incr", "decr", "touch":
+	default:
+		return mcError
+	}
+
+	for _, key := range cmd.keys() {
+		if len(key) > consts.MemcachedMaxKeySize {
+			return mcBadFormat
+		}
+	}
+
+	if !c.server.node.IsLeader() {
+		if c.forwarded {
+			return c.errorReply(raft.ErrNotLeader)
+		}
+		return c.proxy(cmd)
+	}
+
+	switch cmd.name {
+	case "get", "gets":
+		return c.get(cmd)
+	case "set", "add", "replace", "cas":
+		return c.store(cmd)
+	case "delete":
+		return c.delete(cmd)
+	case "incr", "decr":
+		return c.incr(cmd)
+	default:
+		return c.touch(cmd)
+	}
+}
+
+// keys returns the keys the command works on.
+func (cmd *memcachedCommand) keys() []string {
+	if cmd.name == "get" || cmd.name == "gets" || len(cmd.args) == 0 {
+		return cmd.args
+	}
+	return cmd.args[:1]
+}
+
+// errorReply maps the errors of the node to memcached errors.
+func (c *memcachedConn) errorReply(err error) string {
+	switch err {
+	case ErrEmptyKey, ErrSystemKey:
+		return "CLIENT_ERROR " + err.Error() + "\r\n"
+	default:
+		return "SERVER_ERROR " + err.Error() + "\r\n"
+	}
+}
+
+// memcachedTTL converts the expiration time of an item, it's relative up
+// to 30 days and a unix time above. Expired reports times already passed.
+func memcachedTTL(exptime int64) (ttl time.Duration, expired bool) {
+	switch {
+	case exptime == 0:
+		return 0, false
+	case exptime < 0:
+		return 0, true
+	case exptime > memcachedMaxRelativeExptime:
+		ttl = time.Until(time.Unix(exptime, 0))
+		return ttl, ttl <= 0
+	default:
+		return time.Duration(exptime) * time.Second, false
+	}
+}
+
+// grant creates the lease keeping the expiration time of the
+// item, zero is returned for items which don't expire.
+func (c *memcachedConn) grant(ttl time.Duration) (uint64, error) {
+	if ttl <= 0 {
+		return 0, nil
+	}
+
+	lease, err := c.server.node.Grant(c.ctx, leaseTTL(ttl), "")
+	if err != nil {
+		return 0, err
+	}
+	return lease.ID, nil
+}
+
+func (c *memcachedConn) get(cmd *memcachedCommand) string {
+	if len(cmd.args) == 0 {
+		return mcError
+	}
+
+	ops := make([]store.TxnOp, 0, len(cmd.args))
+	for _, key := range cmd.args {
+		ops = append(ops, store.TxnOp{Operation: "GET", Key: key})
+	}
+
+	// a single transaction reads all the items at the same revision
+	resp, err := c.server.node.Txn(c.ctx, &store.Txn{Success: ops})
+	if err != nil {
+		return c.errorReply(err)
+	}
+
+	var b strings.Builder
+	for _, result := range resp.Results {
+		if !result.Found {
+			continue
+		}
+
+		data, err := stringValue(result.Value)
+		if err != nil {
+			return c.errorReply(err)
+		}
+
+		fmt.Fprintf(&b, "VALUE %s %d %d", result.Key, result.Flags, len(data))
+		if cmd.name == "gets" {
+			fmt.Fprintf(&b, " %d", result.Revision)
+		}
+		fmt.Fprintf(&b, "\r\n%s\r\n", data)
+	}
+	b.WriteString(mcEnd)
+
+	return b.String()
+}
+
+// store runs set, add, replace and cas, items with an
+// expiration time already passed are deleted instead.
+func (c *memcachedConn) store(cmd *memcachedCommand) string {
+	var (
+		key            = cmd.args[0]
+		flags, errFlag = strconv.ParseUint(cmd.args[1], 10, 32)
+		exptime, err   = strconv.ParseInt(cmd.args[2], 10, 64)
+		unique         uint64
+	)
+	if errFlag != nil || err != nil {
+		return mcBadFormat
+	}
+	if cmd.name == "cas" {
+		if unique, err = strconv.ParseUint(cmd.args[4], 10, 64); err != nil {
+			return mcBadFormat
+		}
+	}
+
+	ttl, expired := memcachedTTL(exptime)
+	op := store.TxnOp{
+		Operation: "SET",
+		Key:       key,
+		Value:     string(cmd.data),
+		Flags:     uint32(flags),
+	}
+	if expired {
+		op = store.TxnOp{Operation: "DELETE", Key: key}
+	} else if op.Lease, err = c.grant(ttl); err != nil {
+		return c.errorReply(err)
+	}
+
+	txn := &store.Txn{Success: []store.TxnOp{op}}
+	switch cmd.name {
+	case "add":
+		txn.Compare = []store.Compare{{Key: key, Result: store.CompareMissing}}
+	case "replace":
+		txn.Compare = []store.Compare{{Key: key, Result: store.CompareExists}}
+	case "cas":
+		txn.Compare = []store.Compare{{Key: key, Result: store.CompareRevision, Revision: unique}}
+		txn.Failure = []store.TxnOp{{Operation: "GET", Key: key}}
+	}
+
+	node := c.server.node
+	resp, err := node.Txn(c.ctx, txn)
+	if err != nil || !resp.Succeeded {
+		if op.Lease != 0 {
+			// nothing is attached to the lease, it would expire anyway
+			node.Revoke(c.ctx, op.Lease)
+		}
+	}
+
+	switch {
+	case err != nil:
+		return c.errorReply(err)
+	case resp.Succeeded:
+		return mcStored
+	case cmd.name != "cas":
+		return mcNotStored
+	case resp.Results[0].Found:
+		return mcExists
+	default:
+		return mcNotFound
+	}
+}
+
+func (c *memcachedConn) delete(cmd *memcachedCommand) string {
+	// "delete <key> 0" is still sent by old clients
+	if len(cmd.args) == 0 || len(cmd.args) > 2 || (len(cmd.args) == 2 && cmd.args[1] != "0") {
+		return mcBadFormat
+	}
+
+	resp, err := c.server.node.Txn(c.ctx, &store.Txn{
+		Success: []store.TxnOp{{Operation: "DELETE", Key: cmd.args[0]}},
+	})
+	if err != nil {
+		return c.errorReply(err)
+	}
+	if !resp.Results[0].Found {
+		return mcNotFound
+	}
+	return mcDeleted
+}
+
+// incr changes the number stored in the item, incr wraps around at 64 bits
+// and decr stops at zero. The item keeps its flags and expiration time.
+func (c *memcachedConn) incr(cmd *memcachedCommand) string {
+	if len(cmd.args) != 2 {
+		return mcError
+	}
+
+	key := cmd.args[0]
+	delta, err := strconv.ParseUint(cmd.args[1], 10, 64)
+	if err != nil {
+		return "CLIENT_ERROR invalid numeric delta argument\r\n"
+	}
+
+	node := c.server.node
+	get := store.TxnOp{Operation: "GET", Key: key}
+	resp, err := node.Txn(c.ctx, &store.Txn{Success: []store.TxnOp{get}})
+	if err != nil {
+		return c.errorReply(err)
+	}
+	current := resp.Results[0]
+
+	for i := 0; i < consts.CASMaxRetries; i++ {
+		if !current.Found {
+			return mcNotFound
+		}
+
+		data, err := stringValue(current.Value)
+		if err != nil {
+			return c.errorReply(err)
+		}
+		n, err := strconv.ParseUint(data, 10, 64)
+		if err != nil {
+			return mcNonNumeric
+		}
+
+		switch {
+		case cmd.name == "incr":
+			n += delta
+		case delta > n:
+			n = 0
+		default:
+			n -= delta
+		}
+
+		resp, err = node.Txn(c.ctx, &store.Txn{
+			Compare: []store.Compare{{Key: key, Result: store.CompareRevision, Revision: current.Revision}},
+			Success: []store.TxnOp{{
+				Operation: "SET",
+				Key:       key,
+				Value:     strconv.FormatUint(n, 10),
+				KeepLease: true,
+				Flags:     current.Flags,
+			}},
+			Failure: []store.TxnOp{get},
+		})
+		if err != nil {
+			return c.errorReply(err)
+		}
+		if resp.Succeeded {
+			return strconv.FormatUint(n, 10) + "\r\n"
+		}
+		current = resp.Results[0]
+	}
+
+	return mcContention
+}
+
+// touch replaces the expiration time of the item, the value
+// and the cas unique are left as they are.
+func (c *memcachedConn) touch(cmd *memcachedCommand) string {
+	if len(cmd.args) != 2 {
+		return mcError
+	}
+
+	exptime, err := strconv.ParseInt(cmd.args[1], 10, 64)
+	if err != nil {
+		return mcBadFormat
+	}
+
+	op := store.TxnOp{Operation: "ATTACH", Key: cmd.args[0]}
+	ttl, expired := memcachedTTL(exptime)
+	if expired {
+		op.Operation = "DELETE"
+	} else if op.Lease, err = c.grant(ttl); err != nil {
+		return c.errorReply(err)
+	}
+
+	node := c.server.node
+	resp, err := node.Txn(c.ctx, &store.Txn{Success: []store.TxnOp{op}})
+	if err != nil || !resp.Results[0].Found {
+		if op.Lease != 0 {
+			node.Revoke(c.ctx, op.Lease)
+		}
+		if err != nil {
+			return c.errorReply(err)
+		}
+		return mcNotFound
+	}
+	return mcTouched
+}
+
+// proxy runs the command on the leader and relays its reply.
+func (c *memcachedConn) proxy(cmd *memcachedCommand) string {
+	address, err := c.server.node.LeaderMemcachedAddr()
+	if err != nil {
+		return c.errorReply(ErrNoLeader)
+	}
+
+	if c.leader != nil && c.leader.address != address {
+		c.closeProxy()
+	}
+	if c.leader == nil {
+		if c.leader, err = dialMemcachedProxy(c.server.node.conf, address); err != nil {
+			return c.errorReply(err)
+		}
+	}
+
+	reply, err := c.leader.do(cmd)
+	if err != nil {
+		c.closeProxy()
+		return c.errorReply(err)
+	}
+	return reply
+}
+
+func (c *memcachedConn) closeProxy() {
+	if c.leader != nil {
+		c.leader.conn.Close()
+		c.leader = nil
+	}
+}
+
+// memcachedProxy is the connection a follower
+// proxies the commands of a client through.
+type memcachedProxy struct {
+	conf    *configs.Live
+	address string
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+}
+
+func dialMemcachedProxy(conf *configs.Live, address string) (p *memcachedProxy, err error) {
+	conn, err := net.DialTimeout("tcp", address, conf.Load().Timeouts.Timeout())
+	if err != nil {
+		return nil, err
+	}
+
+	p = &memcachedProxy{
+		conf:    conf,
+		address: address,
+		conn:    conn,
+		r:       bufio.NewReaderSize(conn, respReadBufferSize),
+		w:       bufio.NewWriter(conn),
+	}
+
+	reply, err := p.do(&memcachedCommand{
+		name: memcachedForwardedCommand,
+		args: []string{conf.Load().Raft.NodeID},
+	})
+	if err == nil && reply != mcOK {
+		err = fmt.Errorf("leader refused %s: %s", memcachedForwardedCommand, strings.TrimSpace(reply))
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// do sends the command always asking for the reply, the
+// client connection drops it when noreply was requested.
+func (p *memcachedProxy) do(cmd *memcachedCommand) (string, error) {
+	if timeout := p.conf.Load().Timeouts.Timeout(); timeout > 0 {
+		p.conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	p.w.WriteString(strings.Join(append([]string{cmd.name}, cmd.args...), " "))
+	p.w.WriteString("\r\n")
+	if cmd.data != nil {
+		p.w.Write(cmd.data)
+		p.w.WriteString("\r\n")
+	}
+	if err := p.w.Flush(); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for {
+		line, err := readLine(p.r)
+		if err != nil {
+			return "", err
+		}
+		b.WriteString(line)
+		b.WriteString("\r\n")
+
+		// only the retrieval commands reply with more than one line
+		fields := strings.Fields(line)
+		if (cmd.name != "get" && cmd.name != "gets") || len(fields) == 0 || fields[0] != "VALUE" {
+			return b.String(), nil
+		}
+		if len(fields) < 4 {
+			return "", fmt.Errorf("malformed reply %q", line)
+		}
+
+		size, err := strconv.Atoi(fields[3])
+		if err != nil || size < 0 {
+			return "", fmt.Errorf("malformed reply %q", line)
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(p.r, data); err != nil {
+			return "", err
+		}
+		b.Write(data)
+	}
+}
@@ -0,0 +1,66 @@
+package servers
+
+import (
+	"strconv"
+
+	"github.com/alex60217101990/nietzsche/external/metrics"
+
+	"github.com/hashicorp/raft"
+)
+
+var (
+	leaderChanges = metrics.AppMetrics.Counter("raft_leader_changes_total",
+		"Leader changes observed by the node.")
+	appendLatency = metrics.AppMetrics.Histogram("raft_append_entries_seconds",
+		"Round trip of the AppendEntries RPCs sent to other servers.", metrics.LatencyBuckets)
+)
+
+// raftStatsGauges are exported from the values of raft.Stats.
+var raftStatsGauges = []struct {
+	stat string
+	name string
+	help string
+}{
+	{"term", "raft_term", "Current raft term."},
+	{"commit_index", "raft_commit_index", "Index of the last committed log entry."},
+	{"applied_index", "raft_applied_index", "Index of the last log entry applied to the store."},
+	{"last_log_index", "raft_last_log_index", "Index of the last log entry in the local log."},
+	{"fsm_pending", "raft_fsm_pending", "Committed entries waiting to be applied to the store."},
+	{"last_snapshot_index", "raft_last_snapshot_index", "Index of the last log entry in the latest snapshot."},
+	{"num_peers", "raft_peers", "Other voters in the raft configuration."},
+}
+
+func (n *RaftNode) registerMetrics() {
+	for _, gauge := range raftStatsGauges {
+		stat := gauge.stat
+		metrics.AppMetrics.GaugeFunc(gauge.name, gauge.help, func() float64 {
+			value, _ := strconv.ParseFloat(n.raft.Stats()[stat], 64)
+			return value
+		})
+	}
+
+	metrics.AppMetrics.GaugeFunc("raft_state",
+		"Raft state of the node: 0 follower, 1 candidate, 2 leader, 3 shutdown.", func() float64 {
+			return float64(n.raft.State())
+		})
+
+	observations := make(chan raft.Observation, 1)
+	observer := raft.NewObserver(observations, false, func(o *raft.Observation) bool {
+		_, ok := o.Data.(raft.LeaderObservation)
+		return ok
+	})
+	n.raft.RegisterObserver(observer)
+
+	go func() {
+		defer n.raft.DeregisterObserver(observer)
+
+		for {
+			select {
+			case <-observations:
+				leaderChanges.Inc()
+			case <-n.shutdownCh:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,118 @@
+package servers
+
+import (
+	"errors"
+
+	"github.com/alex60217101990/nietzsche/external/configs"
+	"github.com/alex60217101990/nietzsche/external/helpers"
+	"github.com/alex60217101990/nietzsche/external/logger"
+	"github.com/alex60217101990/nietzsche/external/store"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+)
+
+var (
+	errNodeNotStarted    = errors.New("raft node is not started")
+	errNonvoterBootstrap = errors.New("a non-voter can't bootstrap the cluster")
+)
+
+// RaftNode runs the replicated store on top of a raft server.
+type RaftNode struct {
+	conf      *configs.Live
+	log       logger.Logger
+	raftLog   hclog.Logger
+	fsm       store.Store
+	raft      *raft.Raft
+	logStore  *raftboltdb.BoltStore
+	transport *progressTracker
+	autopilot *autopilot
+	leases    *leaseKeeper
+
+	shutdownCh chan struct{}
+}
+
+// NewRaftNode returns a node serving the store with the given configuration,
+// the configuration is shared with the caller, which reloads it.
+func NewRaftNode(conf *configs.Live, fsm store.Store, log logger.Logger) *RaftNode {
+	return &RaftNode{
+		conf:    conf,
+		log:     log,
+		raftLog: helpers.NewRaftLogger(log, conf.Load().Raft.LogLevel),
+		fsm:     fsm,
+	}
+}
+
+// config returns the running configuration of the node.
+func (n *RaftNode) config() *configs.Configs {
+	return n.conf.Load()
+}
+
+func (n *RaftNode) Start() (err error) {
+	conf := n.config()
+	if conf.Raft.Bootstrap && conf.Raft.Suffrage == configs.Nonvoter {
+		return errNonvoterBootstrap
+	}
+
+	var transport *raft.NetworkTransport
+	transport, err = helpers.NewRaftTransport(conf, n.raftLog)
+	if err != nil {
+		return err
+	}
+
+	n.transport = newProgressTracker(transport)
+	n.raft, n.logStore, err = helpers.NewRaftNode(conf, n.fsm, n.transport, n.raftLog)
+	if err != nil {
+		transport.Close()
+		return err
+	}
+
+	if conf.Autopilot != nil {
+		n.autopilot = newAutopilot(n)
+	}
+
+	n.leases = newLeaseKeeper(n)
+	n.shutdownCh = make(chan struct{})
+	n.registerMetrics()
+	go n.monitorLeadership()
+	if !conf.Raft.Bootstrap && len(conf.Raft.Join) > 0 {
+		go n.join()
+	}
+
+	return nil
+}
+
+func (n *RaftNode) Close() (err error) {
+	if n.raft == nil {
+		return errNodeNotStarted
+	}
+
+	n.stepDown()
+	close(n.shutdownCh)
+
+	// shutdown closes the transport as well
+	if err = n.raft.Shutdown().Error(); err != nil {
+		return err
+	}
+	if err = n.logStore.Close(); err != nil {
+		return err
+	}
+
+	return n.fsm.Close()
+}
+
+// SetRaftLogLevel changes the level of the raft loggers,
+// an empty level stands for info.
+func (n *RaftNode) SetRaftLogLevel(level string) {
+	lvl := hclog.LevelFromString(level)
+	if lvl == hclog.NoLevel {
+		lvl = hclog.Info
+	}
+	n.raftLog.SetLevel(lvl)
+}
+
+// Raft returns the underlying raft server.
+func (n *RaftNode) Raft() *raft.Raft {
+	return n.raft
+}
@@ -0,0 +1,171 @@
+package servers
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/metrics"
+
+	"github.com/hashicorp/raft"
+)
+
+// serverProgress is the replication state of a single server
+// as seen by the leader.
+type serverProgress struct {
+	LastContact time.Time
+	MatchIndex  uint64
+}
+
+// progressTracker wraps the raft transport and records the last successful
+// contact and the highest replicated log index of every server the local
+// node sends entries to. The data is only meaningful while the node is leader.
+type progressTracker struct {
+	raft.Transport
+
+	mu      sync.RWMutex
+	servers map[raft.ServerID]serverProgress
+}
+
+func newProgressTracker(transport raft.Transport) *progressTracker {
+	return &progressTracker{
+		Transport: transport,
+		servers:   make(map[raft.ServerID]serverProgress),
+	}
+}
+
+// Get returns the tracked progress of the server.
+func (t *progressTracker) Get(id raft.ServerID) (progress serverProgress, ok bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	progress, ok = t.servers[id]
+	return progress, ok
+}
+
+// Forget drops the tracked progress of the server.
+func (t *progressTracker) Forget(id raft.ServerID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.servers, id)
+}
+
+func (t *progressTracker) observe(id raft.ServerID, matchIndex uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	progress := t.servers[id]
+	progress.LastContact = time.Now()
+	if matchIndex > progress.MatchIndex {
+		progress.MatchIndex = matchIndex
+	}
+	t.servers[id] = progress
+}
+
+func (t *progressTracker) observeAppend(id raft.ServerID, args *raft.AppendEntriesRequest, resp *raft.AppendEntriesResponse) {
+	var matchIndex uint64
+	if resp.Success {
+		if n := len(args.Entries); n > 0 {
+			matchIndex = args.Entries[n-1].Index
+		} else {
+			matchIndex = args.PrevLogEntry
+		}
+	}
+	t.observe(id, matchIndex)
+}
+
+// AppendEntries implements the raft.Transport interface.
+func (t *progressTracker) AppendEntries(id raft.ServerID, target raft.ServerAddress, args *raft.AppendEntriesRequest, resp *raft.AppendEntriesResponse) error {
+	start := time.Now()
+	err := t.Transport.AppendEntries(id, target, args, resp)
+	appendLatency.Observe(metrics.Since(start))
+	if err == nil {
+		t.observeAppend(id, args, resp)
+	}
+	return err
+}
+
+// AppendEntriesPipeline implements the raft.Transport interface.
+func (t *progressTracker) AppendEntriesPipeline(id raft.ServerID, target raft.ServerAddress) (raft.AppendPipeline, error) {
+	pipeline, err := t.Transport.AppendEntriesPipeline(id, target)
+	if err != nil {
+		return nil, err
+	}
+	return newTrackedPipeline(t, id, pipeline), nil
+}
+
+// InstallSnapshot implements the raft.Transport interface.
+func (t *progressTracker) InstallSnapshot(id raft.ServerID, target raft.ServerAddress, args *raft.InstallSnapshotRequest, resp *raft.InstallSnapshotResponse, data io.Reader) error {
+	err := t.Transport.InstallSnapshot(id, target, args, resp, data)
+	if err == nil && resp.Success {
+		t.observe(id, args.LastLogIndex)
+	}
+	return err
+}
+
+// Close implements the raft.WithClose interface,
+// so raft shuts the wrapped transport down.
+func (t *progressTracker) Close() error {
+	if closer, ok := t.Transport.(raft.WithClose); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// trackedPipeline observes the responses of a pipelined
+// AppendEntries stream before handing them to raft.
+type trackedPipeline struct {
+	raft.AppendPipeline
+
+	id       raft.ServerID
+	tracker  *progressTracker
+	consumer chan raft.AppendFuture
+	stopCh   chan struct{}
+	stopOnce sync.Once
+}
+
+func newTrackedPipeline(tracker *progressTracker, id raft.ServerID, pipeline raft.AppendPipeline) *trackedPipeline {
+	p := &trackedPipeline{
+		AppendPipeline: pipeline,
+		id:             id,
+		tracker:        tracker,
+		consumer:       make(chan raft.AppendFuture),
+		stopCh:         make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+func (p *trackedPipeline) run() {
+	for {
+		select {
+		case future := <-p.AppendPipeline.Consumer():
+			appendLatency.Observe(metrics.Since(future.Start()))
+			if future.Error() == nil {
+				p.tracker.observeAppend(p.id, future.Request(), future.Response())
+			}
+
+			select {
+			case p.consumer <- future:
+			case <-p.stopCh:
+				return
+			}
+		case <-p.stopCh:
+			return
+		}
+	}
+}
+
+// Consumer implements the raft.AppendPipeline interface.
+func (p *trackedPipeline) Consumer() <-chan raft.AppendFuture {
+	return p.consumer
+}
+
+// Close implements the raft.AppendPipeline interface.
+func (p *trackedPipeline) Close() error {
+	p.stopOnce.Do(func() {
+		close(p.stopCh)
+	})
+	return p.AppendPipeline.Close()
+}
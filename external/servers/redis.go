@@ -0,0 +1,363 @@
+package servers
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/configs"
+
+	"github.com/hashicorp/raft"
+)
+
+const (
+	// redisVersion is reported to clients, which pick
+	// the commands and options they use after it.
+	redisVersion = "7.0.0"
+
+	// respForwardedCommand marks connections a follower opens to proxy
+	// commands to the leader, so they are not proxied again while
+	// the leadership is changing.
+	respForwardedCommand = "NIETZSCHE.FORWARDED"
+
+	// size of the read buffer, it limits the length of inline commands
+	respReadBufferSize = 64 << 10
+)
+
+// RedisServer serves the replicated store over the RESP protocol. Writes go
+// through the raft log of the leader, followers proxy them to the leader or
+// answer MOVED errors pointing to it.
+type RedisServer struct {
+	*tcpServer
+
+	node   *RaftNode
+	lastID int64
+}
+
+func NewRedisServer(node *RaftNode) *RedisServer {
+	return &RedisServer{
+		tcpServer: newTCPServer("redis", fmt.Sprintf("%s:%d", node.config().Redis.Host, node.config().Redis.Port), node.log),
+		node:      node,
+	}
+}
+
+func (s *RedisServer) Start() error {
+	return s.start(func(conn net.Conn) {
+		newRedisConn(s, conn).serve()
+	})
+}
+
+func (s *RedisServer) Close() error {
+	return s.close()
+}
+
+// redisConn is a single client connection,
+// its commands are served one after another.
+type redisConn struct {
+	server *RedisServer
+	conn   net.Conn
+	r      *bufio.Reader
+	w      *bufio.Writer
+
+	id        int64
+	name      string
+	proto     int
+	quit      bool
+	forwarded bool
+
+	// authenticated user and the credentials the
+	// proxied commands are authenticated with
+	user        *User
+	credentials []string
+
+	// connection to the leader the commands are proxied to
+	leader *redisProxy
+
+	// ctx carries the request ID of the command being served
+	ctx context.Context
+}
+
+func newRedisConn(s *RedisServer, conn net.Conn) *redisConn {
+	return &redisConn{
+		server: s,
+		conn:   conn,
+		r:      bufio.NewReaderSize(conn, respReadBufferSize),
+		w:      bufio.NewWriter(conn),
+		id:     atomic.AddInt64(&s.lastID, 1),
+		proto:  2,
+	}
+}
+
+func (c *redisConn) serve() {
+	defer c.closeProxy()
+
+	for {
+		args, err := readCommand(c.r)
+		if err != nil {
+			if perr, ok := err.(respProtocolError); ok {
+				writeReply(c.w, c.proto, respError("ERR "+perr.Error()))
+				c.w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		if err = writeReply(c.w, c.proto, c.dispatch(args)); err != nil {
+			return
+		}
+
+		// pipelined commands are answered together
+		if c.quit || c.r.Buffered() == 0 {
+			if err = c.w.Flush(); err != nil || c.quit {
+				return
+			}
+		}
+	}
+}
+
+func (c *redisConn) dispatch(args []string) interface{} {
+	c.ctx = c.server.node.requestContext(context.Background(), "")
+
+	cmd, ok := redisCommands[strings.ToUpper(args[0])]
+	if !ok {
+		return respError(fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+	if (cmd.arity > 0 && len(args) != cmd.arity) || len(args) < -cmd.arity {
+		return respError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(args[0])))
+	}
+
+	if !cmd.public {
+		if err := c.authorizeCommand(cmd, args); err != nil {
+			return c.errorReply(err)
+		}
+	}
+
+	conf := c.server.node.config().Redis
+	if (cmd.leader || (cmd.read && !conf.StaleReads)) && !c.server.node.IsLeader() {
+		if conf.Redirect || c.forwarded {
+			return c.moved(args)
+		}
+		return c.proxy(args)
+	}
+
+	return cmd.run(c, args)
+}
+
+// login authenticates the connection as the user.
+func (c *redisConn) login(name, password string) error {
+	if !c.server.node.authEnabled() {
+		return ErrAuthDisabled
+	}
+
+	user, err := c.server.node.CheckPassword(name, password)
+	if err != nil {
+		return err
+	}
+
+	// the proxy connection is authenticated as the new user once reopened
+	c.closeProxy()
+	c.user, c.credentials = user, []string{"AUTH", name, password}
+	return nil
+}
+
+// authorize checks the access to the key, the user is reloaded,
+// so the changes of its roles apply to the open connections.
+func (c *redisConn) authorize(key, access string) error {
+	if !c.server.node.authEnabled() {
+		return nil
+	}
+	if c.user == nil {
+		return ErrUnauthenticated
+	}
+
+	user, err := c.server.node.User(c.user.Name)
+	if err == ErrUnknownUser {
+		return ErrUnauthenticated
+	}
+	if err != nil {
+		return err
+	}
+	return c.server.node.Authorize(user, key, access)
+}
+
+func (c *redisConn) authorizeCommand(cmd redisCommand, args []string) error {
+	if cmd.keys == nil {
+		// any key will do, the user only has to be authenticated
+		if c.user == nil && c.server.node.authEnabled() {
+			return ErrUnauthenticated
+		}
+		return nil
+	}
+
+	for _, key := range cmd.keys(args) {
+		if err := c.authorize(key, cmd.access); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consistency of the reads served by the connection, followers
+// only serve them when stale reads are enabled.
+func (c *redisConn) consistency() Consistency {
+	if c.server.node.IsLeader() {
+		return Consistent
+	}
+	return Stale
+}
+
+// moved points the client to the RESP address of the leader.
+func (c *redisConn) moved(args []string) interface{} {
+	address, err := c.server.node.LeaderRedisAddr()
+	if err != nil {
+		return c.errorReply(ErrNoLeader)
+	}
+
+	var slot uint16
+	if len(args) > 1 {
+		slot = keySlot(args[1])
+	}
+	return respError(fmt.Sprintf("MOVED %d %s", slot, address))
+}
+
+// proxy runs the command on the leader and relays its reply.
+func (c *redisConn) proxy(args []string) interface{} {
+	address, err := c.server.node.LeaderRedisAddr()
+	if err != nil {
+		return c.errorReply(ErrNoLeader)
+	}
+
+	if c.leader != nil && c.leader.address != address {
+		c.closeProxy()
+	}
+	if c.leader == nil {
+		if c.leader, err = dialRedisProxy(c.server.node.conf, address, c.proto, c.credentials); err != nil {
+			return c.errorReply(err)
+		}
+	}
+
+	reply, err := c.leader.do(args)
+	if err != nil {
+		c.closeProxy()
+		return c.errorReply(err)
+	}
+	return respRaw(reply)
+}
+
+func (c *redisConn) closeProxy() {
+	if c.leader != nil {
+		c.leader.conn.Close()
+		c.leader = nil
+	}
+}
+
+// errorReply maps the errors of the node to RESP errors.
+func (c *redisConn) errorReply(err error) interface{} {
+	switch err {
+	case raft.ErrNotLeader, raft.ErrLeadershipLost:
+		return respError("TRYAGAIN " + err.Error())
+	case ErrNoLeader:
+		return respError("CLUSTERDOWN " + err.Error())
+	case ErrUnauthenticated:
+		return respError("NOAUTH Authentication required.")
+	case ErrBadCredentials:
+		return respError("WRONGPASS invalid username-password pair or user is disabled.")
+	case ErrPermissionDenied:
+		return respError("NOPERM " + err.Error())
+	case ErrAuthDisabled:
+		return respError("ERR AUTH called without any password configured for the default user")
+	default:
+		return respError("ERR " + err.Error())
+	}
+}
+
+// redisProxy is the connection a follower proxies the commands of a client
+// through, it uses the protocol version and the credentials of the client.
+type redisProxy struct {
+	conf    *configs.Live
+	address string
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+}
+
+func dialRedisProxy(conf *configs.Live, address string, proto int, credentials []string) (p *redisProxy, err error) {
+	timeout := conf.Load().Timeouts.Timeout()
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	p = &redisProxy{
+		conf:    conf,
+		address: address,
+		conn:    conn,
+		r:       bufio.NewReaderSize(conn, respReadBufferSize),
+		w:       bufio.NewWriter(conn),
+	}
+
+	setup := [][]string{{respForwardedCommand, conf.Load().Raft.NodeID}}
+	if len(credentials) > 0 {
+		setup = append(setup, credentials)
+	}
+	if proto != 2 {
+		setup = append(setup, []string{"HELLO", fmt.Sprint(proto)})
+	}
+	for _, args := range setup {
+		reply, err := p.do(args)
+		if err == nil && len(reply) > 0 && reply[0] == '-' {
+			err = fmt.Errorf("leader refused %s: %s", args[0], strings.TrimSpace(string(reply[1:])))
+		}
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+func (p *redisProxy) do(args []string) ([]byte, error) {
+	if timeout := p.conf.Load().Timeouts.Timeout(); timeout > 0 {
+		p.conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	if err := writeCommand(p.w, args); err != nil {
+		return nil, err
+	}
+	return readReply(p.r)
+}
+
+// keySlot returns the Redis Cluster hash slot of the key, only the
+// part between braces is hashed when the key has a hash tag.
+func keySlot(key string) uint16 {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return crc16(key) % 16384
+}
+
+// crc16 is the CRC16-CCITT (XMODEM) checksum used by Redis Cluster.
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,822 @@
+package servers
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+	"github.com/alex60217101990/nietzsche/external/store"
+)
+
+const (
+	respErrSyntax     = respError("ERR syntax error")
+	respErrNotInteger = respError("ERR value is not an integer or out of range")
+	respErrOverflow   = respError("ERR increment or decrement would overflow")
+	respErrContention = respError("ERR the key keeps changing concurrently, retry the command")
+)
+
+type redisCommand struct {
+	// number of arguments including the command name,
+	// a negative one is the minimum number
+	arity int
+	// leader commands run on the leader only, read commands
+	// run on followers when stale reads are enabled
+	leader bool
+	read   bool
+	// keys returns the keys the command needs the access to, the other
+	// commands only need an authenticated user unless they're public
+	keys   func(args []string) []string
+	access string
+	public bool
+	run    func(c *redisConn, args []string) interface{}
+}
+
+func firstKey(args []string) []string {
+	return args[1:2]
+}
+
+func allKeys(args []string) []string {
+	return args[1:]
+}
+
+// pairKeys returns the keys of the key value pairs.
+func pairKeys(args []string) []string {
+	keys := make([]string, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		keys = append(keys, args[i])
+	}
+	return keys
+}
+
+var redisCommands = map[string]redisCommand{
+	"PING":    {arity: -1, run: (*redisConn).ping},
+	"ECHO":    {arity: 2, run: (*redisConn).echo},
+	"HELLO":   {arity: -1, public: true, run: (*redisConn).hello},
+	"AUTH":    {arity: -2, public: true, run: (*redisConn).auth},
+	"SELECT":  {arity: 2, run: (*redisConn).selectDB},
+	"QUIT":    {arity: -1, public: true, run: (*redisConn).quitConn},
+	"COMMAND": {arity: -1, run: (*redisConn).command},
+	"CLIENT":  {arity: -2, run: (*redisConn).client},
+	"INFO":    {arity: -1, run: (*redisConn).info},
+
+	"GET":    {arity: 2, read: true, keys: firstKey, access: AccessRead, run: (*redisConn).get},
+	"MGET":   {arity: -2, read: true, keys: allKeys, access: AccessRead, run: (*redisConn).mget},
+	"EXISTS": {arity: -2, read: true, keys: allKeys, access: AccessRead, run: (*redisConn).exists},
+	"SCAN":   {arity: -2, read: true, run: (*redisConn).scan},
+
+	"SET":     {arity: -3, leader: true, keys: firstKey, access: AccessWrite, run: (*redisConn).set},
+	"MSET":    {arity: -3, leader: true, keys: pairKeys, access: AccessWrite, run: (*redisConn).mset},
+	"DEL":     {arity: -2, leader: true, keys: allKeys, access: AccessWrite, run: (*redisConn).del},
+	"INCR":    {arity: 2, leader: true, keys: firstKey, access: AccessReadWrite, run: (*redisConn).incr},
+	"DECR":    {arity: 2, leader: true, keys: firstKey, access: AccessReadWrite, run: (*redisConn).decr},
+	"INCRBY":  {arity: 3, leader: true, keys: firstKey, access: AccessReadWrite, run: (*redisConn).incrBy},
+	"DECRBY":  {arity: 3, leader: true, keys: firstKey, access: AccessReadWrite, run: (*redisConn).decrBy},
+	"EXPIRE":  {arity: 3, leader: true, keys: firstKey, access: AccessWrite, run: (*redisConn).expire},
+	"PEXPIRE": {arity: 3, leader: true, keys: firstKey, access: AccessWrite, run: (*redisConn).pexpire},
+	"TTL":     {arity: 2, leader: true, keys: firstKey, access: AccessRead, run: (*redisConn).ttl},
+	"PTTL":    {arity: 2, leader: true, keys: firstKey, access: AccessRead, run: (*redisConn).pttl},
+
+	respForwardedCommand: {arity: 2, public: true, run: (*redisConn).markForwarded},
+}
+
+// respValue turns the stored value into a RESP string.
+func respValue(value interface{}) interface{} {
+	s, err := stringValue(value)
+	if err != nil {
+		return respError("ERR " + err.Error())
+	}
+	return s
+}
+
+// respInteger reads the stored value as an integer, numbers written
+// through the JSON APIs are accepted while they have no fraction.
+func respInteger(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	case float64:
+		if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// parseTTL reads a positive expire time in the unit.
+func parseTTL(arg string, unit time.Duration) (time.Duration, bool) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || n > int64(math.MaxInt64/unit) {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// leaseTTL rounds the expire time up to the whole seconds of a lease.
+func leaseTTL(ttl time.Duration) int64 {
+	return int64((ttl + time.Second - 1) / time.Second)
+}
+
+// read gets the keys, consistent reads run as a single
+// transaction, so the values come from the same revision.
+func (c *redisConn) read(keys []string) ([]store.TxnOpResult, error) {
+	node := c.server.node
+	if c.consistency() == Stale {
+		results := make([]store.TxnOpResult, 0, len(keys))
+		for _, key := range keys {
+			value, err := node.Get(c.ctx, key, Stale)
+			if err != nil && err != store.ErrKeyNotFound {
+				return nil, err
+			}
+			results = append(results, store.TxnOpResult{
+				Operation: "GET",
+				Key:       key,
+				Value:     value,
+				Found:     err == nil,
+			})
+		}
+		return results, nil
+	}
+
+	ops := make([]store.TxnOp, 0, len(keys))
+	for _, key := range keys {
+		ops = append(ops, store.TxnOp{Operation: "GET", Key: key})
+	}
+
+	resp, err := node.Txn(c.ctx, &store.Txn{Success: ops})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// update runs a compare-and-set loop on the key. fn gets the current value
+// and returns the operation replacing it with the reply to send once it's
+// applied, a nil operation sends the reply right away.
+func (c *redisConn) update(key string, fn func(value interface{}, found bool) (*store.TxnOp, interface{})) interface{} {
+	results, err := c.read([]string{key})
+	if err != nil {
+		return c.errorReply(err)
+	}
+	current := results[0]
+
+	for i := 0; i < consts.CASMaxRetries; i++ {
+		op, reply := fn(current.Value, current.Found)
+		if op == nil {
+			return reply
+		}
+
+		cmp := store.Compare{Key: key, Result: store.CompareMissing}
+		if current.Found {
+			cmp = store.Compare{Key: key, Result: store.CompareEqual, Value: current.Value}
+		}
+
+		resp, err := c.server.node.Txn(c.ctx, &store.Txn{
+			Compare: []store.Compare{cmp},
+			Success: []store.TxnOp{*op},
+			Failure: []store.TxnOp{{Operation: "GET", Key: key}},
+		})
+		if err != nil {
+			return c.errorReply(err)
+		}
+		if resp.Succeeded {
+			return reply
+		}
+		current = resp.Results[0]
+	}
+
+	return respErrContention
+}
+
+func (c *redisConn) ping(args []string) interface{} {
+	switch len(args) {
+	case 1:
+		return respStatus("PONG")
+	case 2:
+		return args[1]
+	default:
+		return respError("ERR wrong number of arguments for 'ping' command")
+	}
+}
+
+func (c *redisConn) echo(args []string) interface{} {
+	return args[1]
+}
+
+// hello switches the protocol version, the reply is
+// already encoded with the negotiated version.
+func (c *redisConn) hello(args []string) interface{} {
+	proto := c.proto
+	if len(args) > 1 {
+		var err error
+		if proto, err = strconv.Atoi(args[1]); err != nil {
+			return respErrNotInteger
+		}
+		if proto < 2 || proto > 3 {
+			return respError("NOPROTO unsupported protocol version")
+		}
+	}
+
+	name := c.name
+	for i := 2; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "SETNAME" && i+1 < len(args):
+			i++
+			name = args[i]
+		case opt == "AUTH" && i+2 < len(args):
+			if err := c.login(args[i+1], args[i+2]); err != nil {
+				return c.errorReply(err)
+			}
+			i += 2
+		default:
+			return respErrSyntax
+		}
+	}
+
+	if proto != c.proto {
+		// the proxied replies have to use the new version as well
+		c.closeProxy()
+	}
+	c.proto, c.name = proto, name
+
+	return respMap{
+		"server", "redis",
+		"version", redisVersion,
+		"proto", int64(c.proto),
+		"id", c.id,
+		"mode", "standalone",
+		"role", c.role(),
+		"modules", []interface{}{},
+	}
+}
+
+// auth authenticates the connection, the single argument
+// form takes the password of the root user.
+func (c *redisConn) auth(args []string) interface{} {
+	var err error
+	switch len(args) {
+	case 2:
+		err = c.login(consts.RootUser, args[1])
+	case 3:
+		err = c.login(args[1], args[2])
+	default:
+		return respErrSyntax
+	}
+
+	if err != nil {
+		return c.errorReply(err)
+	}
+	return respStatus("OK")
+}
+
+func (c *redisConn) role() string {
+	if c.server.node.IsLeader() {
+		return "master"
+	}
+	return "replica"
+}
+
+// selectDB accepts the default database only, there are no others.
+func (c *redisConn) selectDB(args []string) interface{} {
+	if args[1] != "0" {
+		return respError("ERR DB index is out of range")
+	}
+	return respStatus("OK")
+}
+
+func (c *redisConn) quitConn(args []string) interface{} {
+	c.quit = true
+	return respStatus("OK")
+}
+
+// command describes no commands, clients fall back to their defaults.
+func (c *redisConn) command(args []string) interface{} {
+	return []interface{}{}
+}
+
+func (c *redisConn) client(args []string) interface{} {
+	switch strings.ToUpper(args[1]) {
+	case "SETNAME":
+		if len(args) != 3 {
+			return respErrSyntax
+		}
+		c.name = args[2]
+		return respStatus("OK")
+	case "GETNAME":
+		if len(c.name) == 0 {
+			return nil
+		}
+		return c.name
+	case "ID":
+		return c.id
+	case "SETINFO":
+		return respStatus("OK")
+	default:
+		return respError(fmt.Sprintf("ERR unknown subcommand '%s'", args[1]))
+	}
+}
+
+func (c *redisConn) markForwarded(args []string) interface{} {
+	c.forwarded = true
+	return respStatus("OK")
+}
+
+// info reports the server, clients, replication and keyspace sections.
+func (c *redisConn) info(args []string) interface{} {
+	sections := map[string]bool{}
+	for _, arg := range args[1:] {
+		sections[strings.ToLower(arg)] = true
+	}
+	all := len(sections) == 0 || sections["all"] || sections["default"] || sections["everything"]
+
+	var b strings.Builder
+	section := func(name string, fields [][2]string) {
+		if !all && !sections[strings.ToLower(name)] {
+			return
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		fmt.Fprintf(&b, "# %s\r\n", name)
+		for _, field := range fields {
+			fmt.Fprintf(&b, "%s:%s\r\n", field[0], field[1])
+		}
+	}
+
+	node := c.server.node
+	section("Server", [][2]string{
+		{"redis_version", redisVersion},
+		{"redis_mode", "standalone"},
+		{"nietzsche_node_id", c.server.node.config().Raft.NodeID},
+		{"tcp_port", strconv.Itoa(int(c.server.node.config().Redis.Port))},
+		{"uptime_in_seconds", strconv.FormatInt(int64(time.Since(c.server.started)/time.Second), 10)},
+	})
+	section("Clients", [][2]string{
+		{"connected_clients", strconv.Itoa(c.server.clients())},
+	})
+
+	replication := [][2]string{{"role", c.role()}}
+	if node.IsLeader() {
+		var replicas int
+		if membership, err := node.Members(); err == nil {
+			replicas = len(membership.Servers) - 1
+		}
+		replication = append(replication, [2]string{"connected_slaves", strconv.Itoa(replicas)})
+	} else if address, err := node.LeaderRedisAddr(); err == nil {
+		if host, port, err := net.SplitHostPort(address); err == nil {
+			replication = append(replication, [2]string{"master_host", host}, [2]string{"master_port", port})
+		}
+	}
+	if node.raft != nil {
+		replication = append(replication,
+			[2]string{"raft_state", strings.ToLower(node.raft.State().String())},
+			[2]string{"raft_applied_index", strconv.FormatUint(node.raft.AppliedIndex(), 10)})
+	}
+	section("Replication", replication)
+
+	if all || sections["keyspace"] {
+		keys, err := node.fsm.Scan("", 0, func(key string) bool {
+			return strings.HasPrefix(key, consts.SystemKeyPreffix)
+		})
+		if err != nil {
+			return c.errorReply(err)
+		}
+
+		var expires int
+		for _, entry := range keys {
+			if id, err := node.fsm.LeaseOf(entry.Key); err == nil && id != 0 {
+				expires++
+			}
+		}
+
+		var fields [][2]string
+		if len(keys) > 0 {
+			fields = append(fields, [2]string{"db0", fmt.Sprintf("keys=%d,expires=%d", len(keys), expires)})
+		}
+		section("Keyspace", fields)
+	}
+
+	return b.String()
+}
+
+func (c *redisConn) get(args []string) interface{} {
+	results, err := c.read(args[1:2])
+	if err != nil {
+		return c.errorReply(err)
+	}
+	if !results[0].Found {
+		return nil
+	}
+	return respValue(results[0].Value)
+}
+
+func (c *redisConn) mget(args []string) interface{} {
+	results, err := c.read(args[1:])
+	if err != nil {
+		return c.errorReply(err)
+	}
+
+	values := make([]interface{}, 0, len(results))
+	for _, result := range results {
+		if result.Found {
+			values = append(values, respValue(result.Value))
+		} else {
+			values = append(values, nil)
+		}
+	}
+	return values
+}
+
+func (c *redisConn) exists(args []string) interface{} {
+	results, err := c.read(args[1:])
+	if err != nil {
+		return c.errorReply(err)
+	}
+
+	var count int64
+	for _, result := range results {
+		if result.Found {
+			count++
+		}
+	}
+	return count
+}
+
+// scan pages through the keys in their sorted order,
+// the cursor is the position of the next page.
+func (c *redisConn) scan(args []string) interface{} {
+	cursor, err := strconv.ParseUint(args[1], 10, 64)
+	if err != nil {
+		return respError("ERR invalid cursor")
+	}
+
+	var (
+		count    uint64 = 10
+		match    string
+		onlyType string
+	)
+	for i := 2; i < len(args); i++ {
+		if i+1 >= len(args) {
+			return respErrSyntax
+		}
+
+		switch strings.ToUpper(args[i]) {
+		case "MATCH":
+			match = args[i+1]
+		case "COUNT":
+			if count, err = strconv.ParseUint(args[i+1], 10, 64); err != nil || count == 0 {
+				return respErrSyntax
+			}
+		case "TYPE":
+			onlyType = strings.ToLower(args[i+1])
+		default:
+			return respErrSyntax
+		}
+		i++
+	}
+
+	entries, err := c.server.node.Scan("", 0, c.consistency())
+	if err != nil {
+		return c.errorReply(err)
+	}
+
+	var (
+		total = uint64(len(entries))
+		start = cursor
+		end   = cursor + count
+		next  = end
+	)
+	if start > total {
+		start = total
+	}
+	if end >= total || end < start {
+		end, next = total, 0
+	}
+
+	keys := make([]interface{}, 0, end-start)
+	for _, entry := range entries[start:end] {
+		if len(onlyType) > 0 && onlyType != "string" {
+			continue
+		}
+		if c.authorize(entry.Key, AccessRead) != nil {
+			// the keys the user can't read are skipped
+			continue
+		}
+		if len(match) > 0 && !globMatch(match, entry.Key) {
+			continue
+		}
+		keys = append(keys, entry.Key)
+	}
+
+	return []interface{}{strconv.FormatUint(next, 10), keys}
+}
+
+// set supports the NX, XX, EX, PX and KEEPTTL options,
+// the expire time is kept by a lease granted for the key.
+func (c *redisConn) set(args []string) interface{} {
+	var (
+		nx, xx, keepTTL bool
+		ttl             time.Duration
+	)
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); {
+		case opt == "NX" && !xx:
+			nx = true
+		case opt == "XX" && !nx:
+			xx = true
+		case opt == "KEEPTTL" && ttl == 0:
+			keepTTL = true
+		case (opt == "EX" || opt == "PX") && !keepTTL && ttl == 0 && i+1 < len(args):
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+
+			i++
+			var ok bool
+			if ttl, ok = parseTTL(args[i], unit); !ok {
+				return respErrNotInteger
+			}
+			if ttl <= 0 {
+				return respError("ERR invalid expire time in 'set' command")
+			}
+		default:
+			return respErrSyntax
+		}
+	}
+
+	node := c.server.node
+	op := store.TxnOp{
+		Operation: "SET",
+		Key:       args[1],
+		Value:     args[2],
+		KeepLease: keepTTL,
+	}
+	if ttl > 0 {
+		lease, err := node.Grant(c.ctx, leaseTTL(ttl), userName(c.user))
+		if err != nil {
+			return c.errorReply(err)
+		}
+		op.Lease = lease.ID
+	}
+
+	txn := &store.Txn{Success: []store.TxnOp{op}}
+	switch {
+	case nx:
+		txn.Compare = []store.Compare{{Key: op.Key, Result: store.CompareMissing}}
+	case xx:
+		txn.Compare = []store.Compare{{Key: op.Key, Result: store.CompareExists}}
+	}
+
+	resp, err := node.Txn(c.ctx, txn)
+	if err != nil || !resp.Succeeded {
+		if op.Lease != 0 {
+			// nothing is attached to the lease, it would expire anyway
+			node.Revoke(c.ctx, op.Lease)
+		}
+		if err != nil {
+			return c.errorReply(err)
+		}
+		return nil
+	}
+
+	return respStatus("OK")
+}
+
+// mset writes all the keys in one transaction, their expire times are cleared.
+func (c *redisConn) mset(args []string) interface{} {
+	if len(args)%2 != 1 {
+		return respError("ERR wrong number of arguments for 'mset' command")
+	}
+
+	ops := make([]store.TxnOp, 0, len(args)/2)
+	for i := 1; i < len(args); i += 2 {
+		ops = append(ops, store.TxnOp{
+			Operation: "SET",
+			Key:       args[i],
+			Value:     args[i+1],
+		})
+	}
+
+	if _, err := c.server.node.Txn(c.ctx, &store.Txn{Success: ops}); err != nil {
+		return c.errorReply(err)
+	}
+	return respStatus("OK")
+}
+
+func (c *redisConn) del(args []string) interface{} {
+	ops := make([]store.TxnOp, 0, len(args)-1)
+	for _, key := range args[1:] {
+		ops = append(ops, store.TxnOp{Operation: "DELETE", Key: key})
+	}
+
+	resp, err := c.server.node.Txn(c.ctx, &store.Txn{Success: ops})
+	if err != nil {
+		return c.errorReply(err)
+	}
+
+	var count int64
+	for _, result := range resp.Results {
+		if result.Found {
+			count++
+		}
+	}
+	return count
+}
+
+func (c *redisConn) incr(args []string) interface{} {
+	return c.add(args[1], 1)
+}
+
+func (c *redisConn) decr(args []string) interface{} {
+	return c.add(args[1], -1)
+}
+
+func (c *redisConn) incrBy(args []string) interface{} {
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return respErrNotInteger
+	}
+	return c.add(args[1], delta)
+}
+
+func (c *redisConn) decrBy(args []string) interface{} {
+	delta, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil || delta == math.MinInt64 {
+		return respErrNotInteger
+	}
+	return c.add(args[1], -delta)
+}
+
+// add increments the integer stored under the key, missing keys start
+// from zero. The key keeps its expire time.
+func (c *redisConn) add(key string, delta int64) interface{} {
+	return c.update(key, func(value interface{}, found bool) (*store.TxnOp, interface{}) {
+		var n int64
+		if found {
+			var ok bool
+			if n, ok = respInteger(value); !ok {
+				return nil, respErrNotInteger
+			}
+		}
+		if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+			return nil, respErrOverflow
+		}
+
+		n += delta
+		return &store.TxnOp{
+			Operation: "SET",
+			Key:       key,
+			Value:     strconv.FormatInt(n, 10),
+			KeepLease: true,
+		}, n
+	})
+}
+
+func (c *redisConn) expire(args []string) interface{} {
+	ttl, ok := parseTTL(args[2], time.Second)
+	if !ok {
+		return respErrNotInteger
+	}
+	return c.expireIn(args[1], ttl)
+}
+
+func (c *redisConn) pexpire(args []string) interface{} {
+	ttl, ok := parseTTL(args[2], time.Millisecond)
+	if !ok {
+		return respErrNotInteger
+	}
+	return c.expireIn(args[1], ttl)
+}
+
+// expireIn attaches the key to a new lease, expire
+// times which already passed delete the key.
+func (c *redisConn) expireIn(key string, ttl time.Duration) interface{} {
+	if ttl <= 0 {
+		return c.del([]string{"DEL", key})
+	}
+
+	node := c.server.node
+	lease, err := node.Grant(c.ctx, leaseTTL(ttl), userName(c.user))
+	if err != nil {
+		return c.errorReply(err)
+	}
+
+	reply := c.update(key, func(value interface{}, found bool) (*store.TxnOp, interface{}) {
+		if !found {
+			return nil, int64(0)
+		}
+		return &store.TxnOp{
+			Operation: "SET",
+			Key:       key,
+			Value:     value,
+			Lease:     lease.ID,
+		}, int64(1)
+	})
+	if reply != int64(1) {
+		node.Revoke(c.ctx, lease.ID)
+	}
+	return reply
+}
+
+func (c *redisConn) ttl(args []string) interface{} {
+	return c.timeToLive(args[1], time.Second)
+}
+
+func (c *redisConn) pttl(args []string) interface{} {
+	return c.timeToLive(args[1], time.Millisecond)
+}
+
+// timeToLive replies -2 for missing keys and -1 for keys without expire time.
+func (c *redisConn) timeToLive(key string, unit time.Duration) interface{} {
+	ttl, leased, err := c.server.node.TimeToLive(key)
+	switch {
+	case err == store.ErrKeyNotFound:
+		return int64(-2)
+	case err != nil:
+		return c.errorReply(err)
+	case !leased:
+		return int64(-1)
+	}
+	return int64((ttl + unit/2) / unit)
+}
+
+// globMatch reports whether the key matches the glob-style pattern of
+// Redis: * and ? wildcards, [...] classes with ^ and ranges, \ escapes.
+func globMatch(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if globMatch(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+
+			pattern = pattern[1:]
+			negate := len(pattern) > 0 && pattern[0] == '^'
+			if negate {
+				pattern = pattern[1:]
+			}
+
+			matched := false
+			for len(pattern) > 0 && pattern[0] != ']' {
+				switch {
+				case pattern[0] == '\\' && len(pattern) > 1:
+					matched = matched || pattern[1] == s[0]
+					pattern = pattern[2:]
+				case len(pattern) > 2 && pattern[1] == '-' && pattern[2] != ']':
+					lo, hi := pattern[0], pattern[2]
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+					matched = matched || (s[0] >= lo && s[0] <= hi)
+					pattern = pattern[3:]
+				default:
+					matched = matched || pattern[0] == s[0]
+					pattern = pattern[1:]
+				}
+			}
+			if matched == negate {
+				return false
+			}
+			if len(pattern) == 0 {
+				// unterminated class, nothing is left to match
+				return len(s) == 1
+			}
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+
+		pattern, s = pattern[1:], s[1:]
+	}
+
+	return len(s) == 0
+}
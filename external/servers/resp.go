@@ -0,0 +1,221 @@
+package servers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+)
+
+// Replies of the RESP server besides the plain Go values: string is sent
+// as a bulk string, int64 as an integer, nil as null and slices as arrays.
+type (
+	// respStatus is sent as a simple string.
+	respStatus string
+	// respError is sent as an error, it starts with the error code.
+	respError string
+	// respMap holds the keys and values of a map one after another,
+	// RESP2 clients get it as a flat array.
+	respMap []interface{}
+	// respRaw is a reply encoded by another server, it's sent as is.
+	respRaw []byte
+)
+
+// respProtocolError is returned for malformed requests,
+// the connection is closed after reporting it.
+type respProtocolError string
+
+func (e respProtocolError) Error() string {
+	return "Protocol error: " + string(e)
+}
+
+// readLine returns the next line without the trailing CRLF.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	switch {
+	case err == bufio.ErrBufferFull:
+		return "", respProtocolError("too big inline request")
+	case err != nil:
+		return "", err
+	}
+
+	return strings.TrimSuffix(string(line[:len(line)-1]), "\r"), nil
+}
+
+func parseLength(line string, max int) (int, error) {
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n > max {
+		return 0, respProtocolError(fmt.Sprintf("invalid length %q", line[1:]))
+	}
+	return n, nil
+}
+
+// readCommand reads a command sent either as an array
+// of bulk strings or as a single inline line.
+func readCommand(r *bufio.Reader) (args []string, err error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := parseLength(line, consts.RESPMaxArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	args = make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		if line, err = readLine(r); err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, respProtocolError(fmt.Sprintf("expected '$', got %q", line))
+		}
+
+		var size int
+		if size, err = parseLength(line, consts.RESPMaxBulkSize); err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, respProtocolError("invalid bulk length")
+		}
+
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if buf[size] != '\r' || buf[size+1] != '\n' {
+			return nil, respProtocolError("bulk string is not terminated by CRLF")
+		}
+		args = append(args, string(buf[:size]))
+	}
+
+	return args, nil
+}
+
+// readReply reads one complete reply and returns it still encoded.
+func readReply(r *bufio.Reader) ([]byte, error) {
+	return appendReply(nil, r)
+}
+
+func appendReply(buf []byte, r *bufio.Reader) ([]byte, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, respProtocolError("empty reply")
+	}
+	buf = append(append(buf, line...), '\r', '\n')
+
+	var (
+		n     int
+		items = 1
+	)
+	switch line[0] {
+	case '$', '=', '!':
+		if n, err = parseLength(line, consts.RESPMaxBulkSize); err != nil || n < 0 {
+			return buf, err
+		}
+
+		data := make([]byte, n+2)
+		if _, err = io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return append(buf, data...), nil
+	case '%':
+		items = 2
+	case '|':
+		// attributes are followed by the reply they describe
+		if buf, err = appendItems(buf, r, line, 2); err != nil {
+			return nil, err
+		}
+		return appendReply(buf, r)
+	case '*', '~', '>':
+	default:
+		return buf, nil
+	}
+
+	return appendItems(buf, r, line, items)
+}
+
+func appendItems(buf []byte, r *bufio.Reader, line string, items int) ([]byte, error) {
+	n, err := parseLength(line, consts.RESPMaxArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < n*items; i++ {
+		if buf, err = appendReply(buf, r); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// writeCommand sends the command as an array of bulk strings.
+func writeCommand(w *bufio.Writer, args []string) error {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return w.Flush()
+}
+
+// writeReply encodes the reply for the protocol version
+// the client negotiated with HELLO.
+func writeReply(w *bufio.Writer, proto int, reply interface{}) (err error) {
+	switch v := reply.(type) {
+	case nil:
+		if proto >= 3 {
+			_, err = w.WriteString("_\r\n")
+		} else {
+			_, err = w.WriteString("$-1\r\n")
+		}
+	case respStatus:
+		_, err = fmt.Fprintf(w, "+%s\r\n", v)
+	case respError:
+		_, err = fmt.Fprintf(w, "-%s\r\n", v)
+	case respRaw:
+		_, err = w.Write(v)
+	case string:
+		_, err = fmt.Fprintf(w, "$%d\r\n%s\r\n", len(v), v)
+	case int64:
+		_, err = fmt.Fprintf(w, ":%d\r\n", v)
+	case []string:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			if err = writeReply(w, proto, item); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		fmt.Fprintf(w, "*%d\r\n", len(v))
+		for _, item := range v {
+			if err = writeReply(w, proto, item); err != nil {
+				return err
+			}
+		}
+	case respMap:
+		if proto >= 3 {
+			fmt.Fprintf(w, "%%%d\r\n", len(v)/2)
+		} else {
+			fmt.Fprintf(w, "*%d\r\n", len(v))
+		}
+		for _, item := range v {
+			if err = writeReply(w, proto, item); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported RESP reply %T", reply)
+	}
+
+	return err
+}
@@ -1,5 +1,268 @@
 package servers
 
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+
+	"github.com/alex60217101990/nietzsche/external/logger"
+	"github.com/alex60217101990/nietzsche/external/metrics"
+	"github.com/alex60217101990/nietzsche/external/store"
+
+	"github.com/hashicorp/raft"
+)
+
+// Server is the HTTP API of the node.
 type Server struct {
-	//...
-}
\ No newline at end of file
+	node   *RaftNode
+	router *http.ServeMux
+	server *http.Server
+
+	// closed on shutdown to end the streaming responses,
+	// which would otherwise keep their connections busy
+	closeCh chan struct{}
+}
+
+func NewServer(node *RaftNode) *Server {
+	s := &Server{
+		node:    node,
+		router:  http.NewServeMux(),
+		closeCh: make(chan struct{}),
+	}
+	s.routes()
+
+	s.server = &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", node.config().Server.Host, node.config().Server.Port),
+		Handler: s.identify(s.authenticate(s.router)),
+	}
+
+	return s
+}
+
+func (s *Server) routes() {
+	s.router.HandleFunc("/v1/members", s.require(s.node.AuthorizeRoot, s.handleMembers))
+	s.router.HandleFunc("/v1/members/", s.require(s.node.AuthorizeRoot, s.handleMember))
+	s.router.HandleFunc("/v1/join", s.handleJoin)
+	s.router.HandleFunc("/v1/leader/transfer", s.require(s.node.AuthorizeRoot, s.handleLeaderTransfer))
+	s.router.HandleFunc("/v1/kv", s.handleScan)
+	s.router.HandleFunc("/v1/kv/", s.handleKV)
+	s.router.HandleFunc("/v1/txn", s.handleTxn)
+	s.router.HandleFunc("/v1/watch", s.handleWatch)
+	s.router.HandleFunc("/v1/lease", s.require(s.node.AuthorizeLeases, s.handleLeases))
+	s.router.HandleFunc("/v1/lease/", s.require(s.node.AuthorizeLeases, s.handleLease))
+	s.router.HandleFunc("/v1/snapshot", s.require(s.node.AuthorizeRoot, s.handleSnapshot))
+	s.router.HandleFunc("/v1/autopilot/health", s.require(s.node.AuthorizeRoot, s.handleAutopilotHealth))
+	s.router.HandleFunc("/v1/encryption", s.require(s.node.AuthorizeRoot, s.handleEncryption))
+	s.router.HandleFunc("/v1/encryption/rotate", s.require(s.node.AuthorizeRoot, s.handleKeyRotation))
+	s.router.HandleFunc("/v1/config", s.require(s.node.AuthorizeRoot, s.handleConfig))
+	s.router.Handle("/metrics", metrics.AppMetrics.Handler())
+	s.router.HandleFunc("/health/live", s.handleLive)
+	s.router.HandleFunc("/health/ready", s.handleReady)
+	s.router.HandleFunc("/v1/status", s.handleStatus)
+	s.router.HandleFunc("/v1/auth/token", s.handleToken)
+	s.router.HandleFunc("/v1/auth/users", s.require(s.node.AuthorizeRoot, s.handleUsers))
+	s.router.HandleFunc("/v1/auth/users/", s.require(s.node.AuthorizeRoot, s.handleUser))
+	s.router.HandleFunc("/v1/auth/roles", s.require(s.node.AuthorizeRoot, s.handleRoles))
+	s.router.HandleFunc("/v1/auth/roles/", s.require(s.node.AuthorizeRoot, s.handleRole))
+}
+
+// publicPaths are served to anonymous users while auth is enabled,
+// the join requests are authenticated by the join token.
+var publicPaths = map[string]bool{
+	"/health/live":  true,
+	"/health/ready": true,
+	"/metrics":      true,
+	"/v1/join":      true,
+}
+
+const (
+	// requestIDHeader carries the ID of the request, it's sent back
+	// to the client and passed on when the request is forwarded.
+	requestIDHeader = "X-Request-ID"
+	// joinTokenHeader carries the join token of a joining server.
+	joinTokenHeader = "X-Join-Token"
+)
+
+// identify gives the request its ID, the one sent by the client or a new one.
+func (s *Server) identify(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := s.node.requestContext(r.Context(), r.Header.Get(requestIDHeader))
+		id := logger.RequestID(ctx)
+		r.Header.Set(requestIDHeader, id)
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate resolves the user of the request from its "Authorization"
+// header, every other path than the public ones requires a user.
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !s.node.authEnabled() || publicPaths[r.URL.Path] {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, err := s.node.Authenticate(r.Header.Get("Authorization"))
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="nietzsche"`)
+			s.writeError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withUser(r.Context(), user)))
+	})
+}
+
+// require restricts the handler to the users passing the check.
+func (s *Server) require(check func(user *User) error, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := check(userFrom(r.Context())); err != nil {
+			s.writeError(w, err)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// authorize checks the access of the user to the key
+// and answers the request when it's denied.
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, key, access string) bool {
+	if err := s.node.Authorize(userFrom(r.Context()), key, access); err != nil {
+		s.writeError(w, err)
+		return false
+	}
+	return true
+}
+
+func (s *Server) Start() error {
+	listener, err := net.Listen("tcp", s.server.Addr)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.node.log.Error(err)
+		}
+	}()
+
+	return nil
+}
+
+func (s *Server) Close() error {
+	ctx := context.Background()
+	if timeout := s.node.config().Timeouts.Timeout(); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	close(s.closeCh)
+	return s.server.Shutdown(ctx)
+}
+
+// forwardedHeader marks requests proxied to the leader, so they
+// are not forwarded again while the leadership is changing.
+const forwardedHeader = "X-Nietzsche-Forwarded"
+
+// forward proxies the request to the leader. It returns false
+// when the request has to be served by the local node.
+func (s *Server) forward(w http.ResponseWriter, r *http.Request) bool {
+	if s.node.IsLeader() {
+		return false
+	}
+
+	if len(r.Header.Get(forwardedHeader)) > 0 {
+		s.writeError(w, raft.ErrNotLeader)
+		return true
+	}
+
+	address, err := s.node.LeaderAPIAddr()
+	if err != nil {
+		s.writeError(w, err)
+		return true
+	}
+
+	r.Header.Set(forwardedHeader, s.node.config().Raft.NodeID)
+	// the leader sends the request ID back
+	w.Header().Del(requestIDHeader)
+	httputil.NewSingleHostReverseProxy(&url.URL{
+		Scheme: "http",
+		Host:   address,
+	}).ServeHTTP(w, r)
+
+	return true
+}
+
+type errorResponse struct {
+	Error  string `json:"error"`
+	Leader string `json:"leader,omitempty"`
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if body == nil {
+		return
+	}
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		s.node.log.Errorf(err.Error(),
+			map[string]interface{}{
+				"http-server": "write-response",
+			})
+	}
+}
+
+// errorStatus maps the errors of the node to HTTP statuses.
+func errorStatus(err error) int {
+	switch err {
+	case raft.ErrNotLeader:
+		return http.StatusMisdirectedRequest
+	case ErrLastVoter, ErrQuorumLoss:
+		return http.StatusPreconditionFailed
+	case store.ErrRotationRunning:
+		return http.StatusConflict
+	case ErrUnauthenticated, ErrBadCredentials:
+		return http.StatusUnauthorized
+	case ErrPermissionDenied, ErrRootImmutable:
+		return http.StatusForbidden
+	case ErrUnknownServer, ErrAutopilotDisabled, store.ErrKeyNotFound, store.ErrLeaseNotFound,
+		ErrUnknownUser, ErrUnknownRole:
+		return http.StatusNotFound
+	case ErrEmptyServer, ErrNotVoter, ErrEmptyKey, ErrSystemKey, ErrEmptySnapshot, ErrInvalidTTL,
+		store.ErrInvalidOperation, store.ErrInvalidCompare,
+		ErrAuthDisabled, ErrInvalidName, ErrEmptyPassword, ErrInvalidAccess,
+		store.ErrEncryptionDisabled, store.ErrUnknownDataKey, store.ErrCorruptedEnvelope:
+		return http.StatusBadRequest
+	case errNodeNotStarted, ErrNoLeader, raft.ErrRaftShutdown, raft.ErrLeadershipLost, raft.ErrEnqueueTimeout:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func (s *Server) writeError(w http.ResponseWriter, err error) {
+	resp := errorResponse{
+		Error: err.Error(),
+	}
+
+	status := errorStatus(err)
+	if status == http.StatusMisdirectedRequest && s.node.Raft() != nil {
+		resp.Leader = string(s.node.Raft().Leader())
+	}
+
+	s.writeJSON(w, status, resp)
+}
+
+func (s *Server) methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	for _, method := range allowed {
+		w.Header().Add("Allow", method)
+	}
+	s.writeJSON(w, http.StatusMethodNotAllowed, errorResponse{
+		Error: http.StatusText(http.StatusMethodNotAllowed),
+	})
+}
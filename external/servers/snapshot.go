@@ -0,0 +1,60 @@
+package servers
+
+import (
+	"io"
+
+	"github.com/alex60217101990/nietzsche/external/store"
+
+	"github.com/hashicorp/raft"
+)
+
+var (
+	ErrEmptySnapshot = store.ErrEmptySnapshot
+)
+
+// Backup writes a copy of the local store, it can be
+// loaded back into the cluster with RestoreSnapshot.
+func (n *RaftNode) Backup(w io.Writer) error {
+	if n.raft == nil {
+		return errNodeNotStarted
+	}
+
+	return n.fsm.Backup(w)
+}
+
+// RestoreSnapshot replaces the state of the whole cluster with the backup
+// of the given size. It must run on the leader, followers receive the data
+// with the next snapshot installation. The backup is verified first, it's
+// read twice.
+func (n *RaftNode) RestoreSnapshot(r io.ReadSeeker, size int64) error {
+	if n.raft == nil {
+		return errNodeNotStarted
+	}
+	if size <= 0 {
+		return ErrEmptySnapshot
+	}
+
+	if err := n.fsm.VerifyBackup(r); err != nil {
+		return err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return n.raft.Restore(&raft.SnapshotMeta{
+		Version: raft.SnapshotVersionMax,
+		Size:    size,
+	}, r, n.config().Timeouts.Timeout())
+}
+
+// RotateKeys re-encrypts the local store with the active key of the
+// keyfile in the background, every server rotates its own copy.
+func (n *RaftNode) RotateKeys() error {
+	return n.fsm.RotateKeys()
+}
+
+// EncryptionStatus reports the keys of the local store
+// and the progress of their rotation.
+func (n *RaftNode) EncryptionStatus() store.EncryptionStatus {
+	return n.fsm.EncryptionStatus()
+}
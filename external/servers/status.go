@@ -0,0 +1,86 @@
+package servers
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Status describes the node and its view of the cluster.
+type Status struct {
+	NodeID            string       `json:"node_id"`
+	State             string       `json:"state"`
+	LeaderID          string       `json:"leader_id,omitempty"`
+	LeaderAddress     string       `json:"leader_address,omitempty"`
+	LeaderAPIAddress  string       `json:"leader_api_address,omitempty"`
+	Term              uint64       `json:"term"`
+	LastLogIndex      uint64       `json:"last_log_index"`
+	LastLogTerm       uint64       `json:"last_log_term"`
+	CommitIndex       uint64       `json:"commit_index"`
+	AppliedIndex      uint64       `json:"applied_index"`
+	FSMPending        uint64       `json:"fsm_pending"`
+	LastContact       string       `json:"last_contact"`
+	LastSnapshotIndex uint64       `json:"last_snapshot_index"`
+	LastSnapshotTerm  uint64       `json:"last_snapshot_term"`
+	Peers             []ServerInfo `json:"peers"`
+}
+
+func parseStat(stats map[string]string, key string) uint64 {
+	value, _ := strconv.ParseUint(stats[key], 10, 64)
+	return value
+}
+
+// Status collects the raft stats of the node.
+func (n *RaftNode) Status() (*Status, error) {
+	membership, err := n.Members()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := n.raft.Stats()
+	status := &Status{
+		NodeID:            n.config().Raft.NodeID,
+		State:             stats["state"],
+		LeaderAddress:     string(n.raft.Leader()),
+		Term:              parseStat(stats, "term"),
+		LastLogIndex:      parseStat(stats, "last_log_index"),
+		LastLogTerm:       parseStat(stats, "last_log_term"),
+		CommitIndex:       parseStat(stats, "commit_index"),
+		AppliedIndex:      parseStat(stats, "applied_index"),
+		FSMPending:        parseStat(stats, "fsm_pending"),
+		LastContact:       stats["last_contact"],
+		LastSnapshotIndex: parseStat(stats, "last_snapshot_index"),
+		LastSnapshotTerm:  parseStat(stats, "last_snapshot_term"),
+		Peers:             membership.Servers,
+	}
+	for _, server := range membership.Servers {
+		if server.Leader {
+			status.LeaderID = server.ID
+		}
+	}
+	if address, err := n.LeaderAPIAddr(); err == nil {
+		status.LeaderAPIAddress = address
+	}
+
+	return status, nil
+}
+
+// Ready reports why the node can't serve requests yet: the leader is
+// unknown, the store lags behind the committed log or it's not open.
+func (n *RaftNode) Ready() error {
+	if n.raft == nil {
+		return errNodeNotStarted
+	}
+
+	if len(n.raft.Leader()) == 0 {
+		return ErrNoLeader
+	}
+
+	maxLag := n.config().Server.ReadyMaxLag
+	stats := n.raft.Stats()
+	commitIndex, appliedIndex := parseStat(stats, "commit_index"), parseStat(stats, "applied_index")
+	if commitIndex > appliedIndex+maxLag {
+		return fmt.Errorf("applied index %d lags behind commit index %d", appliedIndex, commitIndex)
+	}
+
+	return n.fsm.Ping()
+}
@@ -0,0 +1,113 @@
+package servers
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/logger"
+)
+
+// tcpServer accepts the connections of the frontends speaking their own
+// protocol over TCP, each connection is served by its own goroutine.
+type tcpServer struct {
+	name     string
+	addr     string
+	log      logger.Logger
+	listener net.Listener
+	started  time.Time
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	wg    sync.WaitGroup
+
+	// closed on shutdown to stop accepting connections
+	closeCh chan struct{}
+}
+
+func newTCPServer(name, addr string, log logger.Logger) *tcpServer {
+	return &tcpServer{
+		name:    name,
+		addr:    addr,
+		log:     log,
+		conns:   make(map[net.Conn]struct{}),
+		closeCh: make(chan struct{}),
+	}
+}
+
+func (s *tcpServer) start(serve func(conn net.Conn)) (err error) {
+	if s.listener, err = net.Listen("tcp", s.addr); err != nil {
+		return err
+	}
+	s.started = time.Now()
+
+	go s.accept(serve)
+	return nil
+}
+
+func (s *tcpServer) accept(serve func(conn net.Conn)) {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			select {
+			case <-s.closeCh:
+				return
+			default:
+			}
+
+			s.log.Errorf(err.Error(),
+				map[string]interface{}{
+					s.name: "accept",
+				})
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		s.mu.Lock()
+		select {
+		case <-s.closeCh:
+			// accepted while the server was closing
+			s.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+
+		go func() {
+			defer s.wg.Done()
+			serve(conn)
+			conn.Close()
+
+			s.mu.Lock()
+			delete(s.conns, conn)
+			s.mu.Unlock()
+		}()
+	}
+}
+
+// clients returns the number of open connections.
+func (s *tcpServer) clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.conns)
+}
+
+// close stops accepting connections and waits
+// until the open ones are closed.
+func (s *tcpServer) close() error {
+	close(s.closeCh)
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
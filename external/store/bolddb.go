@@ -1,119 +1,373 @@
 package store
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/gob"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	ap "github.com/alex60217101990/nietzsche/external/alloc-pool"
 	"github.com/alex60217101990/nietzsche/external/configs"
-	"github.com/alex60217101990/nietzsche/external/helpers"
+	"github.com/alex60217101990/nietzsche/external/consts"
 	"github.com/alex60217101990/nietzsche/external/logger"
+	"github.com/alex60217101990/nietzsche/external/metrics"
 
 	"github.com/boltdb/bolt"
 	"github.com/hashicorp/raft"
 	"github.com/valyala/gozstd"
+	"golang.org/x/sync/errgroup"
 )
 
+var (
+	ErrKeyNotFound   = errors.New("key not found")
+	ErrEmptySnapshot = errors.New("snapshot is empty")
+)
+
+// zstdMagic starts the zstd frames, gob streams and bolt files never start
+// with it, so the data is read whether the compression was enabled or not
+// when it was written.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+var (
+	applyLatency = metrics.AppMetrics.Histogram("store_apply_seconds",
+		"Time to apply a committed command to the store, by operation.", metrics.LatencyBuckets, "op")
+	compressionRatio = metrics.AppMetrics.Histogram("store_compression_ratio",
+		"Compressed to encoded size ratio of the stored values.", []float64{.1, .2, .3, .4, .5, .6, .7, .8, .9, 1, 1.25})
+	snapshotLatency = metrics.AppMetrics.Histogram("raft_snapshot_seconds",
+		"Time to persist or restore a snapshot of the store.", metrics.LatencyBuckets, "phase")
+)
+
+func init() {
+	// composite values decoded from JSON payloads
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
 type BoldDBStore struct {
+	conf *configs.Live
+	log  logger.Logger
+	// data file, a restored snapshot is renamed to it
+	path string
+
+	// mu guards the db handle, which is replaced on snapshot restore
+	mu          sync.RWMutex
 	db          *bolt.DB
 	pool        ap.Pool
 	buffersPool ap.BufferPool
+	watchers    *watchHub
+	// nil when the encryption at rest is disabled
+	crypt *encryption
 }
 
-func NewBoldDBStore() Store {
-	// Open the [some name].db data file in your current directory.
-	// It will be created if it doesn't exist.
-	db, err := bolt.Open(fmt.Sprintf("%s.db", configs.Conf.Store.DbName), 0600,
-		&bolt.Options{Timeout: helpers.TimeoutSecond(
-			configs.Conf.Timeouts.DefaultStoreTimeout,
-		)})
+// NewBoldDBStore opens the data file of the store section, it's created
+// when it doesn't exist yet.
+func NewBoldDBStore(live *configs.Live, log logger.Logger) (_ Store, err error) {
+	b := &BoldDBStore{
+		conf:        live,
+		log:         log,
+		pool:        new(ap.UnlimitPool).InitPool(),
+		buffersPool: new(ap.UnlimitPoolBuffer).InitPool(),
+		watchers:    newWatchHub(),
+	}
+
+	conf := live.Load()
+	if conf.Encryption != nil {
+		if b.crypt, err = newEncryption(conf.Encryption.KeyFile); err != nil {
+			return nil, err
+		}
+	}
+
+	b.path = fmt.Sprintf("%s.db", conf.Store.DbName)
+	b.db, err = bolt.Open(b.path, 0600,
+		&bolt.Options{Timeout: conf.Timeouts.StoreTimeout()})
 	if err != nil {
-		logger.AppLogger.Fatal(err)
+		return nil, err
 	}
 
-	return &BoldDBStore{
-		db:          db,
-		pool:        new(ap.UnlimitPool).InitPool(),
-		buffersPool: new(ap.UnlimitPoolBuffer).InitPool(),
+	err = b.db.Update(func(tx *bolt.Tx) (err error) {
+		_, err = tx.CreateBucketIfNotExists(b.bucketName())
+		return err
+	})
+	if err != nil {
+		b.db.Close()
+		return nil, err
 	}
+
+	b.registerMetrics()
+
+	return b, nil
 }
 
-func (b *BoldDBStore) SetDumpWriter(w io.WriteCloser) {
+// config returns the running configuration of the store.
+func (b *BoldDBStore) config() *configs.Configs {
+	return b.conf.Load()
+}
 
+func (b *BoldDBStore) bucketName() []byte {
+	return []byte(b.config().Store.BucketName)
 }
 
-func (b BoldDBStore) Close() error {
+// registerMetrics exports the size of the data file and the bolt transaction stats.
+func (b *BoldDBStore) registerMetrics() {
+	stats := func(fn func(bolt.Stats) float64) func() float64 {
+		return func() float64 {
+			b.mu.RLock()
+			defer b.mu.RUnlock()
+
+			return fn(b.db.Stats())
+		}
+	}
+
+	metrics.AppMetrics.GaugeFunc("store_db_size_bytes", "Size of the bolt data file.", func() (size float64) {
+		b.mu.RLock()
+		defer b.mu.RUnlock()
+
+		_ = b.db.View(func(tx *bolt.Tx) error {
+			size = float64(tx.Size())
+			return nil
+		})
+		return size
+	})
+	metrics.AppMetrics.GaugeFunc("store_tx_total", "Read transactions started on the bolt file.",
+		stats(func(s bolt.Stats) float64 { return float64(s.TxN) }))
+	metrics.AppMetrics.GaugeFunc("store_open_tx", "Currently open read transactions.",
+		stats(func(s bolt.Stats) float64 { return float64(s.OpenTxN) }))
+	metrics.AppMetrics.GaugeFunc("store_free_pages", "Free pages of the bolt file.",
+		stats(func(s bolt.Stats) float64 { return float64(s.FreePageN) }))
+	metrics.AppMetrics.GaugeFunc("store_tx_write_seconds_total", "Time spent writing to disk by transactions.",
+		stats(func(s bolt.Stats) float64 { return s.TxStats.WriteTime.Seconds() }))
+}
+
+func (b *BoldDBStore) Close() error {
+	b.watchers.closeAll()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
 	return b.db.Close()
 }
 
-// get fetch data from boldDB
-func (b *BoldDBStore) get(key string) (data interface{}, err error) {
+func (b *BoldDBStore) Ping() error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.db.View(func(tx *bolt.Tx) error {
+		return nil
+	})
+}
+
+// Scan reads the entries from the local copy of the data in key order,
+// a limit of zero returns all of them.
+func (b *BoldDBStore) Scan(prefix string, limit int, skip func(key string) bool) (entries []KeyValue, err error) {
 	pbuf := b.buffersPool.GetBuffer()
-	defer func() {
-		b.buffersPool.PutBuffer(pbuf)
+	defer b.buffersPool.PutBuffer(pbuf)
 
-		if err != nil || (err == nil && data == nil) {
-			data = map[string]interface{}{}
-		}
-	}()
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 
+	entries = make([]KeyValue, 0)
 	err = b.db.View(func(tx *bolt.Tx) (err error) {
-		bucket := tx.Bucket([]byte(configs.Conf.Store.BucketName))
+		c := tx.Bucket(b.bucketName()).Cursor()
+		for k, v := c.Seek([]byte(prefix)); k != nil && bytes.HasPrefix(k, []byte(prefix)); k, v = c.Next() {
+			if skip != nil && skip(string(k)) {
+				continue
+			}
+			if limit > 0 && len(entries) >= limit {
+				return nil
+			}
 
-		if configs.Conf.Store.UseStreamDataCompression {
-			err = gozstd.StreamDecompress(pbuf, bytes.NewReader(bucket.Get([]byte(key))))
-		} else {
-			_, err = pbuf.Read(bucket.Get([]byte(key)))
+			pbuf.Reset()
+			var data interface{}
+			if data, err = b.decode(pbuf, k, v); err != nil {
+				return err
+			}
+			entries = append(entries, KeyValue{
+				Key:   string(k),
+				Value: data,
+			})
 		}
+		return nil
+	})
+
+	return entries, err
+}
+
+// Watch sends the changes of the keys starting with the prefix until
+// cancel is called. The channel is closed when the watcher falls behind
+// or the store is restored from a snapshot.
+func (b *BoldDBStore) Watch(prefix string, skip func(key string) bool) (events <-chan Event, cancel func()) {
+	return b.watchers.subscribe(prefix, skip)
+}
+
+// Leases lists the granted leases.
+func (b *BoldDBStore) Leases() (leases []Lease, err error) {
+	pbuf := b.buffersPool.GetBuffer()
+	defer b.buffersPool.PutBuffer(pbuf)
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	leases = make([]Lease, 0)
+	err = b.db.View(func(tx *bolt.Tx) error {
+		preffix := []byte(consts.LeasesKeyPreffix)
+		bucket := tx.Bucket(b.bucketName())
+		c := bucket.Cursor()
+		for k, v := c.Seek(preffix); k != nil && bytes.HasPrefix(k, preffix); k, v = c.Next() {
+			id, err := strconv.ParseUint(string(k[len(preffix):]), 10, 64)
+			if err != nil {
+				return err
+			}
+
+			pbuf.Reset()
+			ttl, err := b.decode(pbuf, k, v)
+			if err != nil {
+				return err
+			}
+			ttlSeconds, _ := ttl.(int64)
+
+			leases = append(leases, Lease{
+				ID:    id,
+				TTL:   ttlSeconds,
+				Owner: string(bucket.Get([]byte(leaseOwnerKey(id)))),
+			})
+		}
+		return nil
+	})
+
+	return leases, err
+}
+
+// LeaseOf returns the lease the key is attached to, zero when there is none.
+func (b *BoldDBStore) LeaseOf(key string) (id uint64, err error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 
+	err = b.db.View(func(tx *bolt.Tx) (err error) {
+		value := tx.Bucket(b.bucketName()).Get([]byte(consts.KeyLeasesKeyPreffix + key))
+		if value == nil {
+			return nil
+		}
+
+		id, err = strconv.ParseUint(string(value), 10, 64)
 		return err
 	})
 
-	if err != nil {
-		return data, err
+	return id, err
+}
+
+// Backup writes the bolt file, compressed when the store compresses
+// its data and encrypted when the encryption at rest is enabled.
+func (b *BoldDBStore) Backup(w io.Writer) (err error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return b.db.View(func(tx *bolt.Tx) error {
+		return b.writeTx(tx, w)
+	})
+}
+
+// writeTx writes the bolt file as seen by the read transaction
+// in the format of Backup.
+func (b *BoldDBStore) writeTx(tx *bolt.Tx, w io.Writer) (err error) {
+	if keys := b.crypt.keyring(); keys != nil {
+		ew, werr := keys.encryptStream(w)
+		if werr != nil {
+			return werr
+		}
+		defer func() {
+			if cerr := ew.Close(); err == nil {
+				err = cerr
+			}
+		}()
+		w = ew
 	}
 
-	if pbuf.Len() > 0 {
-		err = gob.NewDecoder(pbuf).Decode(&data)
+	if !b.config().Store.UseStreamDataCompression {
+		_, err = tx.WriteTo(w)
+		return err
 	}
 
-	return data, err
+	r, pw := io.Pipe()
+	eg := new(errgroup.Group)
+	eg.Go(func() (err error) {
+		_, err = tx.WriteTo(pw)
+		pw.CloseWithError(err)
+		return err
+	})
+	eg.Go(func() error {
+		return gozstd.StreamCompressLevel(w, r, 30)
+	})
+
+	return eg.Wait()
+}
+
+// Get reads the key from the local copy of the data,
+// on followers it may lag behind the leader.
+func (b *BoldDBStore) Get(key string) (data interface{}, err error) {
+	return b.get(key)
 }
 
-// set store data to boldDB
-func (b *BoldDBStore) set(key string, value interface{}) (err error) {
+// get fetch data from boldDB
+func (b *BoldDBStore) get(key string) (data interface{}, err error) {
 	pbuf := b.buffersPool.GetBuffer()
-	bbuf := b.pool.GetBytes()
 	defer func() {
-		b.pool.PutBytes(bbuf)
 		b.buffersPool.PutBuffer(pbuf)
+
+		if err != nil || (err == nil && data == nil) {
+			data = map[string]interface{}{}
+		}
 	}()
 
-	err = gob.NewEncoder(pbuf).Encode(value)
-	if err != nil {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	err = b.db.View(func(tx *bolt.Tx) (err error) {
+		value := tx.Bucket(b.bucketName()).Get([]byte(key))
+		if value == nil {
+			return ErrKeyNotFound
+		}
+
+		data, err = b.decode(pbuf, []byte(key), value)
 		return err
+	})
+
+	return data, err
+}
+
+// decode unpacks the stored value of the key using the buffer, the
+// value is only valid for the life of the transaction it comes from.
+func (b *BoldDBStore) decode(pbuf *bytes.Buffer, key, value []byte) (data interface{}, err error) {
+	if encryptedValue(value) {
+		if value, err = b.crypt.open(nil, string(key), value); err != nil {
+			return nil, err
+		}
 	}
 
-	if configs.Conf.Store.UseStreamDataCompression {
-		bbuf = gozstd.CompressLevel(bbuf[:0], pbuf.Bytes(), 30)
+	if bytes.HasPrefix(value, zstdMagic) {
+		err = gozstd.StreamDecompress(pbuf, bytes.NewReader(value))
 	} else {
-		bbuf = pbuf.Bytes()
+		_, err = pbuf.Write(value)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	return b.db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket([]byte(configs.Conf.Store.BucketName)).Put([]byte(key), bbuf)
-	})
-}
+	if pbuf.Len() > 0 {
+		err = gob.NewDecoder(pbuf).Decode(&data)
+	}
 
-// delete remove data from badgerDB
-func (b *BoldDBStore) delete(key string) error {
-	return b.db.Update(func(tx *bolt.Tx) error {
-		return tx.Bucket([]byte(configs.Conf.Store.BucketName)).Delete([]byte(key))
-	})
+	return data, err
 }
 
 // Apply log is invoked once a log entry is committed.
@@ -125,7 +379,7 @@ func (b *BoldDBStore) Apply(log *raft.Log) interface{} {
 	case raft.LogCommand:
 		var payload = CommandPayload{}
 		if err := json.Unmarshal(log.Data, &payload); err != nil {
-			logger.AppLogger.Errorf(
+			b.log.Errorf(
 				fmt.Sprintf("error marshalling store payload %s\n", err.Error()),
 				map[string]interface{}{
 					"raft": "apply",
@@ -137,29 +391,32 @@ func (b *BoldDBStore) Apply(log *raft.Log) interface{} {
 		}
 
 		op := strings.ToUpper(strings.TrimSpace(payload.Operation))
-		switch op {
-		case "SET":
-			return &ApplyResult{
-				Error: b.set(payload.Key, payload.Value),
-				Data:  payload.Value,
+		start := time.Now()
+		result := b.applyCommand(log.Index, op, &payload)
+		applyLatency.Observe(metrics.Since(start), strings.ToLower(op))
+
+		// the entries are built only when they're written,
+		// Apply is on the path of every write
+		if b.log.Enabled(logger.LevelDebug) {
+			fields := map[string]interface{}{
+				"raft":      "apply",
+				"operation": op,
+				"index":     log.Index,
 			}
-		case "GET":
-			data, err := b.get(payload.Key)
-			return &ApplyResult{
-				Error: err,
-				Data:  data,
+			if len(payload.Key) > 0 {
+				fields["key"] = payload.Key
 			}
-
-		case "DELETE":
-			return &ApplyResult{
-				Error: b.delete(payload.Key),
-				Data:  nil,
+			if result.Error != nil {
+				fields["error"] = result.Error.Error()
 			}
+			b.applyLogger(log, &payload).Debugf("command applied", fields)
 		}
+
+		return result
 	}
 
-	if configs.Conf.IsDebug {
-		logger.AppLogger.Warnf("not raft log command type",
+	if b.config().IsDebug {
+		b.log.Warnf("not raft log command type",
 			map[string]interface{}{
 				"raft": "apply",
 			})
@@ -168,10 +425,168 @@ func (b *BoldDBStore) Apply(log *raft.Log) interface{} {
 	return nil
 }
 
+// applyCommand runs the command of the log entry at the index.
+func (b *BoldDBStore) applyCommand(index uint64, op string, payload *CommandPayload) *ApplyResult {
+	switch op {
+	case "SET":
+		return &ApplyResult{
+			Error: b.update(index, func(t *storeTx) error {
+				return t.put(payload.Key, payload.Value, payload.Lease, 0)
+			}),
+			Data: payload.Value,
+		}
+	case "GET":
+		data, err := b.get(payload.Key)
+		return &ApplyResult{
+			Error: err,
+			Data:  data,
+		}
+
+	case "DELETE":
+		return &ApplyResult{
+			Error: b.update(index, func(t *storeTx) error {
+				return t.delete(payload.Key)
+			}),
+			Data: nil,
+		}
+	case "TXN":
+		var resp *TxnResponse
+		err := b.update(index, func(t *storeTx) (err error) {
+			resp, err = t.txn(payload.Txn)
+			return err
+		})
+		return &ApplyResult{
+			Error: err,
+			Data:  resp,
+		}
+	case "LEASE_GRANT":
+		var lease *Lease
+		err := b.update(index, func(t *storeTx) (err error) {
+			lease, err = t.grant(payload.TTL, payload.Owner)
+			return err
+		})
+		return &ApplyResult{
+			Error: err,
+			Data:  lease,
+		}
+	case "LEASE_REVOKE":
+		return &ApplyResult{
+			Error: b.update(index, func(t *storeTx) error {
+				return t.revoke(payload.Lease)
+			}),
+			Data: nil,
+		}
+	default:
+		return &ApplyResult{
+			Error: ErrInvalidOperation,
+			Data:  nil,
+		}
+	}
+}
+
+// applyLogger returns the logger of the log entry, it adds the node ID, the
+// term of the entry and the ID of the request the command comes from.
+func (b *BoldDBStore) applyLogger(log *raft.Log, payload *CommandPayload) logger.Logger {
+	ctx := logger.ContextWithTerm(context.Background(), log.Term)
+	ctx = logger.ContextWithNodeID(ctx, b.config().Raft.NodeID)
+	if id := payload.Metadata[MetadataRequestID]; len(id) > 0 {
+		ctx = logger.ContextWithRequestID(ctx, id)
+	}
+	return b.log.WithContext(ctx)
+}
+
 // Snapshot will be called during make snapshot.
-// Snapshot is used to support log compaction.
-// No need to call snapshot since it already persisted in disk (using BadgerDB) when raft calling Apply function.
+// Snapshot is used to support log compaction, it starts a read
+// transaction so Persist writes the bolt file as it's now,
+// while the next commands are applied.
 func (b *BoldDBStore) Snapshot() (raft.FSMSnapshot, error) {
-	return newSnapshotNoopBoltDB(b.db)
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	tx, err := b.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSnapshotNoopBoltDB(b, tx, b.log), nil
 }
 
+// Restore is used to restore an FSM from a snapshot.
+// The snapshot holds a copy of the bolt file written by Persist, the
+// current data is kept when it's empty or not a bolt file.
+func (b *BoldDBStore) Restore(rc io.ReadCloser) (err error) {
+	defer rc.Close()
+	defer func(start time.Time) {
+		snapshotLatency.Observe(metrics.Since(start), "restore")
+	}(time.Now())
+
+	dr, err := b.crypt.decryptStream(rc)
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(dr)
+	magic, err := r.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(b.path), filepath.Base(b.path)+".restore")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	var n int64
+	if bytes.Equal(magic, zstdMagic) {
+		counter := &countingWriter{w: tmp}
+		err = gozstd.StreamDecompress(counter, r)
+		n = counter.n
+	} else {
+		n, err = io.Copy(tmp, r)
+	}
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrEmptySnapshot
+	}
+
+	// opening the file checks it before the current one is replaced
+	options := &bolt.Options{Timeout: b.config().Timeouts.StoreTimeout()}
+	db, err := bolt.Open(tmp.Name(), 0600, options)
+	if err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// the watchers can't follow the replaced state
+	b.watchers.closeAll()
+
+	if err = b.db.Close(); err != nil {
+		db.Close()
+		return err
+	}
+	// the open handle follows the renamed file
+	if err = os.Rename(tmp.Name(), b.path); err != nil {
+		db.Close()
+
+		var rerr error
+		if b.db, rerr = bolt.Open(b.path, 0600, options); rerr != nil {
+			b.log.Errorf(rerr.Error(),
+				map[string]interface{}{
+					"boltdb-restore": "reopen",
+				})
+		}
+		return err
+	}
+
+	b.db = db
+	return nil
+}
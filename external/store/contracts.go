@@ -1,5 +1,33 @@
 package store
 
+import (
+	"io"
+
+	"github.com/hashicorp/raft"
+)
+
 type Store interface {
+	raft.FSM
+	Get(key string) (data interface{}, err error)
+	// Scan returns up to limit entries whose keys start with the prefix,
+	// skipping the keys for which skip returns true.
+	Scan(prefix string, limit int, skip func(key string) bool) ([]KeyValue, error)
+	// Watch sends the changes of the keys starting with the prefix.
+	Watch(prefix string, skip func(key string) bool) (events <-chan Event, cancel func())
+	// Leases lists the granted leases.
+	Leases() ([]Lease, error)
+	// LeaseOf returns the lease the key is attached to, zero when there is none.
+	LeaseOf(key string) (id uint64, err error)
+	// Backup writes a copy of the database in the format read by Restore.
+	Backup(w io.Writer) error
+	// VerifyBackup checks that the backup can be read by Restore.
+	VerifyBackup(r io.Reader) error
+	// RotateKeys reloads the keyfile and re-encrypts the stored
+	// values with its active key in the background.
+	RotateKeys() error
+	// EncryptionStatus reports the keys and the progress of the key rotation.
+	EncryptionStatus() EncryptionStatus
+	// Ping checks that the underlying database is open.
+	Ping() error
 	Close() error
 }
@@ -0,0 +1,625 @@
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+
+	"github.com/boltdb/bolt"
+)
+
+var (
+	ErrEncryptionDisabled = errors.New("encryption at rest is disabled")
+	ErrUnknownDataKey     = errors.New("data is encrypted with a key missing from the keyfile")
+	ErrRotationRunning    = errors.New("key rotation is already running")
+	ErrCorruptedEnvelope  = errors.New("encrypted data is corrupted")
+)
+
+// The encrypted values and snapshots start with a magic. Gob streams, zstd
+// frames and bolt files never start with a zero byte followed by a letter.
+var (
+	valueMagic  = []byte("\x00NZV")
+	streamMagic = []byte("\x00NZS")
+)
+
+const (
+	dataKeySize = 32
+	nonceSize   = 12
+	// the chunks of the encrypted streams carry their size
+	// with this bit set on the last one, so truncation is detected
+	lastChunkBit = 1 << 31
+)
+
+// EncryptionStatus reports the keys and the progress of the key rotation.
+type EncryptionStatus struct {
+	Enabled    bool       `json:"enabled"`
+	ActiveKey  string     `json:"active_key,omitempty"`
+	Keys       []string   `json:"keys,omitempty"`
+	Rotating   bool       `json:"rotating"`
+	Rewrapped  uint64     `json:"rewrapped"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// keyring holds the key encryption keys of the keyfile. Every value is
+// encrypted with its own data key, which is stored next to it wrapped by
+// the active key, so a rotation only has to rewrap the data keys.
+type keyring struct {
+	ids    []string
+	keys   map[string]cipher.AEAD
+	active string
+}
+
+// loadKeyring reads the "<key id> <base64 key>" lines of the keyfile,
+// blank lines and the ones starting with '#' are skipped.
+func loadKeyring(path string) (*keyring, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	k := &keyring{keys: make(map[string]cipher.AEAD)}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 || len(fields[0]) > 255 {
+			return nil, fmt.Errorf("%s:%d: expected \"<key id> <base64 key>\"", path, i+1)
+		}
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("%s:%d: the key must be 32 bytes encoded as base64", path, i+1)
+		}
+		if _, ok := k.keys[fields[0]]; ok {
+			return nil, fmt.Errorf("%s:%d: duplicated key id %q", path, i+1, fields[0])
+		}
+
+		if k.keys[fields[0]], err = newGCM(key); err != nil {
+			return nil, err
+		}
+		k.ids = append(k.ids, fields[0])
+		k.active = fields[0]
+	}
+
+	if len(k.active) == 0 {
+		return nil, fmt.Errorf("%s: no keys", path)
+	}
+	return k, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// envelope is "<id length><id><nonce><wrapped data key>", the data
+// key is wrapped by the key encryption key with the id.
+func (k *keyring) envelope(dst []byte) (_ []byte, dataKey []byte, err error) {
+	dataKey = make([]byte, dataKeySize)
+	nonce := make([]byte, nonceSize)
+	if _, err = rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+
+	dst = append(dst, byte(len(k.active)))
+	dst = append(dst, k.active...)
+	dst = append(dst, nonce...)
+	return k.keys[k.active].Seal(dst, nonce, dataKey, []byte(k.active)), dataKey, nil
+}
+
+// openEnvelope unwraps the data key, it returns the rest of the data.
+func (k *keyring) openEnvelope(data []byte) (id string, dataKey, rest []byte, err error) {
+	if len(data) < 1 || len(data) < 1+int(data[0])+nonceSize+dataKeySize+16 {
+		return "", nil, nil, ErrCorruptedEnvelope
+	}
+	id, data = string(data[1:1+int(data[0])]), data[1+int(data[0]):]
+
+	kek, ok := k.keys[id]
+	if !ok {
+		return "", nil, nil, ErrUnknownDataKey
+	}
+
+	size := nonceSize + dataKeySize + kek.Overhead()
+	if dataKey, err = kek.Open(nil, data[:nonceSize], data[nonceSize:size], []byte(id)); err != nil {
+		return "", nil, nil, ErrCorruptedEnvelope
+	}
+	return id, dataKey, data[size:], nil
+}
+
+// seal encrypts the value of the key, the key is authenticated
+// as well, so values can't be moved between keys.
+func (k *keyring) seal(dst []byte, key string, value []byte) ([]byte, error) {
+	dst = append(dst, valueMagic...)
+	dst, dataKey, err := k.envelope(dst)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	dst = append(dst, nonce...)
+	return aead.Seal(dst, nonce, value, []byte(key)), nil
+}
+
+func encryptedValue(value []byte) bool {
+	return bytes.HasPrefix(value, valueMagic)
+}
+
+// rewrap wraps the data key of the value with the active key, the
+// encrypted data is kept. It reports false when there's nothing to do.
+func (k *keyring) rewrap(value []byte) ([]byte, bool, error) {
+	id, dataKey, rest, err := k.openEnvelope(value[len(valueMagic):])
+	if err != nil || id == k.active {
+		return nil, false, err
+	}
+
+	nonce := make([]byte, nonceSize)
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, false, err
+	}
+
+	data := append([]byte{}, valueMagic...)
+	data = append(data, byte(len(k.active)))
+	data = append(data, k.active...)
+	data = append(data, nonce...)
+	data = k.keys[k.active].Seal(data, nonce, dataKey, []byte(k.active))
+	return append(data, rest...), true, nil
+}
+
+// streamWriter encrypts the stream in chunks, their nonces are
+// the base nonce xored with the number of the chunk.
+type streamWriter struct {
+	w     io.Writer
+	aead  cipher.AEAD
+	nonce []byte
+	n     uint64
+	buf   []byte
+}
+
+// encryptStream writes the envelope and returns the writer encrypting the
+// data written to it, it must be closed to write the last chunk.
+func (k *keyring) encryptStream(w io.Writer) (io.WriteCloser, error) {
+	header, dataKey, err := k.envelope(append([]byte{}, streamMagic...))
+	if err != nil {
+		return nil, err
+	}
+
+	s := &streamWriter{w: w, nonce: make([]byte, nonceSize), buf: make([]byte, 0, consts.EncryptionChunkSize)}
+	if _, err = rand.Read(s.nonce); err != nil {
+		return nil, err
+	}
+	if s.aead, err = newGCM(dataKey); err != nil {
+		return nil, err
+	}
+
+	if _, err = w.Write(append(header, s.nonce...)); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func chunkNonce(base []byte, n uint64) []byte {
+	nonce := append([]byte{}, base...)
+	counter := binary.BigEndian.Uint64(nonce[nonceSize-8:])
+	binary.BigEndian.PutUint64(nonce[nonceSize-8:], counter^n)
+	return nonce
+}
+
+func (s *streamWriter) Write(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		free := cap(s.buf) - len(s.buf)
+		if free == 0 {
+			if err = s.flush(false); err != nil {
+				return n, err
+			}
+			continue
+		}
+		if free > len(p) {
+			free = len(p)
+		}
+
+		s.buf = append(s.buf, p[:free]...)
+		p, n = p[free:], n+free
+	}
+	return n, nil
+}
+
+func (s *streamWriter) flush(last bool) error {
+	size := uint32(len(s.buf) + s.aead.Overhead())
+	if last {
+		size |= lastChunkBit
+	}
+
+	out := make([]byte, 4, 4+len(s.buf)+s.aead.Overhead())
+	binary.BigEndian.PutUint32(out, size)
+	out = s.aead.Seal(out, chunkNonce(s.nonce, s.n), s.buf, out[:4])
+
+	s.n++
+	s.buf = s.buf[:0]
+	_, err := s.w.Write(out)
+	return err
+}
+
+// Close writes the last chunk, the underlying writer is not closed.
+func (s *streamWriter) Close() error {
+	return s.flush(true)
+}
+
+// streamReader decrypts the chunks written by streamWriter.
+type streamReader struct {
+	r     io.Reader
+	aead  cipher.AEAD
+	nonce []byte
+	n     uint64
+	buf   []byte
+	last  bool
+}
+
+func (s *streamReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.last {
+			return 0, io.EOF
+		}
+		if err := s.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+func (s *streamReader) next() error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(s.r, header); err != nil {
+		if err == io.EOF {
+			// the stream ended before its last chunk
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	s.last = size&lastChunkBit != 0
+	size &^= lastChunkBit
+	if size > consts.EncryptionChunkSize+uint32(s.aead.Overhead()) {
+		return ErrCorruptedEnvelope
+	}
+
+	chunk := make([]byte, size)
+	if _, err := io.ReadFull(s.r, chunk); err != nil {
+		return err
+	}
+
+	var err error
+	if s.buf, err = s.aead.Open(chunk[:0], chunkNonce(s.nonce, s.n), chunk, header); err != nil {
+		return ErrCorruptedEnvelope
+	}
+	s.n++
+	return nil
+}
+
+// rawValue reports whether the values of the key are stored as they are,
+// they hold indexes, ids and user names only and are never encrypted.
+func rawValue(key []byte) bool {
+	for _, preffix := range []string{
+		consts.LeaseOwnersKeyPreffix,
+		consts.LeaseKeysKeyPreffix,
+		consts.KeyLeasesKeyPreffix,
+		consts.KeyRevisionsKeyPreffix,
+		consts.KeyFlagsKeyPreffix,
+	} {
+		if bytes.HasPrefix(key, []byte(preffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// encryption keeps the keyring of the store, it's replaced by the rotation.
+type encryption struct {
+	path string
+
+	mu     sync.RWMutex
+	keys   *keyring
+	status EncryptionStatus
+}
+
+func newEncryption(path string) (*encryption, error) {
+	keys, err := loadKeyring(path)
+	if err != nil {
+		return nil, err
+	}
+	return &encryption{path: path, keys: keys}, nil
+}
+
+// keyring returns the current keys, nil when the encryption is disabled.
+func (e *encryption) keyring() *keyring {
+	if e == nil {
+		return nil
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.keys
+}
+
+// reload replaces the keys with the ones of the keyfile, so the data
+// wrapped by a key added on another server can be read.
+func (e *encryption) reload() (*keyring, error) {
+	keys, err := loadKeyring(e.path)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.keys = keys
+	return keys, nil
+}
+
+// openEnvelope unwraps the data key, the keyfile is
+// reloaded once when the key isn't known.
+func (e *encryption) openEnvelope(data []byte) (dataKey, rest []byte, err error) {
+	keys := e.keyring()
+	_, dataKey, rest, err = keys.openEnvelope(data)
+	if err == ErrUnknownDataKey {
+		if keys, err = e.reload(); err != nil {
+			return nil, nil, err
+		}
+		_, dataKey, rest, err = keys.openEnvelope(data)
+	}
+	return dataKey, rest, err
+}
+
+// open decrypts the value of the key sealed by seal.
+func (e *encryption) open(dst []byte, key string, value []byte) ([]byte, error) {
+	if e == nil {
+		return nil, ErrEncryptionDisabled
+	}
+
+	dataKey, rest, err := e.openEnvelope(value[len(valueMagic):])
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) < nonceSize {
+		return nil, ErrCorruptedEnvelope
+	}
+
+	aead, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if dst, err = aead.Open(dst, rest[:nonceSize], rest[nonceSize:], []byte(key)); err != nil {
+		return nil, ErrCorruptedEnvelope
+	}
+	return dst, nil
+}
+
+// decryptStream returns the reader of the decrypted stream,
+// streams which aren't encrypted are read as they are.
+func (e *encryption) decryptStream(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(streamMagic))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !bytes.Equal(magic, streamMagic) {
+		return br, nil
+	}
+	if e == nil {
+		return nil, ErrEncryptionDisabled
+	}
+
+	// the envelope has a variable size, read its fixed parts first
+	head := make([]byte, len(streamMagic)+1)
+	if _, err = io.ReadFull(br, head); err != nil {
+		return nil, err
+	}
+	envelope := make([]byte, 1+int(head[len(head)-1])+nonceSize+dataKeySize+16+nonceSize)
+	envelope[0] = head[len(head)-1]
+	if _, err = io.ReadFull(br, envelope[1:]); err != nil {
+		return nil, err
+	}
+
+	dataKey, rest, err := e.openEnvelope(envelope)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &streamReader{r: br, nonce: rest}
+	if s.aead, err = newGCM(dataKey); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// VerifyBackup reads the whole backup to check that an encrypted one is
+// complete and intact, raft can't recover from a restore failing half way.
+func (b *BoldDBStore) VerifyBackup(r io.Reader) error {
+	r, err := b.crypt.decryptStream(r)
+	if err != nil {
+		return err
+	}
+
+	if _, err = io.Copy(ioutil.Discard, r); err == io.ErrUnexpectedEOF {
+		return ErrCorruptedEnvelope
+	}
+	return err
+}
+
+// EncryptionStatus reports the keys and the progress of the key rotation.
+func (b *BoldDBStore) EncryptionStatus() EncryptionStatus {
+	if b.crypt == nil {
+		return EncryptionStatus{}
+	}
+
+	b.crypt.mu.RLock()
+	defer b.crypt.mu.RUnlock()
+
+	status := b.crypt.status
+	status.Enabled = true
+	status.ActiveKey = b.crypt.keys.active
+	status.Keys = append([]string{}, b.crypt.keys.ids...)
+	return status
+}
+
+// RotateKeys reloads the keyfile and rewraps the data keys of the stored
+// values with its active key in the background, values stored in clear
+// before the encryption was enabled are encrypted on the way.
+func (b *BoldDBStore) RotateKeys() error {
+	if b.crypt == nil {
+		return ErrEncryptionDisabled
+	}
+
+	keys, err := loadKeyring(b.crypt.path)
+	if err != nil {
+		return err
+	}
+
+	b.crypt.mu.Lock()
+	defer b.crypt.mu.Unlock()
+
+	if b.crypt.status.Rotating {
+		return ErrRotationRunning
+	}
+
+	now := time.Now().UTC()
+	b.crypt.keys = keys
+	b.crypt.status = EncryptionStatus{
+		Rotating:  true,
+		StartedAt: &now,
+	}
+
+	go b.rotate(keys)
+	return nil
+}
+
+func (b *BoldDBStore) rotate(keys *keyring) {
+	var (
+		after []byte
+		done  bool
+		err   error
+	)
+	for !done && err == nil {
+		var n int
+		after, n, done, err = b.rotateBatch(keys, after)
+
+		b.crypt.mu.Lock()
+		b.crypt.status.Rewrapped += uint64(n)
+		b.crypt.mu.Unlock()
+	}
+
+	if err != nil {
+		b.log.Errorf(err.Error(),
+			map[string]interface{}{
+				"store": "key-rotation",
+			})
+	}
+
+	b.crypt.mu.Lock()
+	defer b.crypt.mu.Unlock()
+
+	now := time.Now().UTC()
+	b.crypt.status.Rotating = false
+	b.crypt.status.FinishedAt = &now
+	if err != nil {
+		b.crypt.status.Error = err.Error()
+	}
+}
+
+// rotateBatch rewraps the values of the keys following after in a single
+// transaction, it returns the last visited key and the number of rewrapped values.
+func (b *BoldDBStore) rotateBatch(keys *keyring, after []byte) (last []byte, n int, done bool, err error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(b.bucketName())
+
+		type change struct{ key, value []byte }
+		var changes []change
+
+		c := bucket.Cursor()
+		k, v := c.Seek(after)
+		if k != nil && after != nil && bytes.Equal(k, after) {
+			k, v = c.Next()
+		}
+		for visited := 0; ; k, v = c.Next() {
+			if k == nil {
+				done = true
+				break
+			}
+			if visited == consts.EncryptionRotationBatch {
+				break
+			}
+			visited++
+			last = append(last[:0], k...)
+
+			if len(v) == 0 || rawValue(k) {
+				continue
+			}
+
+			var (
+				value   []byte
+				changed = true
+				err     error
+			)
+			if encryptedValue(v) {
+				value, changed, err = keys.rewrap(v)
+			} else {
+				value, err = keys.seal(nil, string(k), v)
+			}
+			if err != nil {
+				return fmt.Errorf("key %q: %v", k, err)
+			}
+			if changed {
+				changes = append(changes, change{key: append([]byte{}, k...), value: value})
+			}
+		}
+
+		// the cursor is invalidated by the changes, they are made once it's done
+		for _, ch := range changes {
+			if err := bucket.Put(ch.key, ch.value); err != nil {
+				return err
+			}
+		}
+		n = len(changes)
+		return nil
+	})
+
+	return last, n, done, err
+}
@@ -1,10 +1,115 @@
 package store
 
+import "io"
+
 // CommandPayload is payload sent by system when calling raft.Apply(cmd []byte, timeout time.Duration)
 type CommandPayload struct {
 	Operation string
 	Key       string
 	Value     interface{}
+	// Lease attaches the key of a SET to the lease, or selects the revoked lease.
+	Lease uint64
+	// TTL of a granted lease in seconds.
+	TTL int64
+	// Owner of a granted lease, the user allowed to use it.
+	Owner string
+	Txn   *Txn
+	// Metadata describes the request the command comes from, it's
+	// only logged. See MetadataRequestID for the known keys.
+	Metadata map[string]string `json:",omitempty"`
+}
+
+// Keys of the command metadata
+const (
+	// MetadataRequestID is the ID of the client request.
+	MetadataRequestID = "request_id"
+)
+
+// Compare results checked by a transaction
+const (
+	CompareEqual    = "equal"
+	CompareNotEqual = "not_equal"
+	CompareExists   = "exists"
+	CompareMissing  = "missing"
+	// CompareRevision holds while the key exists and it was
+	// last written at the revision of the comparison.
+	CompareRevision = "revision"
+)
+
+// Compare is a condition on the current value of a key
+type Compare struct {
+	Key      string      `json:"key"`
+	Result   string      `json:"result"`
+	Value    interface{} `json:"value,omitempty"`
+	Revision uint64      `json:"revision,omitempty"`
+}
+
+// TxnOp is a GET, SET, DELETE or ATTACH run by a transaction,
+// ATTACH moves an existing key to the lease and keeps its value
+type TxnOp struct {
+	Operation string      `json:"operation"`
+	Key       string      `json:"key"`
+	Value     interface{} `json:"value,omitempty"`
+	Lease     uint64      `json:"lease,omitempty"`
+	// KeepLease leaves the key attached to its current lease, Lease is ignored.
+	KeepLease bool `json:"keep_lease,omitempty"`
+	// Flags are opaque to the store, they are kept with the value of a SET.
+	Flags uint32 `json:"flags,omitempty"`
+}
+
+// Txn runs the success operations when all the comparisons hold
+// and the failure operations otherwise, atomically
+type Txn struct {
+	Compare []Compare `json:"compare"`
+	Success []TxnOp   `json:"success"`
+	Failure []TxnOp   `json:"failure"`
+}
+
+// TxnOpResult is the outcome of a single transaction operation
+type TxnOpResult struct {
+	Operation string      `json:"operation"`
+	Key       string      `json:"key"`
+	Value     interface{} `json:"value,omitempty"`
+	Found     bool        `json:"found"`
+	// Revision is the index of the log entry which last wrote the
+	// key, it's reported by GET together with the flags.
+	Revision uint64 `json:"revision,omitempty"`
+	Flags    uint32 `json:"flags,omitempty"`
+}
+
+// TxnResponse reports which branch of the transaction ran
+type TxnResponse struct {
+	Succeeded bool          `json:"succeeded"`
+	Results   []TxnOpResult `json:"results"`
+}
+
+// Lease keeps the attached keys until it is revoked or expires
+type Lease struct {
+	ID  uint64 `json:"id"`
+	TTL int64  `json:"ttl"`
+	// Owner is the user who granted the lease, empty
+	// when it was granted while auth was disabled.
+	Owner string `json:"owner,omitempty"`
+}
+
+// Event types sent to watchers
+const (
+	EventPut    = "PUT"
+	EventDelete = "DELETE"
+)
+
+// Event is a change of a key applied to the store
+type Event struct {
+	Type  string      `json:"type"`
+	Key   string      `json:"key"`
+	Value interface{} `json:"value,omitempty"`
+	Index uint64      `json:"index"`
+}
+
+// KeyValue is a single entry returned by Scan
+type KeyValue struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
 }
 
 // ApplyResult response from Apply raft
@@ -12,3 +117,15 @@ type ApplyResult struct {
 	Error error
 	Data  interface{}
 }
+
+// countingWriter counts the bytes passed through to the wrapped writer
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
@@ -1,81 +1,59 @@
 package store
 
 import (
-	"io"
+	"time"
 
-	"golang.org/x/sync/errgroup"
-
-	ap "github.com/alex60217101990/nietzsche/external/alloc-pool"
-	"github.com/alex60217101990/nietzsche/external/configs"
 	"github.com/alex60217101990/nietzsche/external/logger"
+	"github.com/alex60217101990/nietzsche/external/metrics"
 
 	"github.com/boltdb/bolt"
 	"github.com/hashicorp/raft"
-	"github.com/valyala/gozstd"
 )
 
 // snapshotNoop handle noop snapshot
+// The read transaction keeps the state of the bolt file from the
+// Snapshot call, bolt can't grow the file while it's open so the
+// commands applied meanwhile may wait for Release.
 type snapshotNoopBoltDB struct {
-	db          *bolt.DB
-	outStream   io.WriteCloser
-	buffersPool ap.BufferPool
+	store *BoldDBStore
+	tx    *bolt.Tx
+	log   logger.Logger
 }
 
-// Persist persist to disk. Return nil on success, otherwise return error.
+// Persist writes the bolt file to the sink the same way Backup does, it's
+// compressed and encrypted when the store is. Return nil on success,
+// otherwise the sink is canceled and the error returned.
 func (s snapshotNoopBoltDB) Persist(sink raft.SnapshotSink) (err error) {
-	if s.outStream == nil {
-		return nil
-	}
-
-	r, w := io.Pipe()
-
-	defer func() {
-		sink.Close()
-	}()
-
-	err = s.db.View(func(tx *bolt.Tx) (err error) {
-
-		if configs.Conf.Store.UseStreamDataCompression {
-			eg := new(errgroup.Group)
-
-			eg.Go(func() (err error) {
-				_, err = tx.WriteTo(w)
-				return err
-			})
+	defer func(start time.Time) {
+		snapshotLatency.Observe(metrics.Since(start), "persist")
+	}(time.Now())
 
-			eg.Go(func() (err error) {
-				return gozstd.StreamCompressLevel(sink, r, 30)
-			})
-
-			err = eg.Wait()
-		} else {
-			_, err = tx.WriteTo(sink)
-		}
-
-		return err
-	})
-
-	if err != nil {
-		logger.AppLogger.Errorf(err.Error(),
+	if err = s.store.writeTx(s.tx, sink); err != nil {
+		s.log.Errorf(err.Error(),
 			map[string]interface{}{
 				"boltdb-shapshot-noop": "persist",
 			})
 
 		sink.Cancel()
+		return err
 	}
 
-	return err
+	return sink.Close()
 }
 
-// Release release the lock after persist snapshot.
+// Release rollbacks the read transaction after persist snapshot.
 // Release is invoked when we are finished with the snapshot.
-func (s snapshotNoopBoltDB) Release() {}
+func (s snapshotNoopBoltDB) Release() {
+	s.tx.Rollback()
+}
 
 // newSnapshotNoop is returned by an FSM in response to a snapshotNoop
 // It must be safe to invoke FSMSnapshot methods with concurrent
 // calls to Apply.
-func newSnapshotNoopBoltDB(db *bolt.DB) (raft.FSMSnapshot, error) {
+func newSnapshotNoopBoltDB(store *BoldDBStore, tx *bolt.Tx, log logger.Logger) raft.FSMSnapshot {
 	return &snapshotNoopBoltDB{
-		db: db,
-	}, nil
+		store: store,
+		tx:    tx,
+		log:   log,
+	}
 }
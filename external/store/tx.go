@@ -0,0 +1,407 @@
+package store
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+
+	"github.com/boltdb/bolt"
+	"github.com/valyala/gozstd"
+)
+
+var (
+	ErrLeaseNotFound    = errors.New("lease not found")
+	ErrInvalidOperation = errors.New("invalid operation")
+	ErrInvalidCompare   = errors.New("invalid compare result")
+)
+
+// storeTx runs the changes of a single command inside one bolt transaction
+// and collects the events published to the watchers once it commits.
+type storeTx struct {
+	b      *BoldDBStore
+	bucket *bolt.Bucket
+	index  uint64
+	events []Event
+
+	// pooled buffers holding the values, bolt keeps
+	// them referenced until the transaction commits
+	buffers []*bytes.Buffer
+	bytes   [][]byte
+}
+
+// update applies fn to the store atomically, the events
+// are published only when the transaction commits.
+func (b *BoldDBStore) update(index uint64, fn func(t *storeTx) error) (err error) {
+	t := &storeTx{
+		b:     b,
+		index: index,
+	}
+	defer t.release()
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		t.bucket = tx.Bucket(b.bucketName())
+		return fn(t)
+	})
+	if err == nil {
+		b.watchers.publish(t.events)
+	}
+
+	return err
+}
+
+func (t *storeTx) release() {
+	for _, buf := range t.buffers {
+		t.b.buffersPool.PutBuffer(buf)
+	}
+	for _, buf := range t.bytes {
+		t.b.pool.PutBytes(buf)
+	}
+}
+
+// encode packs the value of the key, it's compressed and encrypted
+// when the store is configured to.
+func (t *storeTx) encode(key string, value interface{}) (data []byte, err error) {
+	pbuf := t.b.buffersPool.GetBuffer()
+	t.buffers = append(t.buffers, pbuf)
+
+	// encode the pointer, so the concrete type is kept and
+	// the value can be decoded back into an interface
+	if err = gob.NewEncoder(pbuf).Encode(&value); err != nil {
+		return nil, err
+	}
+
+	data = pbuf.Bytes()
+	if t.b.config().Store.UseStreamDataCompression {
+		bbuf := gozstd.CompressLevel(t.b.pool.GetBytes()[:0], data, 30)
+		t.bytes = append(t.bytes, bbuf)
+		if len(data) > 0 {
+			compressionRatio.Observe(float64(len(bbuf)) / float64(len(data)))
+		}
+		data = bbuf
+	}
+
+	if keys := t.b.crypt.keyring(); keys != nil {
+		ebuf, err := keys.seal(t.b.pool.GetBytes()[:0], key, data)
+		if err != nil {
+			return nil, err
+		}
+		t.bytes = append(t.bytes, ebuf)
+		data = ebuf
+	}
+
+	return data, nil
+}
+
+// get returns a copy of the value, decoded values don't reference bolt pages.
+func (t *storeTx) get(key string) (data interface{}, err error) {
+	value := t.bucket.Get([]byte(key))
+	if value == nil {
+		return nil, ErrKeyNotFound
+	}
+
+	pbuf := t.b.buffersPool.GetBuffer()
+	defer t.b.buffersPool.PutBuffer(pbuf)
+
+	return t.b.decode(pbuf, []byte(key), value)
+}
+
+func (t *storeTx) putRaw(key string, value interface{}) error {
+	data, err := t.encode(key, value)
+	if err != nil {
+		return err
+	}
+	return t.bucket.Put([]byte(key), data)
+}
+
+// put stores the value with the flags and moves
+// the key to the lease, zero detaches it.
+func (t *storeTx) put(key string, value interface{}, lease uint64, flags uint32) (err error) {
+	if lease != 0 && t.bucket.Get([]byte(leaseKey(lease))) == nil {
+		return ErrLeaseNotFound
+	}
+	if err = t.attach(key, lease); err != nil {
+		return err
+	}
+	return t.write(key, value, flags)
+}
+
+// write stores the value with the flags and keeps
+// the key attached to its current lease.
+func (t *storeTx) write(key string, value interface{}, flags uint32) (err error) {
+	if err = t.putRaw(key, value); err != nil {
+		return err
+	}
+	if err = t.setMeta(key, flags); err != nil {
+		return err
+	}
+
+	t.events = append(t.events, Event{
+		Type:  EventPut,
+		Key:   key,
+		Value: value,
+		Index: t.index,
+	})
+	return nil
+}
+
+// delete removes the key, missing keys are ignored.
+func (t *storeTx) delete(key string) (err error) {
+	if t.bucket.Get([]byte(key)) == nil {
+		return nil
+	}
+	if err = t.bucket.Delete([]byte(key)); err != nil {
+		return err
+	}
+	if err = t.attach(key, 0); err != nil {
+		return err
+	}
+	if err = t.deleteMeta(key); err != nil {
+		return err
+	}
+
+	t.events = append(t.events, Event{
+		Type:  EventDelete,
+		Key:   key,
+		Index: t.index,
+	})
+	return nil
+}
+
+// attach records the lease of the key in both directions,
+// so revoking the lease finds its keys.
+func (t *storeTx) attach(key string, lease uint64) (err error) {
+	if strings.HasPrefix(key, consts.SystemKeyPreffix) {
+		return nil
+	}
+
+	if current := t.bucket.Get([]byte(consts.KeyLeasesKeyPreffix + key)); current != nil {
+		var prev uint64
+		if prev, err = strconv.ParseUint(string(current), 10, 64); err != nil {
+			return err
+		}
+		if prev == lease {
+			return nil
+		}
+		if err = t.bucket.Delete([]byte(leaseKeysPreffix(prev) + key)); err != nil {
+			return err
+		}
+	}
+
+	if lease == 0 {
+		return t.bucket.Delete([]byte(consts.KeyLeasesKeyPreffix + key))
+	}
+	if err = t.bucket.Put([]byte(consts.KeyLeasesKeyPreffix+key), []byte(strconv.FormatUint(lease, 10))); err != nil {
+		return err
+	}
+	return t.bucket.Put([]byte(leaseKeysPreffix(lease)+key), []byte{})
+}
+
+// setMeta records the revision of the key, the index
+// of the entry writing it, together with its flags.
+func (t *storeTx) setMeta(key string, flags uint32) (err error) {
+	if strings.HasPrefix(key, consts.SystemKeyPreffix) {
+		return nil
+	}
+
+	err = t.bucket.Put([]byte(consts.KeyRevisionsKeyPreffix+key), []byte(strconv.FormatUint(t.index, 10)))
+	if err != nil {
+		return err
+	}
+
+	if flags == 0 {
+		return t.bucket.Delete([]byte(consts.KeyFlagsKeyPreffix + key))
+	}
+	return t.bucket.Put([]byte(consts.KeyFlagsKeyPreffix+key), []byte(strconv.FormatUint(uint64(flags), 10)))
+}
+
+func (t *storeTx) deleteMeta(key string) (err error) {
+	if strings.HasPrefix(key, consts.SystemKeyPreffix) {
+		return nil
+	}
+
+	if err = t.bucket.Delete([]byte(consts.KeyRevisionsKeyPreffix + key)); err != nil {
+		return err
+	}
+	return t.bucket.Delete([]byte(consts.KeyFlagsKeyPreffix + key))
+}
+
+// meta returns the revision and the flags of the key, keys
+// written before revisions were recorded have revision zero.
+func (t *storeTx) meta(key string) (revision uint64, flags uint32, err error) {
+	if value := t.bucket.Get([]byte(consts.KeyRevisionsKeyPreffix + key)); value != nil {
+		if revision, err = strconv.ParseUint(string(value), 10, 64); err != nil {
+			return 0, 0, err
+		}
+	}
+	if value := t.bucket.Get([]byte(consts.KeyFlagsKeyPreffix + key)); value != nil {
+		var n uint64
+		if n, err = strconv.ParseUint(string(value), 10, 32); err != nil {
+			return 0, 0, err
+		}
+		flags = uint32(n)
+	}
+	return revision, flags, nil
+}
+
+func leaseKey(id uint64) string {
+	return consts.LeasesKeyPreffix + strconv.FormatUint(id, 10)
+}
+
+func leaseOwnerKey(id uint64) string {
+	return consts.LeaseOwnersKeyPreffix + strconv.FormatUint(id, 10)
+}
+
+func leaseKeysPreffix(id uint64) string {
+	return consts.LeaseKeysKeyPreffix + strconv.FormatUint(id, 10) + "/"
+}
+
+// grant creates a lease, the id is the index of the log entry
+// which granted it, so every server picks the same one.
+func (t *storeTx) grant(ttl int64, owner string) (_ *Lease, err error) {
+	lease := &Lease{
+		ID:    t.index,
+		TTL:   ttl,
+		Owner: owner,
+	}
+	if len(owner) > 0 {
+		if err = t.bucket.Put([]byte(leaseOwnerKey(lease.ID)), []byte(owner)); err != nil {
+			return nil, err
+		}
+	}
+	return lease, t.putRaw(leaseKey(lease.ID), ttl)
+}
+
+// revoke removes the lease together with its keys.
+func (t *storeTx) revoke(id uint64) (err error) {
+	if t.bucket.Get([]byte(leaseKey(id))) == nil {
+		return ErrLeaseNotFound
+	}
+
+	// collect the keys first, deleting moves the cursor
+	var (
+		keys    []string
+		preffix = []byte(leaseKeysPreffix(id))
+		c       = t.bucket.Cursor()
+	)
+	for k, _ := c.Seek(preffix); k != nil && bytes.HasPrefix(k, preffix); k, _ = c.Next() {
+		keys = append(keys, string(k[len(preffix):]))
+	}
+
+	for _, key := range keys {
+		if err = t.delete(key); err != nil {
+			return err
+		}
+	}
+
+	if err = t.bucket.Delete([]byte(leaseOwnerKey(id))); err != nil {
+		return err
+	}
+	return t.bucket.Delete([]byte(leaseKey(id)))
+}
+
+// txn checks the comparisons and runs the operations of the matching branch.
+func (t *storeTx) txn(txn *Txn) (resp *TxnResponse, err error) {
+	if txn == nil {
+		return nil, ErrInvalidOperation
+	}
+
+	resp = &TxnResponse{Succeeded: true}
+	for _, cmp := range txn.Compare {
+		var ok bool
+		if ok, err = t.compare(cmp); err != nil {
+			return nil, err
+		}
+		if !ok {
+			resp.Succeeded = false
+			break
+		}
+	}
+
+	ops := txn.Success
+	if !resp.Succeeded {
+		ops = txn.Failure
+	}
+
+	resp.Results = make([]TxnOpResult, 0, len(ops))
+	for _, op := range ops {
+		result := TxnOpResult{
+			Operation: strings.ToUpper(op.Operation),
+			Key:       op.Key,
+		}
+
+		switch result.Operation {
+		case "GET":
+			result.Value, err = t.get(op.Key)
+			result.Found = err == nil
+			switch err {
+			case nil:
+				result.Revision, result.Flags, err = t.meta(op.Key)
+			case ErrKeyNotFound:
+				err = nil
+			}
+		case "SET":
+			if op.KeepLease {
+				err = t.write(op.Key, op.Value, op.Flags)
+			} else {
+				err = t.put(op.Key, op.Value, op.Lease, op.Flags)
+			}
+			result.Found = true
+		case "ATTACH":
+			result.Found = t.bucket.Get([]byte(op.Key)) != nil
+			switch {
+			case !result.Found:
+			case op.Lease != 0 && t.bucket.Get([]byte(leaseKey(op.Lease))) == nil:
+				err = ErrLeaseNotFound
+			default:
+				err = t.attach(op.Key, op.Lease)
+			}
+		case "DELETE":
+			result.Found = t.bucket.Get([]byte(op.Key)) != nil
+			err = t.delete(op.Key)
+		default:
+			err = ErrInvalidOperation
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		resp.Results = append(resp.Results, result)
+	}
+
+	return resp, nil
+}
+
+func (t *storeTx) compare(cmp Compare) (bool, error) {
+	value, err := t.get(cmp.Key)
+	if err != nil && err != ErrKeyNotFound {
+		return false, err
+	}
+	found := err == nil
+
+	switch cmp.Result {
+	case CompareExists:
+		return found, nil
+	case CompareMissing:
+		return !found, nil
+	case CompareEqual:
+		return found && reflect.DeepEqual(value, cmp.Value), nil
+	case CompareNotEqual:
+		return !found || !reflect.DeepEqual(value, cmp.Value), nil
+	case CompareRevision:
+		if !found {
+			return false, nil
+		}
+		revision, _, err := t.meta(cmp.Key)
+		return revision == cmp.Revision, err
+	default:
+		return false, ErrInvalidCompare
+	}
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/alex60217101990/nietzsche/external/consts"
+)
+
+type watcher struct {
+	prefix string
+	skip   func(key string) bool
+	ch     chan Event
+}
+
+// watchHub fans the applied changes out to the watchers. Publishing never
+// blocks the apply loop, a watcher which falls behind is closed.
+type watchHub struct {
+	mu       sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{
+		watchers: make(map[*watcher]struct{}),
+	}
+}
+
+func (h *watchHub) subscribe(prefix string, skip func(key string) bool) (<-chan Event, func()) {
+	w := &watcher{
+		prefix: prefix,
+		skip:   skip,
+		ch:     make(chan Event, consts.WatchBufferSize),
+	}
+
+	h.mu.Lock()
+	h.watchers[w] = struct{}{}
+	h.mu.Unlock()
+
+	return w.ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		h.remove(w)
+	}
+}
+
+// remove must be called with the lock held.
+func (h *watchHub) remove(w *watcher) {
+	if _, ok := h.watchers[w]; ok {
+		delete(h.watchers, w)
+		close(w.ch)
+	}
+}
+
+func (h *watchHub) publish(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for w := range h.watchers {
+		for _, event := range events {
+			if !strings.HasPrefix(event.Key, w.prefix) || (w.skip != nil && w.skip(event.Key)) {
+				continue
+			}
+
+			select {
+			case w.ch <- event:
+			default:
+				h.remove(w)
+			}
+			if _, ok := h.watchers[w]; !ok {
+				break
+			}
+		}
+	}
+}
+
+// closeAll ends every watch, used when the whole state is replaced.
+func (h *watchHub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for w := range h.watchers {
+		h.remove(w)
+	}
+}
@@ -3,17 +3,24 @@ module github.com/alex60217101990/nietzsche
 go 1.14
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/alex60217101990/test_api v0.0.0-20200817131217-eb1539573334
 	github.com/boltdb/bolt v1.3.1
 	github.com/fatih/color v1.9.0
+	github.com/golang/protobuf v1.4.2
+	github.com/hashicorp/go-hclog v0.9.1
 	github.com/hashicorp/raft v1.1.2
 	github.com/hashicorp/raft-boltdb v0.0.0-20191021154308-4207f1bf0617
 	github.com/libp2p/go-buffer-pool v0.0.2
 	github.com/pkg/errors v0.8.1
+	github.com/prometheus/client_golang v1.7.1
 	github.com/valyala/bytebufferpool v1.0.0
 	github.com/valyala/gozstd v1.8.3
 	go.uber.org/zap v1.16.0
-	golang.org/x/sync v0.0.0-20190423024810-112230192c58
+	golang.org/x/sync v0.0.0-20190911185100-cd5d95a43a6e
+	google.golang.org/grpc v1.33.2
+	google.golang.org/protobuf v1.25.0
+	gopkg.in/natefinch/lumberjack.v2 v2.2.1
 	gopkg.in/yaml.v2 v2.3.0
 	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776
 )